@@ -13,9 +13,57 @@ type Node interface {
 	Pos() token.Position
 }
 
+type AnnotationArgument struct {
+	// Key is empty for positional arguments.
+	Key   string
+	Value Node
+}
+
+type Annotation struct {
+	Position token.Position
+
+	Name      string
+	Arguments []AnnotationArgument
+}
+
+func (a *Annotation) Pos() token.Position {
+	return a.Position
+}
+
+// FindAnnotation returns the first annotation called name, or nil.
+func FindAnnotation(list []*Annotation, name string) *Annotation {
+	for _, a := range list {
+		if a.Name == name {
+			return a
+		}
+	}
+	return nil
+}
+
+// Deprecation reports whether list holds @deprecated and returns its
+// optional message.
+func Deprecation(list []*Annotation) (message string, ok bool) {
+	a := FindAnnotation(list, "deprecated")
+	if a == nil {
+		return "", false
+	}
+	if len(a.Arguments) > 0 {
+		if s, ok := a.Arguments[0].Value.(*StringLiteralType); ok {
+			message = s.Value
+		}
+	}
+	return message, true
+}
+
 type EnumerationValue struct {
 	Key   string
 	Value Node
+
+	// Implicit is set when the value was not written in the source and
+	// continues from the previous case.
+	Implicit bool
+
+	Annotations []*Annotation
 }
 
 type EnumerationType struct {
@@ -24,16 +72,64 @@ type EnumerationType struct {
 	Name       string
 	ReturnType Node
 
-	Values []EnumerationValue
+	Values   []EnumerationValue
+	Reserved []*RangeType
+
+	Annotations []*Annotation
 }
 
 func (e *EnumerationType) Pos() token.Position {
 	return e.Position
 }
 
+// IsOpen reports whether the enum is annotated @open. Open enums keep unknown
+// values on decode; closed enums, the default, reject them.
+func (e *EnumerationType) IsOpen() bool {
+	return FindAnnotation(e.Annotations, "open") != nil
+}
+
+type FlagsType struct {
+	Position token.Position
+
+	Name        string
+	StorageType Node
+
+	// Values and Reserved hold bit indices, not masks.
+	Values   []EnumerationValue
+	Reserved []*RangeType
+
+	Annotations []*Annotation
+}
+
+func (f *FlagsType) Pos() token.Position {
+	return f.Position
+}
+
 type PacketField struct {
 	Name string
 	Type Node
+
+	// Magic is the fixed value of a field declared as `Type name = value;`.
+	// Encoders write it and decoders verify it; it is not exposed as data.
+	Magic Node
+
+	// Checksum is set for `Type name = checksum(algorithm, first..last);`.
+	Checksum *ChecksumType
+
+	// Constraint is the condition of `Type name where condition;`, which
+	// the value must satisfy.
+	Constraint Node
+
+	// Default is the value of `Type name = default(value);`, or of
+	// `name: Type = value` for a parameter, used when a packet is
+	// constructed without it. Unlike Magic it is not checked on decode.
+	Default Node
+
+	// Peek is set for `peek Type name;`, which reads the value without
+	// consuming it, so the next field starts at the same offset.
+	Peek bool
+
+	Annotations []*Annotation
 }
 
 type PacketType struct {
@@ -41,14 +137,49 @@ type PacketType struct {
 
 	Name string
 
+	// TypeParameters names the type parameters of a generic packet, as in
+	// `packet Prefixed<T>()`.
+	TypeParameters []*IdentifierType
+
 	Parameters []PacketField
 	Fields     []PacketField
+
+	Annotations []*Annotation
 }
 
 func (p *PacketType) Pos() token.Position {
 	return p.Position
 }
 
+// MessageType is a tag-length-value declaration. Each entry starts with the
+// two Header fields, the tag and the length in bytes of the value that
+// follows. Entries with unknown tags are skipped using the length.
+type MessageType struct {
+	Position token.Position
+
+	Name string
+
+	Header []PacketField
+	Fields []MessageField
+
+	Annotations []*Annotation
+}
+
+func (m *MessageType) Pos() token.Position {
+	return m.Position
+}
+
+// MessageField is a `field tag Name Type;` entry of a message.
+type MessageField struct {
+	Position token.Position
+
+	Tag  *NumberLiteralType
+	Name string
+	Type Node
+
+	Annotations []*Annotation
+}
+
 type ProtocolType struct {
 	Position token.Position
 
@@ -62,13 +193,198 @@ func (p *ProtocolType) Pos() token.Position {
 type NumberLiteralType struct {
 	Position token.Position
 
+	// Value holds the low 64 bits and High bits 64 to 127 of the literal.
 	Value uint64
+	High  uint64
 }
 
 func (n *NumberLiteralType) Pos() token.Position {
 	return n.Position
 }
 
+// FloatLiteralType is a decimal literal with a fractional part or an
+// exponent, such as 0.1 or 2.5e3.
+type FloatLiteralType struct {
+	Position token.Position
+
+	Value float64
+}
+
+func (f *FloatLiteralType) Pos() token.Position {
+	return f.Position
+}
+
+// StringLiteralType is a quoted string such as "degC". Value has its escapes
+// interpreted.
+type StringLiteralType struct {
+	Position token.Position
+
+	Value string
+}
+
+func (s *StringLiteralType) Pos() token.Position {
+	return s.Position
+}
+
+// BooleanLiteralType is `true` or `false`. In expressions it has the value 1
+// or 0.
+type BooleanLiteralType struct {
+	Position token.Position
+
+	Value bool
+}
+
+func (b *BooleanLiteralType) Pos() token.Position {
+	return b.Position
+}
+
+// ChecksumType computes a field from the encoded bytes of the fields named by
+// Range, inclusive.
+type ChecksumType struct {
+	Position token.Position
+
+	Algorithm string
+	Range     *RangeType
+}
+
+func (c *ChecksumType) Pos() token.Position {
+	return c.Position
+}
+
+type ArrayLiteralType struct {
+	Position token.Position
+
+	Elements []Node
+}
+
+func (a *ArrayLiteralType) Pos() token.Position {
+	return a.Position
+}
+
+type BinaryExpression struct {
+	Position token.Position
+
+	Operator string
+	Left     Node
+	Right    Node
+}
+
+func (b *BinaryExpression) Pos() token.Position {
+	return b.Position
+}
+
+type UnaryExpression struct {
+	Position token.Position
+
+	Operator string
+	Operand  Node
+}
+
+func (u *UnaryExpression) Pos() token.Position {
+	return u.Position
+}
+
+// SizedType is the type of a `sized(len) { ... }` statement, whose fields
+// must take exactly Size bytes.
+type SizedType struct {
+	Position token.Position
+
+	Size   Node
+	Fields []PacketField
+}
+
+func (s *SizedType) Pos() token.Position {
+	return s.Position
+}
+
+// LetType is the type of a `let name = value;` field, which is computed from
+// other fields and takes no bits on the wire.
+type LetType struct {
+	Position token.Position
+
+	Value Node
+}
+
+func (l *LetType) Pos() token.Position {
+	return l.Position
+}
+
+// InExpression tests whether Operand lies in any of Ranges, as in
+// `version in 1..3` or `kind in [1, 4..6]`.
+type InExpression struct {
+	Position token.Position
+
+	Operand Node
+	Ranges  []*RangeType
+}
+
+func (i *InExpression) Pos() token.Position {
+	return i.Position
+}
+
+// AssertType is the type of an `assert(condition, "message");` statement,
+// which must hold once the fields before it are decoded.
+type AssertType struct {
+	Position token.Position
+
+	Condition Node
+	Message   *StringLiteralType
+}
+
+func (a *AssertType) Pos() token.Position {
+	return a.Position
+}
+
+// SelectorExpression selects a field of a structured value, as in
+// `last.kind`.
+type SelectorExpression struct {
+	Position token.Position
+
+	Operand Node
+	Field   string
+}
+
+func (s *SelectorExpression) Pos() token.Position {
+	return s.Position
+}
+
+// KeywordArgument is a `key = value` type argument, as in
+// `Array(u8, until = last == 0)`.
+type KeywordArgument struct {
+	Position token.Position
+
+	Key   string
+	Value Node
+}
+
+func (k *KeywordArgument) Pos() token.Position {
+	return k.Position
+}
+
+// AlignType is the type of an `align(bits);` statement, which pads the packet
+// to the next multiple of Bits from its start.
+type AlignType struct {
+	Position token.Position
+
+	Bits Node
+}
+
+func (a *AlignType) Pos() token.Position {
+	return a.Position
+}
+
+// RangeType is an inclusive range Low..High. A single value has Low == High.
+type RangeType struct {
+	Position token.Position
+
+	Low  Node
+	High Node
+}
+
+func (r *RangeType) Pos() token.Position {
+	return r.Position
+}
+
 type IdentifierType struct {
 	Position token.Position
 
@@ -95,6 +411,9 @@ type TypeType struct {
 
 	TypeName  string
 	Arguments []Node
+
+	// TypeArguments instantiates a generic packet, as in Prefixed<u8>.
+	TypeArguments []Node
 }
 
 func (t *TypeType) Pos() token.Position {
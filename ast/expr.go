@@ -0,0 +1,129 @@
+package ast
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// BinaryPrecedence follows Go: higher binds tighter.
+var BinaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"==": 3, "!=": 3, "<": 3, "<=": 3, ">": 3, ">=": 3,
+	"+": 4, "-": 4, "|": 4, "^": 4,
+	"*": 5, "/": 5, "%": 5, "<<": 5, ">>": 5, "&": 5,
+}
+
+// InPrecedence is the precedence of `in`, which binds like a comparison.
+const InPrecedence = 3
+
+// ExprString formats an expression or type in schema syntax, adding
+// parentheses only where precedence requires them.
+func ExprString(n Node) string {
+	var b strings.Builder
+	writeExpr(&b, n, 0)
+	return b.String()
+}
+
+func writeExpr(b *strings.Builder, n Node, outer int) {
+	switch n := n.(type) {
+	case *NumberLiteralType:
+		if n.High == 0 {
+			b.WriteString(strconv.FormatUint(n.Value, 10))
+			return
+		}
+		v := new(big.Int).SetUint64(n.High)
+		v.Lsh(v, 64).Or(v, new(big.Int).SetUint64(n.Value))
+		b.WriteString(v.String())
+	case *FloatLiteralType:
+		b.WriteString(strconv.FormatFloat(n.Value, 'g', -1, 64))
+	case *StringLiteralType:
+		b.WriteString(strconv.Quote(n.Value))
+	case *BooleanLiteralType:
+		b.WriteString(strconv.FormatBool(n.Value))
+	case *IdentifierType:
+		b.WriteString(n.Value)
+	case *SelectorExpression:
+		writeExpr(b, n.Operand, len(BinaryPrecedence))
+		b.WriteString(".")
+		b.WriteString(n.Field)
+	case *UnaryExpression:
+		b.WriteString(n.Operator)
+		writeExpr(b, n.Operand, len(BinaryPrecedence))
+	case *BinaryExpression:
+		precedence := BinaryPrecedence[n.Operator]
+		if precedence < outer {
+			b.WriteString("(")
+		}
+		writeExpr(b, n.Left, precedence)
+		b.WriteString(" " + n.Operator + " ")
+		writeExpr(b, n.Right, precedence+1)
+		if precedence < outer {
+			b.WriteString(")")
+		}
+	case *InExpression:
+		if InPrecedence < outer {
+			b.WriteString("(")
+		}
+		writeExpr(b, n.Operand, InPrecedence+1)
+		b.WriteString(" in ")
+		if len(n.Ranges) != 1 {
+			b.WriteString("[")
+		}
+		for i, r := range n.Ranges {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeExpr(b, r, 0)
+		}
+		if len(n.Ranges) != 1 {
+			b.WriteString("]")
+		}
+		if InPrecedence < outer {
+			b.WriteString(")")
+		}
+	case *RangeType:
+		writeExpr(b, n.Low, 0)
+		if n.High != n.Low {
+			b.WriteString("..")
+			writeExpr(b, n.High, 0)
+		}
+	case *KeywordArgument:
+		b.WriteString(n.Key + " = ")
+		writeExpr(b, n.Value, 0)
+	case *ArrayLiteralType:
+		b.WriteString("[")
+		for i, e := range n.Elements {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeExpr(b, e, 0)
+		}
+		b.WriteString("]")
+	case *TypeType:
+		b.WriteString(n.TypeName)
+		if len(n.TypeArguments) > 0 {
+			b.WriteString("<")
+			for i, a := range n.TypeArguments {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				writeExpr(b, a, 0)
+			}
+			b.WriteString(">")
+		}
+		if len(n.Arguments) > 0 {
+			b.WriteString("(")
+			for i, a := range n.Arguments {
+				if i > 0 {
+					b.WriteString(", ")
+				}
+				writeExpr(b, a, 0)
+			}
+			b.WriteString(")")
+		}
+	default:
+		b.WriteString("?")
+	}
+}
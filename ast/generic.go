@@ -0,0 +1,75 @@
+package ast
+
+// Instantiate returns a copy of the generic packet p with its type parameters
+// replaced by args, for backends that monomorphise generics. The copy keeps
+// p's name and has no type parameters. Nodes that do not mention a type
+// parameter are shared with p.
+func Instantiate(p *PacketType, args []Node) *PacketType {
+	subst := make(map[string]Node, len(p.TypeParameters))
+	for i, tp := range p.TypeParameters {
+		if i < len(args) {
+			subst[tp.Value] = args[i]
+		}
+	}
+	out := *p
+	out.TypeParameters = nil
+	out.Parameters = substituteFields(p.Parameters, subst)
+	out.Fields = substituteFields(p.Fields, subst)
+	return &out
+}
+
+func substituteFields(fields []PacketField, subst map[string]Node) []PacketField {
+	if fields == nil {
+		return nil
+	}
+	out := make([]PacketField, len(fields))
+	for i, f := range fields {
+		f.Type = substitute(f.Type, subst)
+		out[i] = f
+	}
+	return out
+}
+
+func substitute(n Node, subst map[string]Node) Node {
+	switch n := n.(type) {
+	case *TypeType:
+		if len(n.Arguments) == 0 && len(n.TypeArguments) == 0 {
+			if arg, ok := subst[n.TypeName]; ok {
+				return arg
+			}
+			return n
+		}
+		t := *n
+		t.Arguments = substituteNodes(n.Arguments, subst)
+		t.TypeArguments = substituteNodes(n.TypeArguments, subst)
+		// Only the element of an Array names a type; other arguments
+		// are expressions.
+		if t.TypeName == "Array" && len(t.Arguments) > 0 {
+			if id, ok := t.Arguments[0].(*IdentifierType); ok {
+				if arg, ok := subst[id.Value]; ok {
+					t.Arguments[0] = arg
+				}
+			}
+		}
+		return &t
+	case *SizedType:
+		s := *n
+		s.Fields = substituteFields(n.Fields, subst)
+		return &s
+	}
+	return n
+}
+
+func substituteNodes(nodes []Node, subst map[string]Node) []Node {
+	if nodes == nil {
+		return nil
+	}
+	out := make([]Node, len(nodes))
+	for i, n := range nodes {
+		if _, ok := n.(*TypeType); ok {
+			n = substitute(n, subst)
+		}
+		out[i] = n
+	}
+	return out
+}
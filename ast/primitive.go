@@ -0,0 +1,85 @@
+package ast
+
+import (
+	"strconv"
+	"strings"
+)
+
+// IntegerType reports the width in bits and signedness of a primitive
+// integer type such as u8, i32 or u16be. ok is false for any other node.
+func IntegerType(n Node) (bits int, signed bool, ok bool) {
+	t, isType := n.(*TypeType)
+	if !isType || len(t.Arguments) != 0 {
+		return 0, false, false
+	}
+	name := strings.TrimSuffix(strings.TrimSuffix(t.TypeName, "le"), "be")
+	if len(name) < 2 || (name[0] != 'u' && name[0] != 'i') {
+		return 0, false, false
+	}
+	bits, err := strconv.Atoi(name[1:])
+	if err != nil {
+		return 0, false, false
+	}
+	switch bits {
+	case 8, 16, 32, 64, 128:
+		return bits, name[0] == 'i', true
+	}
+	return 0, false, false
+}
+
+// FloatType reports the width in bits and byte order of a primitive
+// floating-point type such as f32, f64le or f32be. Without a suffix the
+// byte order is big-endian. ok is false for any other node.
+func FloatType(n Node) (bits int, le bool, ok bool) {
+	t, isType := n.(*TypeType)
+	if !isType || len(t.Arguments) != 0 {
+		return 0, false, false
+	}
+	switch strings.TrimSuffix(strings.TrimSuffix(t.TypeName, "le"), "be") {
+	case "f32":
+		bits = 32
+	case "f64":
+		bits = 64
+	default:
+		return 0, false, false
+	}
+	return bits, strings.HasSuffix(t.TypeName, "le"), true
+}
+
+// RepeatMode is how the number of elements of an Array is determined.
+type RepeatMode int
+
+const (
+	// RepeatCount reads a number of elements given by an expression.
+	RepeatCount RepeatMode = iota
+	// RepeatUntil reads elements until a condition on the last one holds.
+	RepeatUntil
+	// RepeatWhile reads elements while a condition holds.
+	RepeatWhile
+	// RepeatEOS reads elements until the end of the enclosing data.
+	RepeatEOS
+)
+
+// ArrayRepeat classifies the second argument of an Array type and returns
+// its count or condition expression, which is nil for RepeatEOS. ok is false
+// if t is not a two-argument Array or the argument is not understood.
+func ArrayRepeat(t *TypeType) (mode RepeatMode, expr Node, ok bool) {
+	if t.TypeName != "Array" || len(t.Arguments) != 2 {
+		return 0, nil, false
+	}
+	switch arg := t.Arguments[1].(type) {
+	case *KeywordArgument:
+		switch arg.Key {
+		case "until":
+			return RepeatUntil, arg.Value, true
+		case "while":
+			return RepeatWhile, arg.Value, true
+		}
+		return 0, nil, false
+	case *IdentifierType:
+		if arg.Value == "eos" {
+			return RepeatEOS, nil, true
+		}
+	}
+	return RepeatCount, t.Arguments[1], true
+}
@@ -0,0 +1,251 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// AnnotationTarget is a set of places an annotation may appear.
+type AnnotationTarget uint8
+
+const (
+	TargetEnum AnnotationTarget = 1 << iota
+	TargetEnumCase
+	TargetPacket
+	TargetParameter
+	TargetField
+	TargetFlags
+	TargetMessage
+
+	TargetAny = TargetEnum | TargetEnumCase | TargetPacket | TargetParameter | TargetField | TargetFlags | TargetMessage
+)
+
+func (t AnnotationTarget) String() string {
+	switch t {
+	case TargetEnum:
+		return "enum"
+	case TargetEnumCase:
+		return "enum case"
+	case TargetPacket:
+		return "packet"
+	case TargetParameter:
+		return "parameter"
+	case TargetField:
+		return "field"
+	case TargetFlags:
+		return "flags"
+	case TargetMessage:
+		return "message"
+	default:
+		return "unknown"
+	}
+}
+
+// AnnotationSpec describes a known annotation. Annotations without a spec
+// are reported as warnings and otherwise passed through to backends.
+type AnnotationSpec struct {
+	Targets AnnotationTarget
+
+	// MinArgs and MaxArgs bound the number of positional arguments.
+	// A negative MaxArgs means there is no upper bound.
+	MinArgs int
+	MaxArgs int
+
+	// Keys lists the accepted keyword arguments.
+	Keys []string
+
+	// Validate, if set, is called after the arity and keys are checked.
+	Validate func(a *ast.Annotation) error
+}
+
+var annotations = map[string]*AnnotationSpec{}
+
+// RegisterAnnotation makes an annotation known to the checker.
+// It panics if name is already registered.
+func RegisterAnnotation(name string, spec AnnotationSpec) {
+	if _, ok := annotations[name]; ok {
+		panic("check: annotation @" + name + " registered twice")
+	}
+	annotations[name] = &spec
+}
+
+// LookupAnnotation returns the spec registered for name.
+func LookupAnnotation(name string) (*AnnotationSpec, bool) {
+	spec, ok := annotations[name]
+	return spec, ok
+}
+
+func init() {
+	RegisterAnnotation("deprecated", AnnotationSpec{
+		Targets:  TargetAny,
+		MaxArgs:  1,
+		Validate: deprecationMessage,
+	})
+	RegisterAnnotation("open", AnnotationSpec{Targets: TargetEnum})
+	RegisterAnnotation("closed", AnnotationSpec{Targets: TargetEnum})
+	RegisterAnnotation("padding", AnnotationSpec{
+		Targets:  TargetField,
+		MinArgs:  1,
+		MaxArgs:  1,
+		Validate: identifierArgument("ignore", "zero", "preserve"),
+	})
+	RegisterAnnotation("trailing", AnnotationSpec{
+		Targets:  TargetField,
+		MinArgs:  1,
+		MaxArgs:  1,
+		Validate: identifierArgument("error", "skip"),
+	})
+	RegisterAnnotation("text", AnnotationSpec{
+		Targets: TargetField,
+		Keys:    []string{"invalid", "length"},
+		Validate: keywordArguments(map[string][]string{
+			"invalid": {"error", "replace"},
+			"length":  {"bytes", "units"},
+		}),
+	})
+	RegisterAnnotation("at", AnnotationSpec{
+		Targets:  TargetField,
+		MinArgs:  1,
+		MaxArgs:  1,
+		Keys:     []string{"from"},
+		Validate: validateAt,
+	})
+	RegisterAnnotation("version", AnnotationSpec{
+		Targets:  TargetPacket,
+		MinArgs:  1,
+		MaxArgs:  1,
+		Validate: nameArgument,
+	})
+	RegisterAnnotation("since", AnnotationSpec{
+		Targets:  TargetField,
+		MinArgs:  1,
+		MaxArgs:  1,
+		Validate: numberArgument,
+	})
+	RegisterAnnotation("until", AnnotationSpec{
+		Targets:  TargetField,
+		MinArgs:  1,
+		MaxArgs:  1,
+		Validate: numberArgument,
+	})
+	RegisterAnnotation("scale", AnnotationSpec{
+		Targets:  TargetField,
+		MinArgs:  1,
+		MaxArgs:  1,
+		Validate: numericArgument,
+	})
+	RegisterAnnotation("offset", AnnotationSpec{
+		Targets:  TargetField,
+		MinArgs:  1,
+		MaxArgs:  1,
+		Validate: numericArgument,
+	})
+	RegisterAnnotation("unit", AnnotationSpec{
+		Targets:  TargetField,
+		MinArgs:  1,
+		MaxArgs:  1,
+		Validate: stringArgument,
+	})
+	RegisterAnnotation("bit", AnnotationSpec{Targets: TargetField})
+}
+
+// identifierArgument validates that the first positional argument is one of
+// the given identifiers.
+func identifierArgument(allowed ...string) func(a *ast.Annotation) error {
+	return func(a *ast.Annotation) error {
+		for _, arg := range a.Arguments {
+			if arg.Key != "" {
+				continue
+			}
+			if id, ok := arg.Value.(*ast.IdentifierType); ok {
+				for _, v := range allowed {
+					if id.Value == v {
+						return nil
+					}
+				}
+			}
+			break
+		}
+		return fmt.Errorf("@%s expects one of %s", a.Name, strings.Join(allowed, ", "))
+	}
+}
+
+// nameArgument validates that the first positional argument is a name.
+func nameArgument(a *ast.Annotation) error {
+	if _, ok := a.Arguments[0].Value.(*ast.IdentifierType); !ok || a.Arguments[0].Key != "" {
+		return fmt.Errorf("@%s expects a name", a.Name)
+	}
+	return nil
+}
+
+// numberArgument validates that the first positional argument is a number
+// of up to 64 bits.
+func numberArgument(a *ast.Annotation) error {
+	if n, ok := a.Arguments[0].Value.(*ast.NumberLiteralType); !ok || n.High != 0 || a.Arguments[0].Key != "" {
+		return fmt.Errorf("@%s expects a number", a.Name)
+	}
+	return nil
+}
+
+func (c *checker) checkAnnotations(target AnnotationTarget, list []*ast.Annotation) {
+	seen := make(map[string]bool, len(list))
+	for _, a := range list {
+		spec, ok := LookupAnnotation(a.Name)
+		if !ok {
+			c.warnf(a.Position, "unknown annotation @%s", a.Name)
+			continue
+		}
+		if seen[a.Name] {
+			c.errorf(a.Position, "duplicate annotation @%s", a.Name)
+			continue
+		}
+		seen[a.Name] = true
+
+		if spec.Targets&target == 0 {
+			c.errorf(a.Position, "annotation @%s is not allowed on %s", a.Name, target)
+			continue
+		}
+
+		positional := 0
+		valid := true
+		for _, arg := range a.Arguments {
+			if arg.Key == "" {
+				positional++
+				continue
+			}
+			known := false
+			for _, k := range spec.Keys {
+				if k == arg.Key {
+					known = true
+					break
+				}
+			}
+			if !known {
+				c.errorf(arg.Value.Pos(), "unknown argument %q for annotation @%s", arg.Key, a.Name)
+				valid = false
+			}
+		}
+		if positional < spec.MinArgs || (spec.MaxArgs >= 0 && positional > spec.MaxArgs) {
+			c.errorf(a.Position, "annotation @%s expects %s, got %d", a.Name, argCount(spec.MinArgs, spec.MaxArgs), positional)
+			valid = false
+		}
+		if valid && spec.Validate != nil {
+			if err := spec.Validate(a); err != nil {
+				c.errorf(a.Position, "%s", err)
+			}
+		}
+	}
+}
+
+func argCount(min, max int) string {
+	switch {
+	case max < 0:
+		return fmt.Sprintf("at least %d argument(s)", min)
+	case min == max:
+		return fmt.Sprintf("%d argument(s)", min)
+	default:
+		return fmt.Sprintf("%d to %d arguments", min, max)
+	}
+}
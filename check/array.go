@@ -0,0 +1,107 @@
+package check
+
+import (
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// lastName is the identifier that refers to the element just read inside the
+// condition of an `Array(T, until = ...)`.
+const lastName = "last"
+
+// checkArray validates how the length of an Array field is determined and
+// makes sure terminated arrays have a condition that can end them.
+func (c *checker) checkArray(p *ast.PacketType, scope map[string]bool, f *ast.PacketField, t *ast.TypeType) {
+	if len(t.Arguments) != 2 {
+		c.errorf(t.Position, "Array takes an element type and a count, until, while or eos")
+		return
+	}
+	mode, expr, ok := ast.ArrayRepeat(t)
+	if !ok {
+		arg := t.Arguments[1].(*ast.KeywordArgument)
+		c.errorf(arg.Position, "unknown Array argument %s; expected until or while", arg.Key)
+		return
+	}
+
+	elem := t.Arguments[0]
+	switch mode {
+	case ast.RepeatCount:
+		c.checkExpr(p, scope, expr)
+		return
+	case ast.RepeatUntil:
+		inner := make(map[string]bool, len(scope)+1)
+		for name := range scope {
+			inner[name] = true
+		}
+		inner[lastName] = true
+		c.checkExpr(p, inner, expr)
+		c.checkSelectors(expr, elem)
+		if !refersTo(expr, lastName) {
+			c.errorf(expr.Pos(), "until condition of %s.%s never changes: it must refer to %s, the element just read", p.Name, f.Name, lastName)
+		}
+	case ast.RepeatWhile:
+		c.checkExpr(p, scope, expr)
+		if !refersTo(expr, offsetName) {
+			c.errorf(expr.Pos(), "while condition of %s.%s never changes: it must refer to %s", p.Name, f.Name, offsetName)
+		}
+	}
+
+	if size, exact, _ := c.typeSize(elem, nil); exact && size == 0 {
+		c.errorf(elem.Pos(), "elements of %s.%s have no size, so the array would never end", p.Name, f.Name)
+	}
+}
+
+// checkSelectors resolves `last.field` selectors against the element type.
+func (c *checker) checkSelectors(expr, elem ast.Node) {
+	walkExpr(expr, func(n ast.Node) {
+		s, ok := n.(*ast.SelectorExpression)
+		if !ok {
+			return
+		}
+		id, ok := s.Operand.(*ast.IdentifierType)
+		if !ok || id.Value != lastName {
+			return
+		}
+		// Declared types in arguments parse as identifiers.
+		name := typeName(elem)
+		if id, ok := elem.(*ast.IdentifierType); ok {
+			name = id.Value
+		}
+		packet, ok := c.decls[name].(*ast.PacketType)
+		if !ok {
+			c.errorf(s.Position, "%s is a %s and has no fields", lastName, name)
+			return
+		}
+		c.fieldIndex(packet, &ast.IdentifierType{Position: s.Position, Value: s.Field})
+	})
+}
+
+// walkExpr calls fn for n and every subexpression of n.
+func walkExpr(n ast.Node, fn func(ast.Node)) {
+	fn(n)
+	switch n := n.(type) {
+	case *ast.UnaryExpression:
+		walkExpr(n.Operand, fn)
+	case *ast.BinaryExpression:
+		walkExpr(n.Left, fn)
+		walkExpr(n.Right, fn)
+	case *ast.SelectorExpression:
+		walkExpr(n.Operand, fn)
+	case *ast.InExpression:
+		walkExpr(n.Operand, fn)
+		for _, r := range n.Ranges {
+			walkExpr(r.Low, fn)
+			walkExpr(r.High, fn)
+		}
+	}
+}
+
+// refersTo reports whether an expression uses the identifier name.
+func refersTo(expr ast.Node, name string) bool {
+	found := false
+	walkExpr(expr, func(n ast.Node) {
+		if id, ok := n.(*ast.IdentifierType); ok && id.Value == name {
+			found = true
+		}
+	})
+	return found
+}
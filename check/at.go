@@ -0,0 +1,48 @@
+package check
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// atOrigins are the positions an @at offset may be counted from: the start
+// of the data, the start of the packet, or the position of the field.
+var atOrigins = []string{"start", "packet", "here"}
+
+// validateAt checks the `from` argument of @at(offset, from = origin).
+func validateAt(a *ast.Annotation) error {
+	for _, arg := range a.Arguments {
+		if arg.Key != "from" {
+			continue
+		}
+		if id, ok := arg.Value.(*ast.IdentifierType); !ok || !contains(atOrigins, id.Value) {
+			return fmt.Errorf("@at(from = ...) expects one of start, packet, here")
+		}
+	}
+	return nil
+}
+
+// atOffset returns the offset expression of a field's @at annotation.
+func atOffset(f *ast.PacketField) ast.Node {
+	a := ast.FindAnnotation(f.Annotations, "at")
+	if a == nil {
+		return nil
+	}
+	for _, arg := range a.Arguments {
+		if arg.Key == "" {
+			return arg.Value
+		}
+	}
+	return nil
+}
+
+// checkAt checks a field read out of line at a byte offset. Such a field
+// does not move the offset of the fields that follow it.
+func (c *checker) checkAt(p *ast.PacketType, scope map[string]bool, f *ast.PacketField, offset ast.Node) {
+	if isPadding(f.Type) {
+		c.errorf(offset.Pos(), "@at does not apply to padding")
+		return
+	}
+	c.checkExpr(p, scope, offset)
+}
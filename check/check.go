@@ -0,0 +1,491 @@
+package check
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/token"
+	"github.com/unsafe-risk/protodecl/wire"
+)
+
+type Severity uint8
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return "unknown"
+	}
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Position token.Position
+	Message  string
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("%s: %s: %s", d.Position, d.Severity, d.Message)
+}
+
+// HasErrors reports whether any of the diagnostics is an error.
+func HasErrors(diagnostics []*Diagnostic) bool {
+	for _, d := range diagnostics {
+		if d.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+type checker struct {
+	diagnostics []*Diagnostic
+
+	// decls maps declared type names to their declarations.
+	decls map[string]ast.Node
+	// spans holds the layout before and after each field read in line by
+	// the packet whose layout is being checked.
+	spans map[*ast.PacketField]span
+	// sizing holds the packets whose size is being computed.
+	sizing map[*ast.PacketType]bool
+	// typeParams holds the type parameters of the packet being checked.
+	typeParams map[string]bool
+}
+
+func (c *checker) errorf(pos token.Position, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, &Diagnostic{
+		Severity: SeverityError,
+		Position: pos,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+func (c *checker) warnf(pos token.Position, format string, args ...interface{}) {
+	c.diagnostics = append(c.diagnostics, &Diagnostic{
+		Severity: SeverityWarning,
+		Position: pos,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Check validates the semantics of a parsed tree and returns every problem
+// found. Warnings do not prevent compilation.
+func Check(t *ast.Tree) []*Diagnostic {
+	c := &checker{
+		decls:  make(map[string]ast.Node),
+		sizing: make(map[*ast.PacketType]bool),
+	}
+	for i := range t.Nodes {
+		switch node := t.Nodes[i].(type) {
+		case *ast.EnumerationType:
+			c.declare(node.Name, node)
+		case *ast.FlagsType:
+			c.declare(node.Name, node)
+		case *ast.PacketType:
+			c.declare(node.Name, node)
+		case *ast.MessageType:
+			c.declare(node.Name, node)
+		}
+	}
+	for i := range t.Nodes {
+		switch node := t.Nodes[i].(type) {
+		case *ast.EnumerationType:
+			c.checkEnum(node)
+		case *ast.FlagsType:
+			c.checkFlags(node)
+		case *ast.PacketType:
+			c.checkPacket(node)
+		case *ast.MessageType:
+			c.checkMessage(node)
+		}
+	}
+	return c.diagnostics
+}
+
+func (c *checker) declare(name string, n ast.Node) {
+	if prev, ok := c.decls[name]; ok {
+		c.errorf(n.Pos(), "%s redeclared; previous declaration at %s", name, prev.Pos())
+		return
+	}
+	c.decls[name] = n
+}
+
+func (c *checker) checkEnum(e *ast.EnumerationType) {
+	c.checkAnnotations(TargetEnum, e.Annotations)
+	if e.IsOpen() {
+		if a := ast.FindAnnotation(e.Annotations, "closed"); a != nil {
+			c.errorf(a.Position, "enum %s cannot be both @open and @closed", e.Name)
+		}
+	}
+
+	width, signed, ok := ast.IntegerType(e.ReturnType)
+	if !ok {
+		c.errorf(e.ReturnType.Pos(), "enum %s must be stored in an integer type", e.Name)
+		width = 128
+	}
+
+	reserved := c.checkReserved(e.Name, e.Reserved)
+	names := make(map[string]bool, len(e.Values))
+	values := make(map[wire.Uint128]string, len(e.Values))
+	for i := range e.Values {
+		v := &e.Values[i]
+		c.checkAnnotations(TargetEnumCase, v.Annotations)
+		if names[v.Key] {
+			c.errorf(v.Value.Pos(), "duplicate enum case %s.%s", e.Name, v.Key)
+		}
+		names[v.Key] = true
+
+		n, ok := v.Value.(*ast.NumberLiteralType)
+		if !ok {
+			continue
+		}
+		value := literal(n)
+		if !fits(n, width, signed) {
+			c.errorf(n.Position, "value %s of %s.%s does not fit in %s", value, e.Name, v.Key, typeName(e.ReturnType))
+		}
+		if r := inRanges(reserved, value); r != nil {
+			c.errorf(n.Position, "value %s of %s.%s is reserved at %s", value, e.Name, v.Key, r.Position)
+		}
+		if other, dup := values[value]; dup {
+			c.errorf(n.Position, "value %s of %s.%s duplicates %s.%s", value, e.Name, v.Key, e.Name, other)
+			continue
+		}
+		values[value] = v.Key
+	}
+}
+
+func (c *checker) checkFlags(f *ast.FlagsType) {
+	c.checkAnnotations(TargetFlags, f.Annotations)
+
+	width, signed, ok := ast.IntegerType(f.StorageType)
+	if !ok || signed {
+		c.errorf(f.StorageType.Pos(), "flags %s must be stored in an unsigned integer type", f.Name)
+	}
+
+	reserved := c.checkReserved(f.Name, f.Reserved)
+	names := make(map[string]bool, len(f.Values))
+	bits := make(map[wire.Uint128]string, len(f.Values))
+	for i := range f.Values {
+		v := &f.Values[i]
+		c.checkAnnotations(TargetEnumCase, v.Annotations)
+		if names[v.Key] {
+			c.errorf(v.Value.Pos(), "duplicate flag %s.%s", f.Name, v.Key)
+		}
+		names[v.Key] = true
+
+		n, ok := v.Value.(*ast.NumberLiteralType)
+		if !ok {
+			continue
+		}
+		bit := literal(n)
+		if width > 0 && (n.High != 0 || n.Value >= uint64(width)) {
+			c.errorf(n.Position, "bit %s of %s.%s does not fit in %d-bit storage", bit, f.Name, v.Key, width)
+		}
+		if r := inRanges(reserved, bit); r != nil {
+			c.errorf(n.Position, "bit %s of %s.%s is reserved at %s", bit, f.Name, v.Key, r.Position)
+		}
+		if other, dup := bits[bit]; dup {
+			c.errorf(n.Position, "bit %s of %s.%s overlaps with %s.%s", bit, f.Name, v.Key, f.Name, other)
+			continue
+		}
+		bits[bit] = v.Key
+	}
+}
+
+type numberRange struct {
+	Position  token.Position
+	Low, High wire.Uint128
+}
+
+// checkReserved validates the reserved ranges of an enum or flags
+// declaration and returns the well-formed ones.
+func (c *checker) checkReserved(name string, list []*ast.RangeType) []numberRange {
+	var ranges []numberRange
+	for _, r := range list {
+		low, lok := r.Low.(*ast.NumberLiteralType)
+		high, hok := r.High.(*ast.NumberLiteralType)
+		if !lok || !hok {
+			c.errorf(r.Position, "reserved range of %s must be numeric", name)
+			continue
+		}
+		lowValue, highValue := literal(low), literal(high)
+		if lowValue.Cmp(highValue) > 0 {
+			c.errorf(r.Position, "reserved range %s..%s of %s is empty", lowValue, highValue, name)
+			continue
+		}
+		for _, other := range ranges {
+			if lowValue.Cmp(other.High) <= 0 && other.Low.Cmp(highValue) <= 0 {
+				c.warnf(r.Position, "reserved range %s..%s of %s overlaps the range at %s", lowValue, highValue, name, other.Position)
+				break
+			}
+		}
+		ranges = append(ranges, numberRange{
+			Position: r.Position,
+			Low:      lowValue,
+			High:     highValue,
+		})
+	}
+	return ranges
+}
+
+func inRanges(ranges []numberRange, v wire.Uint128) *numberRange {
+	for i := range ranges {
+		if ranges[i].Low.Cmp(v) <= 0 && v.Cmp(ranges[i].High) <= 0 {
+			return &ranges[i]
+		}
+	}
+	return nil
+}
+
+func typeName(n ast.Node) string {
+	if t, ok := n.(*ast.TypeType); ok {
+		return t.TypeName
+	}
+	return "type"
+}
+
+func (c *checker) checkPacket(p *ast.PacketType) {
+	c.checkAnnotations(TargetPacket, p.Annotations)
+	c.checkTypeParameters(p)
+	c.typeParams = make(map[string]bool, len(p.TypeParameters))
+	for _, tp := range p.TypeParameters {
+		c.typeParams[tp.Value] = true
+	}
+	defer func() { c.typeParams = nil }()
+	for i := range p.Parameters {
+		c.checkAnnotations(TargetParameter, p.Parameters[i].Annotations)
+		c.checkTypeRef(p.Parameters[i].Type)
+		if p.Parameters[i].Default != nil {
+			c.checkDefault(p, &p.Parameters[i])
+		}
+	}
+	for i := range p.Fields {
+		c.checkField(p, &p.Fields[i])
+	}
+	c.checkLayout(p)
+	c.checkVersions(p)
+}
+
+func (c *checker) checkField(p *ast.PacketType, f *ast.PacketField) {
+	c.checkAnnotations(TargetField, f.Annotations)
+	if a := ast.FindAnnotation(f.Annotations, "padding"); a != nil {
+		if !isPadding(f.Type) {
+			c.errorf(a.Position, "@padding applies only to Padding fields and align statements")
+		} else if len(a.Arguments) == 1 {
+			if id, ok := a.Arguments[0].Value.(*ast.IdentifierType); ok && id.Value == "preserve" {
+				c.checkPreserve(p, f)
+			}
+		}
+	}
+	if a := ast.FindAnnotation(f.Annotations, "bit"); a != nil && !isBool(f.Type) {
+		c.errorf(a.Position, "@bit applies only to bool fields")
+	}
+	if a := ast.FindAnnotation(f.Annotations, "trailing"); a != nil {
+		if _, ok := f.Type.(*ast.SizedType); !ok {
+			c.errorf(a.Position, "@trailing applies only to sized blocks")
+		}
+	}
+	if _, ok := f.Type.(*ast.LetType); ok {
+		if a := ast.FindAnnotation(f.Annotations, "at"); a != nil {
+			c.errorf(a.Position, "@at does not apply to let fields, which are not read")
+		}
+	}
+	if sized, ok := f.Type.(*ast.SizedType); ok {
+		for i := range sized.Fields {
+			c.checkField(p, &sized.Fields[i])
+		}
+	}
+	if f.Peek {
+		c.checkPeek(p, f)
+	}
+	c.checkText(p, f)
+	c.checkScale(p, f)
+	if f.Magic != nil {
+		c.checkMagic(p, f)
+	}
+	if f.Default != nil {
+		c.checkDefault(p, f)
+	}
+	if f.Checksum != nil {
+		c.checkChecksum(p, f)
+	}
+}
+
+// checkChecksum validates the algorithm and covered field range of a
+// checksum field.
+func (c *checker) checkChecksum(p *ast.PacketType, f *ast.PacketField) {
+	sum := f.Checksum
+	width, signed, ok := ast.IntegerType(f.Type)
+	if !ok || signed {
+		c.errorf(f.Type.Pos(), "checksum field %s.%s must be an unsigned integer", p.Name, f.Name)
+	}
+	if algorithm, err := wire.NewChecksum(sum.Algorithm); err != nil {
+		c.warnf(sum.Position, "unknown checksum algorithm %s; it must be registered with wire.RegisterChecksum", sum.Algorithm)
+	} else if ok && algorithm.Bits() > width {
+		c.errorf(sum.Position, "%s produces %d-bit checksums but %s.%s is %s", sum.Algorithm, algorithm.Bits(), p.Name, f.Name, typeName(f.Type))
+	}
+
+	first, ok := c.fieldIndex(p, sum.Range.Low)
+	if !ok {
+		return
+	}
+	last, ok := c.fieldIndex(p, sum.Range.High)
+	if !ok {
+		return
+	}
+	if first > last {
+		c.errorf(sum.Range.Position, "checksum range %s..%s is reversed", p.Fields[first].Name, p.Fields[last].Name)
+		return
+	}
+	for i := first; i <= last; i++ {
+		if &p.Fields[i] == f {
+			c.errorf(sum.Range.Position, "checksum %s.%s cannot cover itself", p.Name, f.Name)
+			return
+		}
+	}
+}
+
+// fieldIndex resolves an identifier naming a field of p.
+func (c *checker) fieldIndex(p *ast.PacketType, n ast.Node) (int, bool) {
+	id, ok := n.(*ast.IdentifierType)
+	if !ok {
+		c.errorf(n.Pos(), "expected a field name of %s", p.Name)
+		return 0, false
+	}
+	for i := range p.Fields {
+		if p.Fields[i].Name == id.Value {
+			return i, true
+		}
+	}
+	c.errorf(id.Position, "%s has no field %s", p.Name, id.Value)
+	return 0, false
+}
+
+// checkMagic validates the fixed value of an integer, bool, Bytes(n) or
+// String(n) field.
+func (c *checker) checkMagic(p *ast.PacketType, f *ast.PacketField) {
+	if isBool(f.Type) {
+		if _, ok := f.Magic.(*ast.BooleanLiteralType); !ok {
+			c.errorf(f.Magic.Pos(), "magic value of %s.%s must be true or false", p.Name, f.Name)
+		}
+		return
+	}
+	if width, signed, ok := ast.IntegerType(f.Type); ok {
+		n, isNumber := f.Magic.(*ast.NumberLiteralType)
+		if !isNumber {
+			c.errorf(f.Magic.Pos(), "magic value of %s.%s must be a number", p.Name, f.Name)
+			return
+		}
+		if !fits(n, width, signed) {
+			c.errorf(n.Position, "magic value %s of %s.%s does not fit in %s", literal(n), p.Name, f.Name, typeName(f.Type))
+		}
+		return
+	}
+
+	size, ok := bytesSize(f.Type)
+	if !ok {
+		c.errorf(f.Magic.Pos(), "magic values are only supported on integer, bool, Bytes(n) and String(n) fields, not %s", typeName(f.Type))
+		return
+	}
+	if str, isString := f.Magic.(*ast.StringLiteralType); isString {
+		if uint64(len(str.Value)) != size {
+			c.errorf(str.Position, "magic value of %s.%s has %d bytes, want %d", p.Name, f.Name, len(str.Value), size)
+		}
+		return
+	}
+	array, isArray := f.Magic.(*ast.ArrayLiteralType)
+	if !isArray {
+		c.errorf(f.Magic.Pos(), "magic value of %s.%s must be a byte array or string", p.Name, f.Name)
+		return
+	}
+	if uint64(len(array.Elements)) != size {
+		c.errorf(array.Position, "magic value of %s.%s has %d bytes, want %d", p.Name, f.Name, len(array.Elements), size)
+	}
+	for _, e := range array.Elements {
+		n, isNumber := e.(*ast.NumberLiteralType)
+		if !isNumber {
+			c.errorf(e.Pos(), "magic value of %s.%s must contain only numbers", p.Name, f.Name)
+		} else if !fits(n, 8, false) {
+			c.errorf(n.Position, "magic byte %s of %s.%s does not fit in a byte", literal(n), p.Name, f.Name)
+		}
+	}
+}
+
+// checkPreserve rejects preserved padding that can be wider than the 64 bits
+// kept for it. Widths that are not constant are checked when decoding.
+func (c *checker) checkPreserve(p *ast.PacketType, f *ast.PacketField) {
+	switch t := f.Type.(type) {
+	case *ast.AlignType:
+		// align(bits) pads by at most bits-1.
+		if bits, ok := evalConst(t.Bits, nil); ok && bits > 65 {
+			c.errorf(t.Position, "align(%d) in %s can pad by %d bits, but at most 64 bits of padding can be preserved", bits, p.Name, bits-1)
+		}
+	case *ast.TypeType:
+		if len(t.Arguments) != 1 {
+			return
+		}
+		if bits, ok := evalConst(t.Arguments[0], nil); ok && bits > 64 {
+			c.errorf(t.Position, "%s.%s is %d bits of padding, but at most 64 bits can be preserved", p.Name, f.Name, bits)
+		}
+	}
+}
+
+func isBool(n ast.Node) bool {
+	t, ok := n.(*ast.TypeType)
+	return ok && t.TypeName == "bool" && len(t.Arguments) == 0
+}
+
+func isPadding(n ast.Node) bool {
+	switch n := n.(type) {
+	case *ast.AlignType:
+		return true
+	case *ast.TypeType:
+		return n.TypeName == "Padding"
+	}
+	return false
+}
+
+// bytesSize returns n for a Bytes(n) or String(n) type with a constant size.
+func bytesSize(n ast.Node) (uint64, bool) {
+	t, ok := n.(*ast.TypeType)
+	if !ok || (t.TypeName != "Bytes" && t.TypeName != "String") || len(t.Arguments) != 1 {
+		return 0, false
+	}
+	size, ok := t.Arguments[0].(*ast.NumberLiteralType)
+	if !ok || size.High != 0 {
+		return 0, false
+	}
+	return size.Value, true
+}
+
+func literal(n *ast.NumberLiteralType) wire.Uint128 {
+	return wire.Uint128{Hi: n.High, Lo: n.Value}
+}
+
+// fits reports whether a literal is representable in an integer type.
+func fits(n *ast.NumberLiteralType, width int, signed bool) bool {
+	if width >= 128 {
+		return !signed || n.High < 1<<63
+	}
+	return n.High == 0 && n.Value <= maxValue(width, signed)
+}
+
+// maxValue returns the largest value of an integer type up to 64 bits.
+func maxValue(width int, signed bool) uint64 {
+	switch {
+	case width >= 64 && !signed:
+		return 1<<64 - 1
+	case signed:
+		return 1<<(width-1) - 1
+	default:
+		return 1<<width - 1
+	}
+}
@@ -0,0 +1,40 @@
+package check
+
+import (
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// checkConstraint checks the `where` condition of a field, which may refer to
+// the field itself.
+func (c *checker) checkConstraint(p *ast.PacketType, scope map[string]bool, f *ast.PacketField) {
+	inner := make(map[string]bool, len(scope)+1)
+	for name := range scope {
+		inner[name] = true
+	}
+	inner[f.Name] = true
+	c.checkExpr(p, inner, f.Constraint)
+
+	if v, ok := evalConst(f.Constraint, nil); ok {
+		if v == 0 {
+			c.errorf(f.Constraint.Pos(), "constraint %s of %s.%s can never hold", ast.ExprString(f.Constraint), p.Name, f.Name)
+		} else {
+			c.warnf(f.Constraint.Pos(), "constraint %s of %s.%s always holds", ast.ExprString(f.Constraint), p.Name, f.Name)
+		}
+		return
+	}
+	if !refersTo(f.Constraint, f.Name) {
+		c.warnf(f.Constraint.Pos(), "constraint %s of %s.%s does not refer to %s", ast.ExprString(f.Constraint), p.Name, f.Name, f.Name)
+	}
+}
+
+// checkAssert checks an assert statement against the fields before it.
+func (c *checker) checkAssert(p *ast.PacketType, scope map[string]bool, a *ast.AssertType) {
+	c.checkExpr(p, scope, a.Condition)
+	if v, ok := evalConst(a.Condition, nil); ok {
+		if v == 0 {
+			c.errorf(a.Condition.Pos(), "assertion %s in %s can never hold", ast.ExprString(a.Condition), p.Name)
+		} else {
+			c.warnf(a.Condition.Pos(), "assertion %s in %s always holds", ast.ExprString(a.Condition), p.Name)
+		}
+	}
+}
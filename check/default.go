@@ -0,0 +1,143 @@
+package check
+
+import (
+	"math"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// checkDefault checks that the default value of a field or parameter is a
+// constant of its type.
+func (c *checker) checkDefault(p *ast.PacketType, f *ast.PacketField) {
+	v := f.Default
+	if f.Peek {
+		c.errorf(v.Pos(), "peek field %s.%s cannot have a default; it is not written", p.Name, f.Name)
+		return
+	}
+
+	if width, signed, ok := ast.IntegerType(f.Type); ok {
+		if !c.constFits(v, width, signed) {
+			c.errorf(v.Pos(), "default of %s.%s must be a constant that fits in %s", p.Name, f.Name, typeName(f.Type))
+		}
+		return
+	}
+	if isBool(f.Type) {
+		if _, ok := v.(*ast.BooleanLiteralType); !ok {
+			c.errorf(v.Pos(), "default of %s.%s must be true or false", p.Name, f.Name)
+		}
+		return
+	}
+	if size, ok := bytesSize(f.Type); ok {
+		switch v := v.(type) {
+		case *ast.StringLiteralType:
+			if uint64(len(v.Value)) != size {
+				c.errorf(v.Position, "default of %s.%s has %d bytes, want %d", p.Name, f.Name, len(v.Value), size)
+			}
+		case *ast.ArrayLiteralType:
+			if uint64(len(v.Elements)) != size {
+				c.errorf(v.Position, "default of %s.%s has %d bytes, want %d", p.Name, f.Name, len(v.Elements), size)
+			}
+			for _, e := range v.Elements {
+				if !c.constFits(e, 8, false) {
+					c.errorf(e.Pos(), "default byte of %s.%s must be a constant that fits in a byte", p.Name, f.Name)
+				}
+			}
+		default:
+			c.errorf(v.Pos(), "default of %s.%s must be a string or byte array", p.Name, f.Name)
+		}
+		return
+	}
+
+	if bits, _, ok := ast.FloatType(f.Type); ok {
+		x, ok := constFloat(v)
+		switch {
+		case !ok:
+			c.errorf(v.Pos(), "default of %s.%s must be a number", p.Name, f.Name)
+		case bits == 32 && math.Abs(x) > math.MaxFloat32:
+			c.errorf(v.Pos(), "default of %s.%s does not fit in %s", p.Name, f.Name, typeName(f.Type))
+		}
+		return
+	}
+
+	t, ok := f.Type.(*ast.TypeType)
+	if !ok {
+		c.errorf(v.Pos(), "defaults are not supported on %s.%s", p.Name, f.Name)
+		return
+	}
+	switch t.TypeName {
+	case "Bits":
+		width, ok := uint64(0), len(t.Arguments) == 1
+		if ok {
+			width, ok = evalConst(t.Arguments[0], nil)
+		}
+		if ok && width > 0 && width <= 64 && !c.constFits(v, int(width), false) {
+			c.errorf(v.Pos(), "default of %s.%s must be a constant that fits in %d bits", p.Name, f.Name, width)
+		}
+		return
+	case "String", "CString", "LongString",
+		"String8le", "String16le", "String32le", "String64le",
+		"String8be", "String16be", "String32be", "String64be":
+		if _, ok := v.(*ast.StringLiteralType); !ok {
+			c.errorf(v.Pos(), "default of %s.%s must be a string", p.Name, f.Name)
+		}
+		return
+	}
+
+	switch decl := c.decls[t.TypeName].(type) {
+	case *ast.EnumerationType:
+		id, ok := v.(*ast.IdentifierType)
+		if !ok || !hasKey(decl.Values, id.Value) {
+			c.errorf(v.Pos(), "default of %s.%s must be a case of %s", p.Name, f.Name, decl.Name)
+			return
+		}
+		c.checkDeprecatedCase(decl.Name, decl.Values, id)
+		return
+	case *ast.FlagsType:
+		names := []ast.Node{v}
+		if array, ok := v.(*ast.ArrayLiteralType); ok {
+			names = array.Elements
+		}
+		for _, n := range names {
+			id, ok := n.(*ast.IdentifierType)
+			if !ok || !hasKey(decl.Values, id.Value) {
+				c.errorf(n.Pos(), "default of %s.%s must be a flag of %s or a list of them", p.Name, f.Name, decl.Name)
+				continue
+			}
+			c.checkDeprecatedCase(decl.Name, decl.Values, id)
+		}
+		return
+	}
+	c.errorf(v.Pos(), "defaults are not supported on %s fields", typeName(f.Type))
+}
+
+// constFits reports whether n is a constant that fits in an integer type.
+func (c *checker) constFits(n ast.Node, width int, signed bool) bool {
+	if lit, ok := n.(*ast.NumberLiteralType); ok {
+		return fits(lit, width, signed)
+	}
+	v, ok := evalConst(n, nil)
+	switch {
+	case !ok:
+		return false
+	case !signed:
+		// A negated constant wraps around; only zero survives it.
+		if u, ok := n.(*ast.UnaryExpression); ok && u.Operator == "-" {
+			return v == 0
+		}
+		return v <= maxValue(width, false)
+	case width >= 64:
+		return true
+	default:
+		min := -int64(maxValue(width, true)) - 1
+		return int64(v) >= min && int64(v) <= int64(maxValue(width, true))
+	}
+}
+
+func hasKey(values []ast.EnumerationValue, key string) bool {
+	for _, v := range values {
+		if v.Key == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package check
+
+import (
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/token"
+)
+
+// deprecationMessage validates the optional message of @deprecated.
+func deprecationMessage(a *ast.Annotation) error {
+	if len(a.Arguments) == 0 {
+		return nil
+	}
+	return stringArgument(a)
+}
+
+// warnDeprecated warns that the declaration what, used at pos, is
+// deprecated if list holds @deprecated.
+func (c *checker) warnDeprecated(pos token.Position, what string, list []*ast.Annotation) {
+	message, ok := ast.Deprecation(list)
+	switch {
+	case !ok:
+	case message != "":
+		c.warnf(pos, "%s is deprecated: %s", what, message)
+	default:
+		c.warnf(pos, "%s is deprecated", what)
+	}
+}
+
+// checkDeprecatedType warns if name, used as a type at pos, is a deprecated
+// declaration.
+func (c *checker) checkDeprecatedType(pos token.Position, name string) {
+	switch decl := c.decls[name].(type) {
+	case *ast.PacketType:
+		c.warnDeprecated(pos, name, decl.Annotations)
+	case *ast.MessageType:
+		c.warnDeprecated(pos, name, decl.Annotations)
+	case *ast.EnumerationType:
+		c.warnDeprecated(pos, name, decl.Annotations)
+	case *ast.FlagsType:
+		c.warnDeprecated(pos, name, decl.Annotations)
+	}
+}
+
+// checkDeprecatedCase warns if the case or flag id of decl is deprecated.
+func (c *checker) checkDeprecatedCase(decl string, values []ast.EnumerationValue, id *ast.IdentifierType) {
+	for _, v := range values {
+		if v.Key == id.Value {
+			c.warnDeprecated(id.Position, decl+"."+id.Value, v.Annotations)
+			return
+		}
+	}
+}
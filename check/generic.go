@@ -0,0 +1,93 @@
+package check
+
+import (
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/token"
+)
+
+// checkTypeParameters reports duplicate type parameters and ones that hide a
+// declared type.
+func (c *checker) checkTypeParameters(p *ast.PacketType) {
+	seen := make(map[string]bool, len(p.TypeParameters))
+	for _, tp := range p.TypeParameters {
+		if seen[tp.Value] {
+			c.errorf(tp.Position, "duplicate type parameter %s of %s", tp.Value, p.Name)
+		}
+		seen[tp.Value] = true
+		if decl, ok := c.decls[tp.Value]; ok {
+			c.errorf(tp.Position, "type parameter %s of %s hides the declaration at %s", tp.Value, p.Name, decl.Pos())
+		}
+	}
+}
+
+// builtinTypes are the primitive types other than integers and floats.
+var builtinTypes = map[string]bool{
+	"bool": true, "Bits": true, "Padding": true, "Array": true,
+	"String": true, "CString": true, "LongString": true,
+	"Bytes": true, "Cbytes": true, "LongBytes": true,
+	"String8le": true, "String16le": true, "String32le": true, "String64le": true,
+	"String8be": true, "String16be": true, "String32be": true, "String64be": true,
+	"Bytes8le": true, "Bytes16le": true, "Bytes32le": true, "Bytes64le": true,
+	"Bytes8be": true, "Bytes16be": true, "Bytes32be": true, "Bytes64be": true,
+}
+
+// checkTypeRef checks that every type named in a type, including its type
+// arguments, is defined, and that generic packets are instantiated with the
+// right number of type arguments.
+func (c *checker) checkTypeRef(n ast.Node) {
+	switch n := n.(type) {
+	case *ast.TypeType:
+		for _, arg := range n.TypeArguments {
+			c.checkTypeRef(arg)
+		}
+		if n.TypeName == "Array" && len(n.Arguments) > 0 {
+			c.checkTypeRef(n.Arguments[0])
+		}
+		if !c.checkDefined(n.Position, n.TypeName) {
+			return
+		}
+		c.checkArity(n.Position, n.TypeName, len(n.TypeArguments))
+		c.checkDeprecatedType(n.Position, n.TypeName)
+	case *ast.IdentifierType:
+		// Declared element types in Array arguments parse as identifiers.
+		if !c.checkDefined(n.Position, n.Value) {
+			return
+		}
+		c.checkArity(n.Position, n.Value, 0)
+		c.checkDeprecatedType(n.Position, n.Value)
+	}
+}
+
+// checkDefined reports whether name is a primitive type, a declaration or a
+// type parameter of the packet being checked, and reports it otherwise.
+func (c *checker) checkDefined(pos token.Position, name string) bool {
+	t := &ast.TypeType{TypeName: name}
+	if _, _, ok := ast.IntegerType(t); ok {
+		return true
+	}
+	if _, _, ok := ast.FloatType(t); ok {
+		return true
+	}
+	if _, ok := c.decls[name]; ok || builtinTypes[name] || c.typeParams[name] {
+		return true
+	}
+	c.errorf(pos, "undefined: type %s", name)
+	return false
+}
+
+func (c *checker) checkArity(pos token.Position, name string, got int) {
+	p, ok := c.decls[name].(*ast.PacketType)
+	if !ok {
+		if got > 0 {
+			c.errorf(pos, "%s is not a generic packet", name)
+		}
+		return
+	}
+	switch want := len(p.TypeParameters); {
+	case want == got:
+	case want == 0:
+		c.errorf(pos, "%s is not a generic packet", name)
+	default:
+		c.errorf(pos, "%s takes %d type arguments but got %d", name, want, got)
+	}
+}
@@ -0,0 +1,549 @@
+package check
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/token"
+)
+
+// offsetName is the identifier that refers to the current bit offset from the
+// start of the packet inside field type arguments.
+const offsetName = "offset"
+
+// layout tracks what is statically known about the bit offset of the next
+// field: offset ≡ residue (mod modulus). A zero modulus means the offset is
+// known exactly and equals residue.
+type layout struct {
+	modulus uint64
+	residue uint64
+}
+
+func (l *layout) exact() (uint64, bool) {
+	return l.residue, l.modulus == 0
+}
+
+// advance moves past a field. If exact is false the field's size is only
+// known to be a multiple of unit bits.
+func (l *layout) advance(size uint64, exact bool, unit uint64) {
+	if exact {
+		l.residue += size
+	} else {
+		l.modulus = gcd(l.modulus, unit)
+	}
+	if l.modulus != 0 {
+		l.residue %= l.modulus
+	}
+}
+
+// aligned reports whether the offset is always a multiple of bits.
+func (l *layout) aligned(bits uint64) bool {
+	return l.modulus%bits == 0 && l.residue%bits == 0
+}
+
+func (l *layout) align(bits uint64) {
+	if l.modulus%bits == 0 {
+		l.residue += (bits - l.residue%bits) % bits
+		if l.modulus != 0 {
+			l.residue %= l.modulus
+		}
+		return
+	}
+	l.modulus, l.residue = bits, 0
+}
+
+// span is the layout at the start and at the end of a field.
+type span struct {
+	start, end layout
+}
+
+func gcd(a, b uint64) uint64 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// typeSize returns the size in bits of a field type. If exact is false the
+// size is only known to be a multiple of unit bits. offset is the exact
+// current offset, if known, for expressions that refer to it.
+func (c *checker) typeSize(n ast.Node, offset *uint64) (size uint64, exact bool, unit uint64) {
+	if width, _, ok := ast.IntegerType(n); ok {
+		return uint64(width), true, 0
+	}
+	if width, _, ok := ast.FloatType(n); ok {
+		return uint64(width), true, 0
+	}
+	t, ok := n.(*ast.TypeType)
+	if !ok {
+		return 0, false, 1
+	}
+
+	// The size or count is the first argument, or the second for Array.
+	sizeIndex := 0
+	if t.TypeName == "Array" {
+		sizeIndex = 1
+	}
+	var arg *uint64
+	if len(t.Arguments) > sizeIndex {
+		if v, ok := evalConst(t.Arguments[sizeIndex], offset); ok {
+			arg = &v
+		}
+	}
+
+	switch t.TypeName {
+	case "bool":
+		return 8, true, 0
+	case "Bits", "Padding":
+		if arg != nil {
+			return *arg, true, 0
+		}
+		return 0, false, 1
+	case "Bytes", "String":
+		if arg != nil {
+			return *arg * 8, true, 0
+		}
+		return 0, false, 8
+	case "CString", "Cbytes", "LongString", "LongBytes",
+		"Bytes8le", "Bytes16le", "Bytes32le", "Bytes64le",
+		"Bytes8be", "Bytes16be", "Bytes32be", "Bytes64be",
+		"String8le", "String16le", "String32le", "String64le",
+		"String8be", "String16be", "String32be", "String64be":
+		return 0, false, 8
+	case "Array":
+		if len(t.Arguments) != 2 {
+			return 0, false, 1
+		}
+		elem, elemExact, elemUnit := c.typeSize(t.Arguments[0], nil)
+		switch {
+		case elemExact && arg != nil:
+			return elem * *arg, true, 0
+		case elemExact && elem > 0:
+			return 0, false, elem
+		case elemExact:
+			return 0, true, 0
+		default:
+			return 0, false, elemUnit
+		}
+	}
+
+	if len(t.Arguments) == 0 && len(t.TypeArguments) == 0 {
+		switch decl := c.decls[t.TypeName].(type) {
+		case *ast.PacketType:
+			if len(decl.TypeParameters) == 0 {
+				return c.packetSize(decl)
+			}
+		case *ast.EnumerationType:
+			return c.typeSize(decl.ReturnType, nil)
+		case *ast.FlagsType:
+			return c.typeSize(decl.StorageType, nil)
+		}
+	}
+	return 0, false, 1
+}
+
+// evalConst evaluates an integer expression made of literals and, if offset
+// is not nil, the current offset.
+func evalConst(n ast.Node, offset *uint64) (uint64, bool) {
+	switch n := n.(type) {
+	case *ast.NumberLiteralType:
+		return n.Value, n.High == 0
+	case *ast.BooleanLiteralType:
+		return boolValue(n.Value), true
+	case *ast.IdentifierType:
+		if n.Value == offsetName && offset != nil {
+			return *offset, true
+		}
+		return 0, false
+	case *ast.UnaryExpression:
+		v, ok := evalConst(n.Operand, offset)
+		if !ok {
+			return 0, false
+		}
+		switch n.Operator {
+		case "-":
+			return -v, true
+		case "~":
+			return ^v, true
+		case "!":
+			return boolValue(v == 0), true
+		}
+	case *ast.BinaryExpression:
+		l, ok := evalConst(n.Left, offset)
+		if !ok {
+			return 0, false
+		}
+		r, ok := evalConst(n.Right, offset)
+		if !ok {
+			return 0, false
+		}
+		switch n.Operator {
+		case "+":
+			return l + r, true
+		case "-":
+			return l - r, true
+		case "*":
+			return l * r, true
+		case "/":
+			if r == 0 {
+				return 0, false
+			}
+			return l / r, true
+		case "%":
+			if r == 0 {
+				return 0, false
+			}
+			return l % r, true
+		case "<<":
+			return l << r, true
+		case ">>":
+			return l >> r, true
+		case "&":
+			return l & r, true
+		case "|":
+			return l | r, true
+		case "^":
+			return l ^ r, true
+		case "==":
+			return boolValue(l == r), true
+		case "!=":
+			return boolValue(l != r), true
+		case "<":
+			return boolValue(l < r), true
+		case "<=":
+			return boolValue(l <= r), true
+		case ">":
+			return boolValue(l > r), true
+		case ">=":
+			return boolValue(l >= r), true
+		case "&&":
+			return boolValue(l != 0 && r != 0), true
+		case "||":
+			return boolValue(l != 0 || r != 0), true
+		}
+	case *ast.InExpression:
+		v, ok := evalConst(n.Operand, offset)
+		if !ok {
+			return 0, false
+		}
+		for _, r := range n.Ranges {
+			low, ok := evalConst(r.Low, offset)
+			if !ok {
+				return 0, false
+			}
+			high, ok := evalConst(r.High, offset)
+			if !ok {
+				return 0, false
+			}
+			if low <= v && v <= high {
+				return 1, true
+			}
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// checkExpr reports identifiers in an expression that do not name a
+// parameter, an earlier field, or the current offset.
+func (c *checker) checkExpr(p *ast.PacketType, scope map[string]bool, n ast.Node) {
+	switch n := n.(type) {
+	case *ast.IdentifierType:
+		if n.Value != offsetName && !scope[n.Value] {
+			c.errorf(n.Position, "undefined: %s is not a parameter or earlier field of %s", n.Value, p.Name)
+		}
+	case *ast.UnaryExpression:
+		c.checkExpr(p, scope, n.Operand)
+	case *ast.BinaryExpression:
+		c.checkExpr(p, scope, n.Left)
+		c.checkExpr(p, scope, n.Right)
+	case *ast.SelectorExpression:
+		c.checkExpr(p, scope, n.Operand)
+	case *ast.InExpression:
+		c.checkExpr(p, scope, n.Operand)
+		for _, r := range n.Ranges {
+			c.checkExpr(p, scope, r.Low)
+			c.checkExpr(p, scope, r.High)
+			low, lok := evalConst(r.Low, nil)
+			high, hok := evalConst(r.High, nil)
+			if lok && hok && low > high {
+				c.errorf(r.Position, "range %d..%d in %s is empty", low, high, p.Name)
+			}
+		}
+	case *ast.KeywordArgument:
+		c.checkExpr(p, scope, n.Value)
+	}
+}
+
+// checkLayout walks the fields of a packet in order, resolving the names used
+// in type arguments and reporting alignment statements that never pad.
+func (c *checker) checkLayout(p *ast.PacketType) {
+	scope := make(map[string]bool, len(p.Parameters)+len(p.Fields))
+	for i := range p.Parameters {
+		scope[p.Parameters[i].Name] = true
+	}
+	var l layout
+	c.spans = make(map[*ast.PacketField]span)
+	c.checkFields(p, scope, p.Fields, &l)
+	c.checkChecksumBoundaries(p, p.Fields)
+}
+
+// checkFields walks a list of fields, advancing l past each one. Names of
+// fields are added to scope as they are declared.
+func (c *checker) checkFields(p *ast.PacketType, scope map[string]bool, fields []ast.PacketField, l *layout) {
+	var eos *ast.PacketField
+	for i := range fields {
+		f := &fields[i]
+		if f.Name == offsetName {
+			c.errorf(f.Type.Pos(), "%s is reserved for the current bit offset", offsetName)
+		}
+
+		if align, ok := f.Type.(*ast.AlignType); ok {
+			c.checkExpr(p, scope, align.Bits)
+			bits, ok := evalConst(align.Bits, nil)
+			switch {
+			case !ok:
+				c.errorf(align.Bits.Pos(), "align requires a constant number of bits")
+			case bits == 0:
+				c.errorf(align.Bits.Pos(), "align requires a positive number of bits")
+			case l.aligned(bits):
+				c.warnf(align.Position, "align(%d) is a no-op: the offset is always a multiple of %d here", bits, bits)
+			default:
+				l.align(bits)
+			}
+			continue
+		}
+		if a, ok := f.Type.(*ast.AssertType); ok {
+			c.checkAssert(p, scope, a)
+			continue
+		}
+		if let, ok := f.Type.(*ast.LetType); ok {
+			// Computed fields take no bits.
+			c.checkExpr(p, scope, let.Value)
+			scope[f.Name] = true
+			continue
+		}
+		if f.Constraint != nil {
+			c.checkConstraint(p, scope, f)
+		}
+
+		at := atOffset(f)
+		if at != nil {
+			c.checkAt(p, scope, f, at)
+		}
+		if sized, ok := f.Type.(*ast.SizedType); ok {
+			if at != nil {
+				// Laid out on its own; the offset here does not move.
+				var skipped layout
+				c.checkSized(p, scope, f, sized, &skipped)
+				continue
+			}
+			start := *l
+			c.checkSized(p, scope, f, sized, l)
+			c.spans[f] = span{start, *l}
+			continue
+		}
+
+		if eos != nil && f.Name != "_" && at == nil {
+			c.errorf(f.Type.Pos(), "%s.%s follows %s, which reads to the end of the data", p.Name, f.Name, eos.Name)
+			eos = nil
+		}
+		c.checkTypeRef(f.Type)
+		if t, ok := f.Type.(*ast.TypeType); ok {
+			if t.TypeName == "Array" {
+				c.checkArray(p, scope, f, t)
+				if mode, _, _ := ast.ArrayRepeat(t); mode == ast.RepeatEOS && at == nil {
+					eos = f
+				}
+			} else if _, ok := c.decls[t.TypeName].(*ast.MessageType); ok && at == nil {
+				// A message reads entries to the end of the data.
+				eos = f
+			} else {
+				for j, arg := range t.Arguments {
+					if j != encodingIndex(t) {
+						c.checkExpr(p, scope, arg)
+					}
+				}
+			}
+		}
+
+		if at != nil || f.Peek {
+			if f.Name != "_" {
+				scope[f.Name] = true
+			}
+			continue
+		}
+
+		start := *l
+		l.advance(c.fieldSize(f, l))
+		c.spans[f] = span{start, *l}
+		if f.Name != "_" {
+			scope[f.Name] = true
+		}
+	}
+}
+
+// fieldSize returns the size in bits of a field read in line at l, like
+// typeSize.
+func (c *checker) fieldSize(f *ast.PacketField, l *layout) (size uint64, exact bool, unit uint64) {
+	var offset *uint64
+	if v, ok := l.exact(); ok {
+		offset = &v
+	}
+	size, exact, unit = c.typeSize(f.Type, offset)
+	if units := textUnitSize(f); units > 1 {
+		size, unit = size*units, unit*units
+	}
+	if ast.FindAnnotation(f.Annotations, "bit") != nil {
+		size, exact, unit = 1, true, 0
+	}
+	if _, versioned := fieldVersions(f); versioned {
+		// The field may be absent.
+		if exact {
+			size, exact, unit = 0, false, size
+		}
+	}
+	return size, exact, unit
+}
+
+// packetSize returns the size in bits of a packet used as a field type, like
+// typeSize. Packets that contain themselves have an unknown size.
+func (c *checker) packetSize(p *ast.PacketType) (size uint64, exact bool, unit uint64) {
+	if c.sizing[p] {
+		return 0, false, 1
+	}
+	c.sizing[p] = true
+	defer delete(c.sizing, p)
+
+	var l layout
+	c.fieldsSize(p.Fields, &l)
+	if size, ok := l.exact(); ok {
+		return size, true, 0
+	}
+	return 0, false, l.modulus
+}
+
+// fieldsSize advances l past fields, without reporting anything.
+func (c *checker) fieldsSize(fields []ast.PacketField, l *layout) {
+	for i := range fields {
+		f := &fields[i]
+		if f.Peek || atOffset(f) != nil {
+			continue
+		}
+		switch t := f.Type.(type) {
+		case *ast.AssertType, *ast.LetType:
+		case *ast.AlignType:
+			if bits, ok := evalConst(t.Bits, nil); ok && bits > 0 {
+				l.align(bits)
+			} else {
+				l.advance(0, false, 1)
+			}
+		case *ast.SizedType:
+			size, ok := evalConst(t.Size, nil)
+			_, versioned := fieldVersions(f)
+			switch {
+			case !ok:
+				l.advance(0, false, 8)
+			case versioned:
+				l.advance(0, false, size*8)
+			default:
+				l.advance(size*8, true, 0)
+			}
+		default:
+			l.advance(c.fieldSize(f, l))
+		}
+	}
+}
+
+// checkSized checks a `sized(len) { ... }` block. Its fields are laid out
+// from offset zero, and the block as a whole takes len bytes.
+func (c *checker) checkSized(p *ast.PacketType, scope map[string]bool, f *ast.PacketField, sized *ast.SizedType, l *layout) {
+	c.checkExpr(p, scope, sized.Size)
+
+	var inner layout
+	c.checkFields(p, scope, sized.Fields, &inner)
+
+	size, ok := evalConst(sized.Size, nil)
+	if !ok {
+		l.advance(0, false, 8)
+		return
+	}
+	if used, exact := inner.exact(); exact {
+		skip := false
+		if a := ast.FindAnnotation(f.Annotations, "trailing"); a != nil && len(a.Arguments) == 1 {
+			id, _ := a.Arguments[0].Value.(*ast.IdentifierType)
+			skip = id != nil && id.Value == "skip"
+		}
+		switch {
+		case used > size*8:
+			c.errorf(sized.Position, "fields of sized block take %d bits but the block is %d bytes", used, size)
+		case used < size*8 && !skip:
+			c.errorf(sized.Position, "fields of sized block take %d bits but the block is %d bytes; use @trailing(skip) to ignore the rest", used, size)
+		}
+	}
+	if _, versioned := fieldVersions(f); versioned {
+		// The block may be absent.
+		l.advance(0, false, size*8)
+		return
+	}
+	l.advance(size*8, true, 0)
+}
+
+// checkChecksumBoundaries reports checksum fields, and the ends of the
+// ranges they cover, that are not on byte boundaries. Checksums are computed
+// over whole bytes.
+func (c *checker) checkChecksumBoundaries(p *ast.PacketType, fields []ast.PacketField) {
+	for i := range fields {
+		f := &fields[i]
+		if sized, ok := f.Type.(*ast.SizedType); ok {
+			c.checkChecksumBoundaries(p, sized.Fields)
+		}
+		if f.Checksum == nil {
+			continue
+		}
+		if s, ok := c.spans[f]; ok {
+			c.checkByteBoundary(s.start, f.Type.Pos(), fmt.Sprintf("checksum %s.%s", p.Name, f.Name), "start")
+		}
+		what := fmt.Sprintf("checksum range of %s.%s", p.Name, f.Name)
+		if s, ok := c.spans[fieldNamed(p, f.Checksum.Range.Low)]; ok {
+			c.checkByteBoundary(s.start, f.Checksum.Range.Position, what, "start")
+		}
+		if s, ok := c.spans[fieldNamed(p, f.Checksum.Range.High)]; ok {
+			c.checkByteBoundary(s.end, f.Checksum.Range.Position, what, "end")
+		}
+	}
+}
+
+// checkByteBoundary reports an error if what, which starts or ends at l
+// according to verb, is never on a byte boundary, and a warning if it is not
+// always on one.
+func (c *checker) checkByteBoundary(l layout, pos token.Position, what, verb string) {
+	switch {
+	case l.aligned(8):
+	case l.modulus%8 == 0:
+		c.errorf(pos, "%s %ss at bit %d of a byte; checksums cover whole bytes", what, verb, l.residue%8)
+	default:
+		c.warnf(pos, "%s may not %s on a byte boundary; checksums cover whole bytes", what, verb)
+	}
+}
+
+// fieldNamed returns the field of p named by the identifier n, or nil.
+func fieldNamed(p *ast.PacketType, n ast.Node) *ast.PacketField {
+	id, ok := n.(*ast.IdentifierType)
+	if !ok {
+		return nil
+	}
+	for i := range p.Fields {
+		if p.Fields[i].Name == id.Value {
+			return &p.Fields[i]
+		}
+	}
+	return nil
+}
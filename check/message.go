@@ -0,0 +1,72 @@
+package check
+
+import (
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/wire"
+)
+
+// checkMessage checks a TLV declaration: the header must be an unsigned tag
+// and length, and every field needs a distinct tag that fits the tag and a
+// value that fits the length.
+func (c *checker) checkMessage(m *ast.MessageType) {
+	c.checkAnnotations(TargetMessage, m.Annotations)
+	for i := range m.Header {
+		c.checkAnnotations(TargetParameter, m.Header[i].Annotations)
+	}
+
+	if len(m.Header) != 2 {
+		c.errorf(m.Position, "message %s must declare a tag and a length, as in (tag: u8, len: u8)", m.Name)
+		return
+	}
+	tagWidth, tagSigned, tagOK := ast.IntegerType(m.Header[0].Type)
+	if !tagOK || tagSigned {
+		c.errorf(m.Header[0].Type.Pos(), "tag of message %s must be an unsigned integer", m.Name)
+	}
+	lenWidth, lenSigned, lenOK := ast.IntegerType(m.Header[1].Type)
+	if !lenOK || lenSigned || lenWidth > 64 {
+		c.errorf(m.Header[1].Type.Pos(), "length of message %s must be an unsigned integer of up to 64 bits", m.Name)
+		lenOK = false
+	}
+
+	// Field types may refer to the header, as in Bytes(len).
+	entry := &ast.PacketType{Position: m.Position, Name: m.Name, Parameters: m.Header}
+	scope := map[string]bool{m.Header[0].Name: true, m.Header[1].Name: true}
+
+	tags := make(map[wire.Uint128]string, len(m.Fields))
+	names := make(map[string]bool, len(m.Fields))
+	for i := range m.Fields {
+		f := &m.Fields[i]
+		c.checkAnnotations(TargetField, f.Annotations)
+		if names[f.Name] {
+			c.errorf(f.Position, "duplicate field %s in message %s", f.Name, m.Name)
+		}
+		names[f.Name] = true
+
+		tag := literal(f.Tag)
+		if tagOK && !tagSigned && !fits(f.Tag, tagWidth, false) {
+			c.errorf(f.Tag.Position, "tag %s of %s.%s does not fit in %s", tag, m.Name, f.Name, typeName(m.Header[0].Type))
+		}
+		if other, dup := tags[tag]; dup {
+			c.errorf(f.Tag.Position, "tag %s of %s.%s duplicates %s.%s", tag, m.Name, f.Name, m.Name, other)
+		} else {
+			tags[tag] = f.Name
+		}
+
+		c.checkTypeRef(f.Type)
+		if t, ok := f.Type.(*ast.TypeType); ok {
+			for j, arg := range t.Arguments {
+				if j != encodingIndex(t) && !(t.TypeName == "Array" && j == 0) {
+					c.checkExpr(entry, scope, arg)
+				}
+			}
+		}
+		size, exact, _ := c.typeSize(f.Type, nil)
+		switch {
+		case !exact:
+		case size%8 != 0:
+			c.errorf(f.Type.Pos(), "value of %s.%s is %d bits; values must be whole bytes", m.Name, f.Name, size)
+		case lenOK && size/8 > maxValue(lenWidth, false):
+			c.errorf(f.Type.Pos(), "value of %s.%s is %d bytes, longer than %s can hold", m.Name, f.Name, size/8, typeName(m.Header[1].Type))
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package check
+
+import (
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// checkPeek checks a `peek Type name;` field. It is read without moving the
+// offset, so it must be a fixed-size value of at most 64 bits that is not
+// also written.
+func (c *checker) checkPeek(p *ast.PacketType, f *ast.PacketField) {
+	if f.Magic != nil || f.Checksum != nil {
+		c.errorf(f.Type.Pos(), "peek field %s.%s cannot have a value; it is not written", p.Name, f.Name)
+	}
+	if a := ast.FindAnnotation(f.Annotations, "at"); a != nil {
+		c.errorf(a.Position, "@at does not apply to peek fields")
+	}
+	if !c.isScalar(f.Type) {
+		c.errorf(f.Type.Pos(), "peek field %s.%s must be an integer, Bits, bool, enum or flags", p.Name, f.Name)
+		return
+	}
+	if size, exact, _ := c.typeSize(f.Type, nil); !exact || size == 0 || size > 64 {
+		c.errorf(f.Type.Pos(), "peek field %s.%s must have a fixed size of 1 to 64 bits", p.Name, f.Name)
+	}
+}
+
+// isScalar reports whether n is read as a single integer value.
+func (c *checker) isScalar(n ast.Node) bool {
+	if _, _, ok := ast.IntegerType(n); ok {
+		return true
+	}
+	t, ok := n.(*ast.TypeType)
+	if !ok {
+		return false
+	}
+	switch t.TypeName {
+	case "Bits", "bool":
+		return true
+	}
+	switch c.decls[t.TypeName].(type) {
+	case *ast.EnumerationType, *ast.FlagsType:
+		return len(t.Arguments) == 0
+	}
+	return false
+}
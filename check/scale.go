@@ -0,0 +1,68 @@
+package check
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// constFloat evaluates a possibly negated number literal.
+func constFloat(n ast.Node) (float64, bool) {
+	switch n := n.(type) {
+	case *ast.NumberLiteralType:
+		return float64(n.High)*(1<<64) + float64(n.Value), true
+	case *ast.FloatLiteralType:
+		return n.Value, true
+	case *ast.UnaryExpression:
+		if n.Operator == "-" {
+			v, ok := constFloat(n.Operand)
+			return -v, ok
+		}
+	}
+	return 0, false
+}
+
+// numericArgument validates that the first argument is a number, which may
+// be negative or have a fractional part.
+func numericArgument(a *ast.Annotation) error {
+	if _, ok := constFloat(a.Arguments[0].Value); !ok || a.Arguments[0].Key != "" {
+		return fmt.Errorf("@%s expects a number", a.Name)
+	}
+	return nil
+}
+
+// stringArgument validates that the first argument is a non-empty string.
+func stringArgument(a *ast.Annotation) error {
+	if s, ok := a.Arguments[0].Value.(*ast.StringLiteralType); !ok || s.Value == "" || a.Arguments[0].Key != "" {
+		return fmt.Errorf("@%s expects a non-empty string", a.Name)
+	}
+	return nil
+}
+
+// checkScale checks @scale, @offset and @unit, which describe the physical
+// value raw*scale + offset of an integer field.
+func (c *checker) checkScale(p *ast.PacketType, f *ast.PacketField) {
+	var first *ast.Annotation
+	for _, name := range []string{"scale", "offset", "unit"} {
+		if a := ast.FindAnnotation(f.Annotations, name); a != nil && first == nil {
+			first = a
+		}
+	}
+	if first == nil {
+		return
+	}
+	if _, _, ok := ast.IntegerType(f.Type); !ok && !isBits(f.Type) {
+		c.errorf(first.Position, "@%s applies only to integer fields, not %s.%s", first.Name, p.Name, f.Name)
+		return
+	}
+	if a := ast.FindAnnotation(f.Annotations, "scale"); a != nil && len(a.Arguments) == 1 {
+		if v, ok := constFloat(a.Arguments[0].Value); ok && v == 0 {
+			c.errorf(a.Position, "@scale of %s.%s must not be zero", p.Name, f.Name)
+		}
+	}
+}
+
+func isBits(n ast.Node) bool {
+	t, ok := n.(*ast.TypeType)
+	return ok && t.TypeName == "Bits"
+}
@@ -0,0 +1,121 @@
+package check
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/wire"
+)
+
+// stringArity is the number of arguments string types take before the
+// optional trailing encoding argument.
+var stringArity = map[string]int{
+	"String":     1,
+	"CString":    0,
+	"LongString": 0,
+	"String8le":  0, "String16le": 0, "String32le": 0, "String64le": 0,
+	"String8be": 0, "String16be": 0, "String32be": 0, "String64be": 0,
+}
+
+// encodingIndex returns the index of the encoding argument of a string type,
+// or -1 if there is none.
+func encodingIndex(t *ast.TypeType) int {
+	arity, ok := stringArity[t.TypeName]
+	if !ok || len(t.Arguments) != arity+1 {
+		return -1
+	}
+	return arity
+}
+
+// textEncoding returns the encoding of a string type, defaulting to UTF-8.
+func textEncoding(t *ast.TypeType) wire.Encoding {
+	if i := encodingIndex(t); i >= 0 {
+		if id, ok := t.Arguments[i].(*ast.IdentifierType); ok {
+			if e, ok := wire.ParseEncoding(id.Value); ok {
+				return e
+			}
+		}
+	}
+	return wire.UTF8
+}
+
+// textUnitSize returns the number of bytes the length of a String(len) field
+// counts, which is the code unit size under @text(length = units).
+func textUnitSize(f *ast.PacketField) uint64 {
+	t, ok := f.Type.(*ast.TypeType)
+	if !ok || t.TypeName != "String" {
+		return 1
+	}
+	a := ast.FindAnnotation(f.Annotations, "text")
+	if a == nil {
+		return 1
+	}
+	for _, arg := range a.Arguments {
+		if id, ok := arg.Value.(*ast.IdentifierType); ok && arg.Key == "length" && id.Value == "units" {
+			return uint64(textEncoding(t).UnitSize())
+		}
+	}
+	return 1
+}
+
+// checkText validates the arguments of string types and the @text
+// annotation.
+func (c *checker) checkText(p *ast.PacketType, f *ast.PacketField) {
+	t, _ := f.Type.(*ast.TypeType)
+	arity, isString := 0, false
+	if t != nil {
+		arity, isString = stringArity[t.TypeName]
+	}
+
+	if a := ast.FindAnnotation(f.Annotations, "text"); a != nil {
+		if !isString {
+			c.errorf(a.Position, "@text applies only to string fields")
+		} else if t.TypeName != "String" {
+			for _, arg := range a.Arguments {
+				if arg.Key == "length" {
+					c.errorf(arg.Value.Pos(), "length applies only to String(len) fields")
+				}
+			}
+		}
+	}
+	if !isString {
+		return
+	}
+
+	switch len(t.Arguments) {
+	case arity:
+	case arity + 1:
+		id, ok := t.Arguments[arity].(*ast.IdentifierType)
+		if !ok {
+			c.errorf(t.Arguments[arity].Pos(), "expected text encoding, one of %s", strings.Join(wire.Encodings(), ", "))
+		} else if _, ok := wire.ParseEncoding(id.Value); !ok {
+			c.errorf(id.Position, "unknown text encoding %s; want one of %s", id.Value, strings.Join(wire.Encodings(), ", "))
+		}
+	default:
+		c.errorf(t.Position, "%s takes %d argument(s) and an optional encoding, got %d", t.TypeName, arity, len(t.Arguments))
+	}
+}
+
+// keywordArguments validates that every keyword argument is an identifier
+// from the allowed set for its key.
+func keywordArguments(allowed map[string][]string) func(a *ast.Annotation) error {
+	return func(a *ast.Annotation) error {
+		for _, arg := range a.Arguments {
+			values := allowed[arg.Key]
+			if id, ok := arg.Value.(*ast.IdentifierType); !ok || !contains(values, id.Value) {
+				return fmt.Errorf("@%s(%s = ...) expects one of %s", a.Name, arg.Key, strings.Join(values, ", "))
+			}
+		}
+		return nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,208 @@
+package check
+
+import (
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/wire"
+)
+
+// fieldVersions returns the versions in which a field is present according to
+// its @since and @until annotations, and whether it has either.
+func fieldVersions(f *ast.PacketField) (wire.Versions, bool) {
+	v := wire.AllVersions
+	versioned := false
+	if n, ok := versionBound(f, "since"); ok {
+		v.Since, versioned = n, true
+	}
+	if n, ok := versionBound(f, "until"); ok {
+		v.Until, versioned = n, true
+	}
+	return v, versioned
+}
+
+func versionBound(f *ast.PacketField, name string) (uint64, bool) {
+	a := ast.FindAnnotation(f.Annotations, name)
+	if a == nil || len(a.Arguments) != 1 {
+		return 0, false
+	}
+	n, ok := a.Arguments[0].Value.(*ast.NumberLiteralType)
+	if !ok || n.High != 0 {
+		return 0, false
+	}
+	return n.Value, true
+}
+
+// versionChecker holds the state of checkVersions for one packet.
+type versionChecker struct {
+	*checker
+	p *ast.PacketType
+
+	// source is the @version annotation; sourceField is set once the field
+	// it names has been seen.
+	source      *ast.Annotation
+	sourceName  string
+	sourceField bool
+	width       int
+
+	// fields maps names to the versions in which they are present.
+	fields map[string]wire.Versions
+}
+
+// checkVersions checks @since and @until on the fields of a packet. A packet
+// with versioned fields must name the parameter or field holding the version
+// with @version, and a field may only refer to fields present in all of its
+// versions.
+func (c *checker) checkVersions(p *ast.PacketType) {
+	v := &versionChecker{
+		checker: c,
+		p:       p,
+		source:  ast.FindAnnotation(p.Annotations, "version"),
+		fields:  make(map[string]wire.Versions),
+		width:   64,
+	}
+	if v.source != nil && len(v.source.Arguments) == 1 {
+		if id, ok := v.source.Arguments[0].Value.(*ast.IdentifierType); ok {
+			v.sourceName = id.Value
+		}
+	}
+	if v.sourceName != "" {
+		found := false
+		for i := range p.Parameters {
+			if p.Parameters[i].Name == v.sourceName {
+				found = true
+				v.sourceField = true
+				v.setWidth(p.Parameters[i].Type)
+			}
+		}
+		if !found && !containsField(p.Fields, v.sourceName) {
+			c.errorf(v.source.Position, "@version: %s is not a parameter or field of %s", v.sourceName, p.Name)
+			v.sourceName = ""
+		}
+	}
+	v.checkFields(p.Fields, wire.AllVersions)
+}
+
+func (v *versionChecker) setWidth(n ast.Node) {
+	width, _, ok := ast.IntegerType(n)
+	if !ok || width > 64 {
+		v.errorf(n.Pos(), "version %s of %s must be an integer of up to 64 bits", v.sourceName, v.p.Name)
+		return
+	}
+	v.width = width
+}
+
+func (v *versionChecker) checkFields(fields []ast.PacketField, parent wire.Versions) {
+	for i := range fields {
+		f := &fields[i]
+		versions, versioned := fieldVersions(f)
+		if versioned {
+			v.checkBounds(f, versions)
+		}
+		switch {
+		case versioned && versions.Empty():
+			v.errorf(f.Type.Pos(), "%s.%s is never present: @since(%d) is after @until(%d)", v.p.Name, f.Name, versions.Since, versions.Until)
+		case versioned && versions.Intersect(parent).Empty():
+			v.errorf(f.Type.Pos(), "%s.%s is never present: its block is present in %s", v.p.Name, f.Name, parent)
+		}
+		versions = versions.Intersect(parent)
+
+		for _, name := range referencedNames(f) {
+			if other, ok := v.fields[name]; ok && !other.Covers(versions) {
+				v.errorf(f.Type.Pos(), "%s.%s is present in %s but refers to %s, which is present in %s", v.p.Name, f.Name, versions, name, other)
+			}
+		}
+
+		if f.Name == v.sourceName && v.sourceName != "" {
+			if versioned || parent != wire.AllVersions {
+				v.errorf(f.Type.Pos(), "version field %s.%s must be present in all versions", v.p.Name, f.Name)
+			}
+			v.sourceField = true
+			v.setWidth(f.Type)
+		}
+		if f.Name != "_" {
+			v.fields[f.Name] = versions
+		}
+		if sized, ok := f.Type.(*ast.SizedType); ok {
+			v.checkFields(sized.Fields, versions)
+		}
+	}
+}
+
+// checkBounds checks that a field's version bounds can be compared with the
+// version, which must already have been read.
+func (v *versionChecker) checkBounds(f *ast.PacketField, versions wire.Versions) {
+	a := ast.FindAnnotation(f.Annotations, "since")
+	if a == nil {
+		a = ast.FindAnnotation(f.Annotations, "until")
+	}
+	switch {
+	case v.source == nil:
+		v.errorf(a.Position, "@%s on %s.%s requires @version on %s to name the version parameter or field", a.Name, v.p.Name, f.Name, v.p.Name)
+	case v.sourceName != "" && !v.sourceField:
+		v.errorf(a.Position, "%s.%s is versioned but precedes the version field %s", v.p.Name, f.Name, v.sourceName)
+	}
+	if v.width < 64 {
+		max := maxValue(v.width, false)
+		if versions.Since > max || versions.Until != wire.AllVersions.Until && versions.Until > max {
+			v.errorf(a.Position, "version bounds of %s.%s do not fit in the %d-bit version %s", v.p.Name, f.Name, v.width, v.sourceName)
+		}
+	}
+}
+
+// containsField reports whether fields, or a sized block among them, declares
+// a field called name.
+func containsField(fields []ast.PacketField, name string) bool {
+	for i := range fields {
+		if fields[i].Name == name {
+			return true
+		}
+		if sized, ok := fields[i].Type.(*ast.SizedType); ok && containsField(sized.Fields, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// referencedNames returns the names used in a field's type arguments,
+// constraint, checksum range, sized block length, @at offset, assert
+// condition or computed value.
+func referencedNames(f *ast.PacketField) []string {
+	var names []string
+	collect := func(n ast.Node) {
+		walkExpr(n, func(n ast.Node) {
+			if id, ok := n.(*ast.IdentifierType); ok {
+				names = append(names, id.Value)
+			}
+		})
+	}
+	switch t := f.Type.(type) {
+	case *ast.TypeType:
+		for j, arg := range t.Arguments {
+			if t.TypeName == "Array" && j == 0 || j == encodingIndex(t) {
+				continue
+			}
+			if kw, ok := arg.(*ast.KeywordArgument); ok {
+				arg = kw.Value
+			}
+			collect(arg)
+		}
+	case *ast.SizedType:
+		collect(t.Size)
+	case *ast.AlignType:
+		collect(t.Bits)
+	case *ast.AssertType:
+		collect(t.Condition)
+	case *ast.LetType:
+		collect(t.Value)
+	}
+	if f.Constraint != nil {
+		collect(f.Constraint)
+	}
+	if at := atOffset(f); at != nil {
+		collect(at)
+	}
+	if f.Checksum != nil && f.Checksum.Range != nil {
+		collect(f.Checksum.Range.Low)
+		collect(f.Checksum.Range.High)
+	}
+	return names
+}
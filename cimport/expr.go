@@ -0,0 +1,217 @@
+package cimport
+
+import (
+	"strconv"
+	"strings"
+)
+
+// binaryPrecedence follows C: higher binds tighter.
+var binaryPrecedence = map[string]int{
+	"||": 1,
+	"&&": 2,
+	"|":  3,
+	"^":  4,
+	"&":  5,
+	"==": 6, "!=": 6,
+	"<": 7, "<=": 7, ">": 7, ">=": 7,
+	"<<": 8, ">>": 8,
+	"+": 9, "-": 9,
+	"*": 10, "/": 10, "%": 10,
+}
+
+// expr evaluates an integer constant expression made of literals, enum
+// constants, object-like macros, casts and sizeof.
+func (im *importer) expr() (int64, error) {
+	cond, err := im.binary(1)
+	if err != nil || !im.is("?") {
+		return cond, err
+	}
+	im.next()
+	then, err := im.expr()
+	if err != nil {
+		return 0, err
+	}
+	if err := im.expect(":"); err != nil {
+		return 0, err
+	}
+	otherwise, err := im.expr()
+	if err != nil {
+		return 0, err
+	}
+	if cond != 0 {
+		return then, nil
+	}
+	return otherwise, nil
+}
+
+func (im *importer) binary(minPrecedence int) (int64, error) {
+	left, err := im.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := im.peek()
+		precedence, ok := binaryPrecedence[op.text]
+		if op.kind != tokPunct || !ok || precedence < minPrecedence {
+			return left, nil
+		}
+		im.next()
+		right, err := im.binary(precedence + 1)
+		if err != nil {
+			return 0, err
+		}
+		switch op.text {
+		case "||":
+			left = boolValue(left != 0 || right != 0)
+		case "&&":
+			left = boolValue(left != 0 && right != 0)
+		case "|":
+			left |= right
+		case "^":
+			left ^= right
+		case "&":
+			left &= right
+		case "==":
+			left = boolValue(left == right)
+		case "!=":
+			left = boolValue(left != right)
+		case "<":
+			left = boolValue(left < right)
+		case "<=":
+			left = boolValue(left <= right)
+		case ">":
+			left = boolValue(left > right)
+		case ">=":
+			left = boolValue(left >= right)
+		case "<<":
+			if right < 0 || right >= 64 {
+				return 0, im.errorf(op.pos, "shift count %d is out of range", right)
+			}
+			shifted := left << uint64(right)
+			if shifted>>uint64(right) != left {
+				return 0, im.errorf(op.pos, "%d << %d overflows", left, right)
+			}
+			left = shifted
+		case ">>":
+			if right < 0 || right >= 64 {
+				return 0, im.errorf(op.pos, "shift count %d is out of range", right)
+			}
+			left >>= uint64(right)
+		case "+":
+			left += right
+		case "-":
+			left -= right
+		case "*":
+			left *= right
+		case "/", "%":
+			if right == 0 {
+				return 0, im.errorf(op.pos, "division by zero")
+			}
+			if op.text == "/" {
+				left /= right
+			} else {
+				left %= right
+			}
+		}
+	}
+}
+
+func (im *importer) unary() (int64, error) {
+	t := im.peek()
+	switch {
+	case t.kind == tokPunct && (t.text == "-" || t.text == "+" || t.text == "~" || t.text == "!"):
+		im.next()
+		v, err := im.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch t.text {
+		case "-":
+			return -v, nil
+		case "~":
+			return ^v, nil
+		case "!":
+			return boolValue(v == 0), nil
+		}
+		return v, nil
+	case t.kind == tokIdent && t.text == "sizeof":
+		im.next()
+		if err := im.expect("("); err != nil {
+			return 0, err
+		}
+		typ, err := im.typeName()
+		if err != nil {
+			return 0, err
+		}
+		if typ.size < 0 {
+			return 0, im.errorf(t.pos, "sizeof of an incomplete type")
+		}
+		return typ.size, im.expect(")")
+	case t.kind == tokPunct && t.text == "(":
+		im.next()
+		if im.isTypeStart() {
+			// A cast; the value keeps its width.
+			if _, err := im.typeName(); err != nil {
+				return 0, err
+			}
+			if err := im.expect(")"); err != nil {
+				return 0, err
+			}
+			return im.unary()
+		}
+		v, err := im.expr()
+		if err != nil {
+			return 0, err
+		}
+		return v, im.expect(")")
+	case t.kind == tokNumber:
+		im.next()
+		text := strings.TrimRight(t.text, "uUlL")
+		if len(text) > 1 && text[0] == '0' && text[1] >= '0' && text[1] <= '7' {
+			text = "0o" + text[1:]
+		}
+		v, err := strconv.ParseUint(text, 0, 64)
+		if err != nil {
+			return 0, im.errorf(t.pos, "invalid integer constant %s", t.text)
+		}
+		return int64(v), nil
+	case t.kind == tokIdent:
+		im.next()
+		if v, ok := im.consts[t.text]; ok {
+			return v, nil
+		}
+		if body, ok := im.defines[t.text]; ok && !im.expanding[t.text] {
+			return im.macro(t, body)
+		}
+		return 0, im.errorf(t.pos, "%s is not an integer constant", t.text)
+	}
+	return 0, im.errorf(t.pos, "expected constant expression but got %s", t)
+}
+
+// macro evaluates the body of an object-like macro.
+func (im *importer) macro(use ctoken, body []ctoken) (int64, error) {
+	toks, pos := im.toks, im.pos
+	defer func() {
+		im.toks, im.pos = toks, pos
+		delete(im.expanding, use.text)
+	}()
+	im.expanding[use.text] = true
+	im.toks = append(append([]ctoken(nil), body...), ctoken{kind: tokEOF, pos: use.pos})
+	im.pos = 0
+
+	v, err := im.expr()
+	if err != nil {
+		return 0, err
+	}
+	if t := im.peek(); t.kind != tokEOF {
+		return 0, im.errorf(use.pos, "macro %s is not an integer constant", use.text)
+	}
+	return v, nil
+}
+
+func boolValue(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
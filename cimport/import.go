@@ -0,0 +1,896 @@
+// Package cimport converts the struct and enum declarations of a C header
+// to a protodecl schema.
+//
+// It understands a practical subset of C: structs, including packed ones
+// and bitfields, fixed-size and flexible array members, enums, typedefs,
+// stdint types and #define constants. Preprocessor conditionals are not
+// evaluated; every branch is read. Structs are laid out as a C compiler
+// would, honouring __attribute__((packed)) and #pragma pack, and the
+// padding it inserts becomes Padding fields.
+package cimport
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/parser"
+	"github.com/unsafe-risk/protodecl/token"
+)
+
+// Options configures Import.
+type Options struct {
+	// BigEndian marks multi-byte fields big-endian. By default they are
+	// little-endian and bitfields are allocated from the least significant
+	// bit, as on most embedded targets.
+	BigEndian bool
+}
+
+type importer struct {
+	opts Options
+
+	toks []ctoken
+	pos  int
+
+	tree *ast.Tree
+
+	defines   map[string][]ctoken
+	expanding map[string]bool
+	consts    map[string]int64
+	// types holds typedef names and "struct tag" and "enum tag" keys.
+	types map[string]*ctype
+	// pack is the #pragma pack stack. Zero means natural alignment.
+	pack []int64
+
+	// anonymous records the member each anonymous nested struct or enum
+	// was declared for, so that it can be named after it.
+	anonymous map[ast.Node]anonymousMember
+	// refs records the fields that refer to declarations, whose names are
+	// final only once the whole header is read.
+	refs []declRef
+}
+
+type declRef struct {
+	node *ast.TypeType
+	decl ast.Node
+}
+
+type anonymousMember struct {
+	parent ast.Node
+	member string
+}
+
+type member struct {
+	pos  token.Position
+	name string
+	typ  *ctype
+	// bits is the width of a bitfield, or -1.
+	bits int64
+}
+
+// Import converts the declarations in src, the contents of filename, to a
+// protodecl tree. Each struct becomes a packet and each enum an enum;
+// functions and variables are skipped.
+func Import(filename string, src []byte, opts Options) (*ast.Tree, error) {
+	toks, err := lex(filename, src)
+	if err != nil {
+		return nil, err
+	}
+	im := &importer{
+		opts:      opts,
+		toks:      toks,
+		tree:      &ast.Tree{FileName: filename},
+		defines:   make(map[string][]ctoken),
+		expanding: make(map[string]bool),
+		consts:    make(map[string]int64),
+		types:     make(map[string]*ctype),
+		pack:      []int64{0},
+		anonymous: make(map[ast.Node]anonymousMember),
+	}
+	for name, t := range primitives {
+		im.types[name] = t
+	}
+	if err := im.parse(); err != nil {
+		return nil, err
+	}
+	for _, n := range im.tree.Nodes {
+		im.nameAnonymous(n)
+	}
+	for _, r := range im.refs {
+		r.node.TypeName = declName(r.decl)
+	}
+	return im.tree, nil
+}
+
+func (im *importer) errorf(pos token.Position, format string, args ...interface{}) error {
+	return fmt.Errorf("%s: %s", pos, fmt.Sprintf(format, args...))
+}
+
+// peek returns the current token, first handling any preprocessor lines.
+func (im *importer) peek() ctoken {
+	for im.toks[im.pos].kind == tokDirective {
+		im.directive()
+	}
+	return im.toks[im.pos]
+}
+
+func (im *importer) next() ctoken {
+	t := im.peek()
+	if t.kind != tokEOF {
+		im.pos++
+	}
+	return t
+}
+
+// is reports whether the current token is the punctuator or identifier s.
+func (im *importer) is(s string) bool {
+	t := im.peek()
+	return (t.kind == tokPunct || t.kind == tokIdent) && t.text == s
+}
+
+func (im *importer) expect(s string) error {
+	if !im.is(s) {
+		t := im.peek()
+		return im.errorf(t.pos, "expected %q but got %s", s, t)
+	}
+	im.next()
+	return nil
+}
+
+func (im *importer) ident() (ctoken, error) {
+	t := im.next()
+	if t.kind != tokIdent {
+		return t, im.errorf(t.pos, "expected identifier but got %s", t)
+	}
+	return t, nil
+}
+
+// directive handles a preprocessor line: #define and #undef of object-like
+// macros and #pragma pack. Other directives are ignored.
+func (im *importer) directive() {
+	d := im.toks[im.pos]
+	im.pos++
+	var line []ctoken
+	for im.toks[im.pos].kind != tokEOL && im.toks[im.pos].kind != tokEOF {
+		line = append(line, im.toks[im.pos])
+		im.pos++
+	}
+	if im.toks[im.pos].kind == tokEOL {
+		im.pos++
+	}
+
+	switch d.text {
+	case "define":
+		if len(line) == 0 || line[0].kind != tokIdent {
+			return
+		}
+		name := line[0]
+		if len(line) > 1 && line[1].text == "(" && line[1].pos.Line == name.pos.Line && line[1].pos.Col == name.pos.Col+len([]rune(name.text)) {
+			// A function-like macro.
+			return
+		}
+		im.defines[name.text] = line[1:]
+	case "undef":
+		if len(line) > 0 {
+			delete(im.defines, line[0].text)
+		}
+	case "pragma":
+		if len(line) < 3 || line[0].text != "pack" || line[1].text != "(" {
+			return
+		}
+		args := line[2:]
+		top := len(im.pack) - 1
+		switch {
+		case args[0].text == ")":
+			im.pack[top] = 0
+		case args[0].text == "push":
+			im.pack = append(im.pack, im.pack[top])
+			if len(args) > 2 && args[1].text == "," {
+				im.pack[top+1] = packValue(args[2])
+			}
+		case args[0].text == "pop":
+			if top > 0 {
+				im.pack = im.pack[:top]
+			}
+		default:
+			im.pack[top] = packValue(args[0])
+		}
+	}
+}
+
+func packValue(t ctoken) int64 {
+	var n int64
+	fmt.Sscan(t.text, &n)
+	return n
+}
+
+// parse reads top-level declarations.
+func (im *importer) parse() error {
+	for {
+		t := im.peek()
+		switch {
+		case t.kind == tokEOF:
+			return nil
+		case im.is(";"), im.is("}"):
+			// A stray `}` closes an extern "C" block.
+			im.next()
+		case im.is("extern") && im.toks[im.pos+1].kind == tokString:
+			im.next()
+			im.next()
+			if im.is("{") {
+				im.next()
+			}
+		case im.is("typedef"):
+			im.next()
+			if err := im.typedef(); err != nil {
+				return err
+			}
+		case im.is("struct"), im.is("enum"), im.is("union"):
+			if _, err := im.typeSpec(nil); err != nil {
+				return err
+			}
+			if !im.is(";") {
+				// A variable of the type.
+				im.skipStatement()
+			}
+		default:
+			im.skipStatement()
+		}
+	}
+}
+
+// skipStatement skips a declaration the importer has no use for, such as a
+// function prototype or definition or a variable.
+func (im *importer) skipStatement() {
+	depth := 0
+	for {
+		t := im.next()
+		switch {
+		case t.kind == tokEOF:
+			return
+		case t.kind != tokPunct:
+		case t.text == "(" || t.text == "[" || t.text == "{":
+			depth++
+		case t.text == ")" || t.text == "]":
+			depth--
+		case t.text == "}":
+			depth--
+			if depth == 0 && !im.is(";") {
+				// The end of a function body.
+				return
+			}
+		case t.text == ";" && depth == 0:
+			return
+		}
+	}
+}
+
+// typedef reads the rest of a typedef declaration.
+func (im *importer) typedef() error {
+	base, err := im.typeSpec(nil)
+	if err != nil {
+		return err
+	}
+	for {
+		if im.is("*") || im.is("(") {
+			// Pointers and function types have no wire format.
+			im.skipStatement()
+			return nil
+		}
+		name, err := im.ident()
+		if err != nil {
+			return err
+		}
+		dims, err := im.dimensions()
+		if err != nil {
+			return err
+		}
+		t := arrayOf(base, dims)
+		if base.decl != nil && declName(base.decl) == "" && len(dims) == 0 {
+			setDeclName(base.decl, safeName(name.text))
+		}
+		im.types[name.text] = t
+		im.attributes()
+		if !im.is(",") {
+			break
+		}
+		im.next()
+	}
+	return im.expect(";")
+}
+
+// dimensions reads array dimensions. An empty dimension is -1.
+func (im *importer) dimensions() ([]int64, error) {
+	var dims []int64
+	for im.is("[") {
+		open := im.next()
+		if im.is("]") {
+			im.next()
+			dims = append(dims, -1)
+			continue
+		}
+		n, err := im.expr()
+		if err != nil {
+			return nil, err
+		}
+		if n <= 0 {
+			return nil, im.errorf(open.pos, "array length must be positive, not %d", n)
+		}
+		if err := im.expect("]"); err != nil {
+			return nil, err
+		}
+		dims = append(dims, n)
+	}
+	for i, d := range dims {
+		if d < 0 && i > 0 {
+			return nil, im.errorf(im.peek().pos, "only the first array dimension may be empty")
+		}
+	}
+	return dims, nil
+}
+
+// attributes skips GCC attributes and similar annotations and reports
+// whether any of them asks for a packed layout.
+func (im *importer) attributes() (packed bool) {
+	for {
+		t := im.peek()
+		switch {
+		case t.kind != tokIdent:
+			return packed
+		case t.text == "__packed" || t.text == "__PACKED" || t.text == "PACKED":
+			im.next()
+			packed = true
+		case t.text == "__attribute__" || t.text == "__attribute" || t.text == "__declspec" || t.text == "_Alignas" || t.text == "alignas":
+			im.next()
+			if !im.is("(") {
+				return packed
+			}
+			depth := 0
+			for {
+				t := im.next()
+				if t.kind == tokEOF {
+					return packed
+				}
+				if t.kind == tokIdent && (t.text == "packed" || t.text == "__packed__") {
+					packed = true
+				}
+				if t.text == "(" {
+					depth++
+				} else if t.text == ")" {
+					if depth--; depth == 0 {
+						break
+					}
+				}
+			}
+		default:
+			return packed
+		}
+	}
+}
+
+var qualifiers = map[string]bool{
+	"const": true, "volatile": true, "restrict": true, "__restrict": true,
+	"static": true, "register": true, "__extension__": true,
+}
+
+var builtinWords = map[string]bool{
+	"signed": true, "unsigned": true, "char": true, "short": true,
+	"int": true, "long": true, "float": true, "double": true,
+	"_Bool": true, "bool": true,
+}
+
+// isTypeStart reports whether the current token begins a type name.
+func (im *importer) isTypeStart() bool {
+	t := im.peek()
+	if t.kind != tokIdent {
+		return false
+	}
+	if qualifiers[t.text] || builtinWords[t.text] || t.text == "struct" || t.text == "enum" || t.text == "union" {
+		return true
+	}
+	_, ok := im.types[t.text]
+	return ok
+}
+
+// typeName reads a type in a cast or sizeof.
+func (im *importer) typeName() (*ctype, error) {
+	t, err := im.typeSpec(nil)
+	if err != nil {
+		return nil, err
+	}
+	if im.is("*") {
+		return nil, im.errorf(im.peek().pos, "pointers are not supported")
+	}
+	return t, nil
+}
+
+// typeSpec reads a type specifier, declaring any struct or enum it
+// defines. parent is the struct being declared, if any.
+func (im *importer) typeSpec(parent ast.Node) (*ctype, error) {
+	for qualifiers[im.peek().text] {
+		im.next()
+	}
+	im.attributes()
+	t := im.peek()
+	if t.kind != tokIdent {
+		return nil, im.errorf(t.pos, "expected type but got %s", t)
+	}
+	switch t.text {
+	case "struct":
+		return im.structSpec(parent)
+	case "enum":
+		return im.enumSpec()
+	case "union":
+		return nil, im.errorf(t.pos, "unions are not supported")
+	}
+
+	if builtinWords[t.text] {
+		var signed, unsigned bool
+		var base string
+		longs := 0
+		for builtinWords[im.peek().text] || qualifiers[im.peek().text] {
+			switch w := im.next().text; w {
+			case "signed":
+				signed = true
+			case "unsigned":
+				unsigned = true
+			case "long":
+				longs++
+			case "int":
+				if base == "" {
+					base = "int"
+				}
+			default:
+				if !qualifiers[w] {
+					base = w
+				}
+			}
+		}
+		name := base
+		switch {
+		case longs == 1 && base == "double":
+			return nil, im.errorf(t.pos, "long double is not supported")
+		case longs == 1:
+			name = "long"
+		case longs == 2:
+			name = "long long"
+		case name == "" || name == "int":
+			name = "int"
+		}
+		switch {
+		case unsigned:
+			name = "unsigned " + name
+		case signed && name == "char":
+			name = "signed char"
+		}
+		typ, ok := primitives[name]
+		if !ok {
+			return nil, im.errorf(t.pos, "unsupported type %s", name)
+		}
+		return typ, nil
+	}
+
+	im.next()
+	typ, ok := im.types[t.text]
+	if !ok {
+		return nil, im.errorf(t.pos, "unknown type %s", t.text)
+	}
+	return typ, nil
+}
+
+// structSpec reads a struct specifier and, if it has a body, declares a
+// packet for it.
+func (im *importer) structSpec(parent ast.Node) (*ctype, error) {
+	kw := im.next()
+	packed := im.attributes()
+	tag := ""
+	if t := im.peek(); t.kind == tokIdent {
+		tag = im.next().text
+		packed = im.attributes() || packed
+	}
+	typ := im.types["struct "+tag]
+	if !im.is("{") {
+		if tag == "" {
+			return nil, im.errorf(kw.pos, "expected struct tag or body")
+		}
+		if typ == nil {
+			// Declared here and defined later.
+			typ = &ctype{size: -1}
+			im.types["struct "+tag] = typ
+		}
+		return typ, nil
+	}
+	im.next()
+	if typ == nil {
+		typ = new(ctype)
+		if tag != "" {
+			im.types["struct "+tag] = typ
+		}
+	}
+	// The struct is incomplete until its closing brace, so that it cannot
+	// contain itself.
+	typ.size = -1
+
+	decl := &ast.PacketType{Position: kw.pos, Name: safeName(tag)}
+	var members []member
+	for !im.is("}") {
+		if im.peek().kind == tokEOF {
+			return nil, im.errorf(kw.pos, "unterminated struct")
+		}
+		if im.is(";") {
+			im.next()
+			continue
+		}
+		base, err := im.typeSpec(decl)
+		if err != nil {
+			return nil, err
+		}
+		for {
+			m := member{pos: im.peek().pos, typ: base, bits: -1}
+			if im.is("*") || im.is("(") {
+				return nil, im.errorf(m.pos, "pointer and function members are not supported")
+			}
+			if t := im.peek(); t.kind == tokIdent {
+				m.name = im.next().text
+			}
+			dims, err := im.dimensions()
+			if err != nil {
+				return nil, err
+			}
+			if base == typ {
+				return nil, im.errorf(m.pos, "struct %s cannot contain itself", tag)
+			}
+			m.typ = arrayOf(base, dims)
+			if im.is(":") {
+				im.next()
+				if m.bits, err = im.expr(); err != nil {
+					return nil, err
+				}
+			}
+			im.attributes()
+			if m.name == "" && m.bits < 0 {
+				return nil, im.errorf(m.pos, "anonymous struct members are not supported")
+			}
+			if base.decl != nil && declName(base.decl) == "" {
+				im.anonymous[base.decl] = anonymousMember{parent: decl, member: m.name}
+			}
+			members = append(members, m)
+			if !im.is(",") {
+				break
+			}
+			im.next()
+		}
+		if err := im.expect(";"); err != nil {
+			return nil, err
+		}
+	}
+	im.next()
+	packed = im.attributes() || packed
+
+	pack := im.pack[len(im.pack)-1]
+	if packed {
+		pack = 1
+	}
+	size, align, err := im.layout(decl, members, pack)
+	if err != nil {
+		return nil, err
+	}
+	typ.decl, typ.size, typ.align = decl, size, align
+	im.tree.Nodes = append(im.tree.Nodes, decl)
+	return typ, nil
+}
+
+// layout lays out the members of a struct as a C compiler would, with no
+// member aligned to more than pack bytes unless pack is zero, and adds the
+// fields to decl. It returns the size and alignment of the struct.
+func (im *importer) layout(decl *ast.PacketType, members []member, pack int64) (size, align int64, err error) {
+	var offset int64 // in bits
+	align = 1
+	// run holds the bitfields and padding since the last member that is
+	// not a bitfield when they are allocated from the least significant
+	// bit, so that they can be reordered once it ends.
+	var run []bitfield
+	lsb := !im.opts.BigEndian
+	limit := func(a int64) int64 {
+		if pack > 0 && a > pack {
+			return pack
+		}
+		return a
+	}
+	pad := func(to int64, pos token.Position) {
+		if to <= offset {
+			return
+		}
+		if run != nil {
+			run = append(run, bitfield{pos: pos, offset: offset, bits: to - offset})
+		} else {
+			addPadding(decl, uint64(to-offset), pos)
+		}
+		offset = to
+	}
+	flush := func(pos token.Position) {
+		if run == nil {
+			return
+		}
+		pad(roundUp(offset, 8), pos)
+		addBitfields(decl, run)
+		run = nil
+	}
+
+	for i, m := range members {
+		if !m.typ.complete() {
+			return 0, 0, im.errorf(m.pos, "%s has an incomplete struct type", m.name)
+		}
+		if m.bits >= 0 {
+			unit := m.typ.size * 8
+			switch {
+			case !m.typ.integer():
+				return 0, 0, im.errorf(m.pos, "bitfield %s must have an integer type", m.name)
+			case m.bits > unit:
+				return 0, 0, im.errorf(m.pos, "bitfield %s is wider than its type", m.name)
+			}
+			if lsb && run == nil {
+				run = []bitfield{}
+			}
+			if m.bits == 0 {
+				pad(roundUp(offset, unit), m.pos)
+				continue
+			}
+			if pack != 1 && offset/unit != (offset+m.bits-1)/unit {
+				// The bitfield would straddle a unit of its type.
+				pad(roundUp(offset, unit), m.pos)
+			}
+			if m.name == "" {
+				pad(offset+m.bits, m.pos)
+				continue
+			}
+			if run != nil {
+				run = append(run, bitfield{pos: m.pos, name: safeName(m.name), offset: offset, bits: m.bits})
+			} else {
+				decl.Fields = append(decl.Fields, ast.PacketField{Name: safeName(m.name), Type: bitsType(m.pos, m.bits)})
+			}
+			if a := limit(m.typ.align); a > align {
+				align = a
+			}
+			offset += m.bits
+			continue
+		}
+
+		flush(m.pos)
+		if m.typ.count < 0 && i != len(members)-1 {
+			return 0, 0, im.errorf(m.pos, "flexible array member %s must be the last member", m.name)
+		}
+		a := limit(m.typ.align)
+		pad(roundUp(offset, a*8), m.pos)
+		decl.Fields = append(decl.Fields, ast.PacketField{
+			Name: safeName(m.name),
+			Type: im.node(m.typ, m.pos),
+		})
+		offset += m.typ.size * 8
+		if a > align {
+			align = a
+		}
+	}
+	flush(decl.Position)
+	if n := len(members); n == 0 || members[n-1].typ.count >= 0 {
+		// A flexible array member takes the place of the trailing padding.
+		pad(roundUp(offset, align*8), decl.Position)
+	}
+	return offset / 8, align, nil
+}
+
+// bitfield is a bitfield, or padding if name is empty, at a bit offset in
+// a struct.
+type bitfield struct {
+	pos          token.Position
+	name         string
+	offset, bits int64
+}
+
+// addBitfields adds a run of bitfields, allocated from the least significant
+// bit of each byte, to decl. protodecl reads the bits of a byte from the most
+// significant, so the parts of each byte are added in reverse order. A
+// bitfield spanning bytes is split into parts name_0, name_1, ... from its
+// least significant bits, which a let field joins.
+func addBitfields(decl *ast.PacketType, run []bitfield) {
+	type part struct {
+		name        string
+		shift, bits int64
+	}
+	parts := make([][]part, len(run))
+	last := run[len(run)-1]
+	for at := run[0].offset; at < last.offset+last.bits; at += 8 {
+		for i := len(run) - 1; i >= 0; i-- {
+			b := run[i]
+			lo, hi := b.offset, b.offset+b.bits
+			if lo < at {
+				lo = at
+			}
+			if hi > at+8 {
+				hi = at + 8
+			}
+			switch {
+			case lo >= hi:
+			case b.name == "":
+				addPadding(decl, uint64(hi-lo), b.pos)
+			case hi-lo == b.bits:
+				decl.Fields = append(decl.Fields, ast.PacketField{Name: b.name, Type: bitsType(b.pos, b.bits)})
+			default:
+				name := fmt.Sprintf("%s_%d", b.name, len(parts[i]))
+				parts[i] = append(parts[i], part{name: name, shift: lo - b.offset, bits: hi - lo})
+				decl.Fields = append(decl.Fields, ast.PacketField{Name: name, Type: bitsType(b.pos, hi-lo)})
+			}
+		}
+	}
+	for i, b := range run {
+		if len(parts[i]) == 0 {
+			continue
+		}
+		var value ast.Node
+		for _, p := range parts[i] {
+			var v ast.Node = &ast.IdentifierType{Position: b.pos, Value: p.name}
+			if p.shift > 0 {
+				v = &ast.BinaryExpression{Position: b.pos, Operator: "<<", Left: v, Right: &ast.NumberLiteralType{Position: b.pos, Value: uint64(p.shift)}}
+			}
+			if value != nil {
+				v = &ast.BinaryExpression{Position: b.pos, Operator: "|", Left: value, Right: v}
+			}
+			value = v
+		}
+		decl.Fields = append(decl.Fields, ast.PacketField{Name: b.name, Type: &ast.LetType{Position: b.pos, Value: value}})
+	}
+}
+
+func bitsType(pos token.Position, n int64) *ast.TypeType {
+	return &ast.TypeType{
+		Position:  pos,
+		TypeName:  "Bits",
+		Arguments: []ast.Node{&ast.NumberLiteralType{Position: pos, Value: uint64(n)}},
+	}
+}
+
+// addPadding appends n bits of padding to decl, merging it with padding
+// just before.
+func addPadding(decl *ast.PacketType, n uint64, pos token.Position) {
+	if last := len(decl.Fields) - 1; last >= 0 && decl.Fields[last].Name == "_" {
+		if t, ok := decl.Fields[last].Type.(*ast.TypeType); ok && t.TypeName == "Padding" {
+			t.Arguments[0].(*ast.NumberLiteralType).Value += n
+			return
+		}
+	}
+	decl.Fields = append(decl.Fields, ast.PacketField{
+		Name: "_",
+		Type: &ast.TypeType{
+			Position:  pos,
+			TypeName:  "Padding",
+			Arguments: []ast.Node{&ast.NumberLiteralType{Position: pos, Value: n}},
+		},
+	})
+}
+
+// enumSpec reads an enum specifier and, if it has a body, declares an enum
+// for it. The values become constants for later expressions.
+func (im *importer) enumSpec() (*ctype, error) {
+	kw := im.next()
+	packed := im.attributes()
+	tag := ""
+	if t := im.peek(); t.kind == tokIdent {
+		tag = im.next().text
+		packed = im.attributes() || packed
+	}
+	var storage *ctype
+	if im.is(":") {
+		im.next()
+		var err error
+		if storage, err = im.typeSpec(nil); err != nil {
+			return nil, err
+		}
+		if storage.decl != nil || storage.elem != nil || !storage.integer() || storage.name == "bool" {
+			return nil, im.errorf(kw.pos, "enum %s must have an integer type", tag)
+		}
+	}
+	if !im.is("{") {
+		typ, ok := im.types["enum "+tag]
+		if !ok {
+			return nil, im.errorf(kw.pos, "undefined enum %s", tag)
+		}
+		return typ, nil
+	}
+	im.next()
+
+	decl := &ast.EnumerationType{Position: kw.pos, Name: safeName(tag)}
+	var next, max int64
+	for !im.is("}") {
+		name, err := im.ident()
+		if err != nil {
+			return nil, err
+		}
+		v := ast.EnumerationValue{Key: safeName(name.text), Implicit: true}
+		value := next
+		if im.is("=") {
+			im.next()
+			if value, err = im.expr(); err != nil {
+				return nil, err
+			}
+			v.Implicit = false
+		}
+		if value < 0 {
+			return nil, im.errorf(name.pos, "negative value %d of %s cannot be expressed in protodecl", value, name.text)
+		}
+		v.Value = &ast.NumberLiteralType{Position: name.pos, Value: uint64(value)}
+		decl.Values = append(decl.Values, v)
+		im.consts[name.text] = value
+		if value > max {
+			max = value
+		}
+		next = value + 1
+		if !im.is(",") {
+			break
+		}
+		im.next()
+	}
+	if err := im.expect("}"); err != nil {
+		return nil, err
+	}
+	packed = im.attributes() || packed
+
+	switch {
+	case storage != nil:
+	case !packed && max <= 1<<32-1:
+		storage = primitives["unsigned int"]
+	case max <= 1<<8-1:
+		storage = primitives["uint8_t"]
+	case max <= 1<<16-1:
+		storage = primitives["uint16_t"]
+	case max <= 1<<32-1:
+		storage = primitives["uint32_t"]
+	default:
+		storage = primitives["uint64_t"]
+	}
+	decl.ReturnType = &ast.TypeType{Position: kw.pos, TypeName: im.scalarName(storage)}
+	typ := &ctype{decl: decl, size: storage.size, align: storage.align}
+	if tag != "" {
+		im.types["enum "+tag] = typ
+	}
+	im.tree.Nodes = append(im.tree.Nodes, decl)
+	return typ, nil
+}
+
+func setDeclName(n ast.Node, name string) {
+	switch n := n.(type) {
+	case *ast.PacketType:
+		n.Name = name
+	case *ast.EnumerationType:
+		n.Name = name
+	}
+}
+
+// nameAnonymous names a struct or enum declared without a tag or typedef
+// after its parent struct and member, as in parent_member.
+func (im *importer) nameAnonymous(n ast.Node) string {
+	if name := declName(n); name != "" {
+		return name
+	}
+	name := "anonymous"
+	if m, ok := im.anonymous[n]; ok {
+		name = im.nameAnonymous(m.parent) + "_" + safeName(m.member)
+	}
+	setDeclName(n, name)
+	return name
+}
+
+// safeName appends an underscore to names that are protodecl keywords or
+// otherwise reserved.
+func safeName(name string) string {
+	if name == "" {
+		return ""
+	}
+	if name == "offset" || name == "last" {
+		return name + "_"
+	}
+	// The lexer needs a character after the name to end it.
+	t, err := parser.NewLexer("", []rune(name+" ")).NextToken()
+	if err != nil || t.Type != token.Identifier || t.Value != name {
+		return name + "_"
+	}
+	return name
+}
@@ -0,0 +1,77 @@
+package cimport
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/unsafe-risk/protodecl/printer"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestImportGolden(t *testing.T) {
+	tests := []struct {
+		header string
+		golden string
+		opts   Options
+	}{
+		{"bitfields.h", "bitfields.pd", Options{}},
+		{"bitfields.h", "bitfields_be.pd", Options{BigEndian: true}},
+		{"enums.h", "enums.pd", Options{}},
+		{"nested.h", "nested.pd", Options{}},
+		{"packing.h", "packing.pd", Options{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			src, err := os.ReadFile(filepath.Join("testdata", tt.header))
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree, err := Import(tt.header, src, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := printer.Print(tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("Import(%s) =\n%s\nwant\n%s", tt.header, got, want)
+			}
+		})
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"struct s { int a; struct s b; };", "struct s cannot contain itself"},
+		{"struct s { int a; struct s b[2]; };", "struct s cannot contain itself"},
+		{"struct t; struct s { struct t x; };", "x has an incomplete struct type"},
+		{"struct s { char a[1 << 64]; };", "shift count 64 is out of range"},
+		{"struct s { char a[3 << 62]; };", "3 << 62 overflows"},
+		{"struct s { char a[1 << -1]; };", "shift count -1 is out of range"},
+		{"union u { int a; };", "unions are not supported"},
+	}
+	for _, tt := range tests {
+		_, err := Import("test.h", []byte(tt.src), Options{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Import(%q) = %v, want an error containing %q", tt.src, err, tt.want)
+		}
+	}
+}
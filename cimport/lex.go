@@ -0,0 +1,172 @@
+package cimport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/unsafe-risk/protodecl/token"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokPunct
+
+	// tokDirective starts a preprocessor line; its text is the directive
+	// name. The tokens of the line follow, ended by tokEOL.
+	tokDirective
+	tokEOL
+)
+
+type ctoken struct {
+	kind tokenKind
+	text string
+	pos  token.Position
+}
+
+func (t ctoken) String() string {
+	switch t.kind {
+	case tokEOF:
+		return "end of file"
+	case tokEOL:
+		return "end of line"
+	case tokDirective:
+		return "#" + t.text
+	}
+	return strconv.Quote(t.text)
+}
+
+// punctuators lists the multi-character operators, longest first.
+var punctuators = []string{"...", "<<", ">>", "->", "&&", "||", "==", "!=", "<=", ">=", "##"}
+
+// lex splits C source into tokens. Comments and line continuations are
+// removed and character literals become numbers.
+func lex(filename string, src []byte) ([]ctoken, error) {
+	runes := []rune(strings.ReplaceAll(string(src), "\r\n", "\n"))
+
+	var toks []ctoken
+	line, col := 1, 1
+	lineStart := true
+	directive := false
+	i := 0
+	advance := func(n int) {
+		for ; n > 0; n-- {
+			if runes[i] == '\n' {
+				line, col = line+1, 1
+			} else {
+				col++
+			}
+			i++
+		}
+	}
+	for i < len(runes) {
+		c := runes[i]
+		pos := token.Position{File: filename, Line: line, Col: col}
+		switch {
+		case c == '\n':
+			if directive {
+				toks = append(toks, ctoken{kind: tokEOL, pos: pos})
+				directive = false
+			}
+			lineStart = true
+			advance(1)
+			continue
+		case unicode.IsSpace(c):
+			advance(1)
+			continue
+		case c == '\\' && i+1 < len(runes) && runes[i+1] == '\n':
+			// A line continuation.
+			advance(2)
+			continue
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '/':
+			for i < len(runes) && runes[i] != '\n' {
+				advance(1)
+			}
+			continue
+		case c == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			advance(2)
+			for i+1 < len(runes) && (runes[i] != '*' || runes[i+1] != '/') {
+				advance(1)
+			}
+			if i+1 >= len(runes) {
+				return nil, fmt.Errorf("%s: unterminated comment", pos)
+			}
+			advance(2)
+			continue
+		}
+
+		switch {
+		case c == '#' && lineStart:
+			advance(1)
+			for i < len(runes) && (runes[i] == ' ' || runes[i] == '\t') {
+				advance(1)
+			}
+			start := i
+			for i < len(runes) && isIdentRune(runes[i]) {
+				advance(1)
+			}
+			toks = append(toks, ctoken{kind: tokDirective, text: string(runes[start:i]), pos: pos})
+			directive = true
+		case c == '_' || unicode.IsLetter(c):
+			start := i
+			for i < len(runes) && isIdentRune(runes[i]) {
+				advance(1)
+			}
+			toks = append(toks, ctoken{kind: tokIdent, text: string(runes[start:i]), pos: pos})
+		case unicode.IsDigit(c):
+			start := i
+			for i < len(runes) && (isIdentRune(runes[i]) || runes[i] == '.') {
+				advance(1)
+			}
+			toks = append(toks, ctoken{kind: tokNumber, text: string(runes[start:i]), pos: pos})
+		case c == '\'' || c == '"':
+			start := i
+			advance(1)
+			for i < len(runes) && runes[i] != c && runes[i] != '\n' {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					advance(1)
+				}
+				advance(1)
+			}
+			if i >= len(runes) || runes[i] != c {
+				return nil, fmt.Errorf("%s: unterminated literal", pos)
+			}
+			advance(1)
+			literal := string(runes[start:i])
+			if c == '"' {
+				toks = append(toks, ctoken{kind: tokString, text: literal, pos: pos})
+				break
+			}
+			value, _, tail, err := strconv.UnquoteChar(literal[1:len(literal)-1], '\'')
+			if err != nil || tail != "" {
+				return nil, fmt.Errorf("%s: invalid character literal %s", pos, literal)
+			}
+			toks = append(toks, ctoken{kind: tokNumber, text: strconv.Itoa(int(value)), pos: pos})
+		default:
+			text := string(c)
+			for _, p := range punctuators {
+				if i+len(p) <= len(runes) && string(runes[i:i+len(p)]) == p {
+					text = p
+					break
+				}
+			}
+			advance(len(text))
+			toks = append(toks, ctoken{kind: tokPunct, text: text, pos: pos})
+		}
+		lineStart = false
+	}
+	if directive {
+		toks = append(toks, ctoken{kind: tokEOL, pos: token.Position{File: filename, Line: line, Col: col}})
+	}
+	return append(toks, ctoken{kind: tokEOF, pos: token.Position{File: filename, Line: line, Col: col}}), nil
+}
+
+func isIdentRune(c rune) bool {
+	return c == '_' || unicode.IsLetter(c) || unicode.IsDigit(c)
+}
@@ -0,0 +1,15 @@
+#include <stdint.h>
+
+/* Bitfields are allocated from the least significant bit of each byte. */
+typedef struct {
+    uint8_t a : 3;
+    uint8_t b : 5;
+    uint16_t x : 12;
+    uint16_t y : 4;
+    uint8_t : 2;
+    uint8_t c : 1;
+    uint8_t : 0;
+    uint32_t wide : 20;
+    uint32_t rest : 12;
+    uint16_t tail;
+} status_t;
@@ -0,0 +1,15 @@
+#define BASE 0x10
+#define SHIFTED (1 << 4)
+
+enum color { RED, GREEN = BASE, BLUE };
+
+typedef enum __attribute__((packed)) { SMALL = 1, LARGE = SHIFTED + 200 } size_e;
+
+enum wide : uint16_t { W0, W1 = 0x1234 };
+
+struct palette {
+    enum color primary;
+    size_e size;
+    enum wide w;
+    uint8_t count;
+};
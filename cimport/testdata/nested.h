@@ -0,0 +1,24 @@
+#include <stdint.h>
+
+struct node;
+
+struct header {
+    uint16_t kind;
+    struct {
+        uint8_t major;
+        uint8_t minor;
+    } version;
+    uint32_t length;
+};
+
+struct node {
+    struct header hdr;
+    int32_t values[3];
+    char name[8];
+    unsigned char raw[];
+};
+
+typedef struct list {
+    struct node first;
+    double weight;
+} list_t;
@@ -0,0 +1,27 @@
+#include <stdint.h>
+
+struct natural {
+    uint8_t a;
+    uint32_t b;
+    uint16_t c;
+    uint64_t d;
+};
+
+struct __attribute__((packed)) packed {
+    uint8_t a;
+    uint32_t b;
+    float f;
+};
+
+#pragma pack(push, 2)
+struct pack2 {
+    uint8_t a;
+    uint32_t b;
+    uint8_t c;
+};
+#pragma pack(pop)
+
+struct after_pop {
+    uint8_t a;
+    uint32_t b;
+};
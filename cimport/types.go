@@ -0,0 +1,144 @@
+package cimport
+
+import (
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/token"
+)
+
+// ctype is a C type together with its protodecl equivalent.
+type ctype struct {
+	// name is the protodecl type of a scalar.
+	name string
+	// decl is the declaration of a struct or enum type.
+	decl ast.Node
+	// elem is set for arrays, which have count elements, or -1 for a
+	// flexible array member.
+	elem  *ctype
+	count int64
+
+	// size and align are in bytes. size is -1 for a struct that has only
+	// been declared.
+	size  int64
+	align int64
+
+	// char and byte mark char and unsigned char, whose arrays become
+	// String(n) and Bytes(n).
+	char bool
+	byte bool
+}
+
+func scalar(name string, size int64) *ctype {
+	return &ctype{name: name, size: size, align: size}
+}
+
+// primitives maps C type names to protodecl types, assuming the ILP32 data
+// model of most embedded targets: int and long are 32 bits.
+var primitives = map[string]*ctype{
+	"uint8_t":  {name: "u8", size: 1, align: 1, byte: true},
+	"uint16_t": scalar("u16", 2),
+	"uint32_t": scalar("u32", 4),
+	"uint64_t": scalar("u64", 8),
+	"int8_t":   scalar("i8", 1),
+	"int16_t":  scalar("i16", 2),
+	"int32_t":  scalar("i32", 4),
+	"int64_t":  scalar("i64", 8),
+
+	"char":               {name: "u8", size: 1, align: 1, char: true},
+	"signed char":        scalar("i8", 1),
+	"unsigned char":      {name: "u8", size: 1, align: 1, byte: true},
+	"short":              scalar("i16", 2),
+	"unsigned short":     scalar("u16", 2),
+	"int":                scalar("i32", 4),
+	"unsigned int":       scalar("u32", 4),
+	"long":               scalar("i32", 4),
+	"unsigned long":      scalar("u32", 4),
+	"long long":          scalar("i64", 8),
+	"unsigned long long": scalar("u64", 8),
+	"float":              scalar("f32", 4),
+	"double":             scalar("f64", 8),
+	"_Bool":              scalar("bool", 1),
+	"bool":               scalar("bool", 1),
+}
+
+// arrayOf returns the type of an array with the given dimensions, outermost
+// first.
+func arrayOf(elem *ctype, dims []int64) *ctype {
+	t := elem
+	for i := len(dims) - 1; i >= 0; i-- {
+		size := t.size * dims[i]
+		if dims[i] < 0 {
+			size = 0
+		}
+		t = &ctype{elem: t, count: dims[i], size: size, align: t.align}
+	}
+	return t
+}
+
+// node returns the protodecl type of a field of type t.
+func (im *importer) node(t *ctype, pos token.Position) ast.Node {
+	switch {
+	case t.elem != nil:
+		var count ast.Node = &ast.NumberLiteralType{Position: pos, Value: uint64(t.count)}
+		switch {
+		case t.count < 0:
+			count = &ast.IdentifierType{Position: pos, Value: "eos"}
+		case t.elem.char:
+			return &ast.TypeType{Position: pos, TypeName: "String", Arguments: []ast.Node{count}}
+		case t.elem.byte:
+			return &ast.TypeType{Position: pos, TypeName: "Bytes", Arguments: []ast.Node{count}}
+		}
+		return &ast.TypeType{Position: pos, TypeName: "Array", Arguments: []ast.Node{im.node(t.elem, pos), count}}
+	case t.decl != nil:
+		ref := &ast.TypeType{Position: pos}
+		im.refs = append(im.refs, declRef{node: ref, decl: t.decl})
+		return ref
+	}
+	return &ast.TypeType{Position: pos, TypeName: im.scalarName(t)}
+}
+
+// scalarName returns the protodecl type of the scalar t, with the byte order
+// of the target for types wider than a byte.
+func (im *importer) scalarName(t *ctype) string {
+	if t.size <= 1 || t.name == "bool" {
+		return t.name
+	}
+	if im.opts.BigEndian {
+		return t.name + "be"
+	}
+	return t.name + "le"
+}
+
+// complete reports whether the size of t is known: it is not, or does not
+// hold, a struct that has only been declared or is still being defined.
+func (t *ctype) complete() bool {
+	if t.elem != nil {
+		return t.elem.complete()
+	}
+	return t.size >= 0
+}
+
+// integer reports whether t may be the type of a bitfield.
+func (t *ctype) integer() bool {
+	if t.decl != nil {
+		_, isEnum := t.decl.(*ast.EnumerationType)
+		return isEnum
+	}
+	return t.elem == nil && t.name != "f32" && t.name != "f64"
+}
+
+func declName(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.PacketType:
+		return n.Name
+	case *ast.EnumerationType:
+		return n.Name
+	}
+	return ""
+}
+
+func roundUp(n, multiple int64) int64 {
+	if multiple <= 1 {
+		return n
+	}
+	return (n + multiple - 1) / multiple * multiple
+}
@@ -0,0 +1,59 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// atField returns the offset expression and origin of the @at annotation of
+// m, or a nil offset if m is read in line.
+func atField(m *ast.PacketField) (offset ast.Node, from string) {
+	a := ast.FindAnnotation(m.Annotations, "at")
+	if a == nil {
+		return nil, ""
+	}
+	from = "start"
+	for _, arg := range a.Arguments {
+		if arg.Key == "" {
+			offset = arg.Value
+		} else if id, ok := arg.Value.(*ast.IdentifierType); ok && arg.Key == "from" {
+			from = id.Value
+		}
+	}
+	return offset, from
+}
+
+// decodeAt emits the reading of the @at field m through a reader from the
+// wire.Seeker, positioned at its offset. The offsets of the field start at
+// zero, and the reader of the packet keeps its position.
+func (f *fn) decodeAt(m *ast.PacketField, offset ast.Node, from string) error {
+	off, err := f.expr(offset)
+	if err != nil {
+		return err
+	}
+	code := off.arg(kindSigned)
+	if from != "start" {
+		origin := f.rw + ".DataOffset() / 8"
+		if from == "packet" {
+			f.needOrigin = true
+			origin = "origin"
+		}
+		code = origin + " + " + code
+		if off.constant && off.v == 0 {
+			code = origin
+		}
+	}
+
+	f.ats++
+	at := fmt.Sprintf("a%d", f.ats)
+	f.use(at, "*wire.BitReader")
+	f.printf("field, at = %q, %s\n", m.Name, f.at())
+	f.try("%s, err = %s.Seeker.Enter(%s, %s)", at, f.rw, f.rw, code)
+
+	if err := f.block(at, func() error { return f.decodeValue(m) }); err != nil {
+		return err
+	}
+	f.try("err = %s.Seeker.Leave(%s)", f.rw, at)
+	return nil
+}
@@ -0,0 +1,132 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// checksum is a checksum field and the fields it covers.
+type checksum struct {
+	field       *ast.PacketField
+	first, last *ast.PacketField
+	// sum is the variable holding the wire.Checksum, and pos the one
+	// holding the offset of a forward checksum.
+	sum, pos string
+	// forward is set when the field precedes the fields it covers, so
+	// that it is verified after them and patched in on encode.
+	forward bool
+}
+
+// addChecksums records the checksum fields of p.
+func (g *generator) addChecksums(p *packet) error {
+	fields := p.decl.Fields
+	index := func(n ast.Node) int {
+		if id, ok := n.(*ast.IdentifierType); ok {
+			for i := range fields {
+				if fields[i].Name == id.Value {
+					return i
+				}
+			}
+		}
+		return -1
+	}
+	for i := range fields {
+		m := &fields[i]
+		if m.Checksum == nil {
+			continue
+		}
+		first, last := index(m.Checksum.Range.Low), index(m.Checksum.Range.High)
+		if first < 0 || last < first {
+			return fmt.Errorf("%s: invalid checksum range", m.Checksum.Range.Position)
+		}
+		t, err := typeNode(m.Type)
+		if err != nil {
+			return err
+		}
+		if bits, _, _, ok := g.intType(t); !ok || bits > 64 || m.Name == "_" {
+			return fmt.Errorf("%s: checksum fields must be named integers of at most 64 bits", m.Type.Pos())
+		}
+		n := len(p.sums) + 1
+		p.sums = append(p.sums, &checksum{
+			field:   m,
+			first:   &fields[first],
+			last:    &fields[last],
+			sum:     fmt.Sprintf("sum%d", n),
+			pos:     fmt.Sprintf("pos%d", n),
+			forward: i < first,
+		})
+	}
+	return nil
+}
+
+// beginSums emits the start of the checksums covering m from m on.
+func (f *fn) beginSums(m *ast.PacketField) {
+	for _, s := range f.p.sums {
+		if s.first != m {
+			continue
+		}
+		f.use(s.sum, "wire.Checksum")
+		f.try("%s, err = wire.NewChecksum(%q)", s.sum, s.field.Checksum.Algorithm)
+		f.try("err = %s.Tap(%s)", f.rw, s.sum)
+	}
+}
+
+// endSums emits the end of the checksums covering m last. Forward checksums
+// are verified or patched in here.
+func (f *fn) endSums(m *ast.PacketField) {
+	for _, s := range f.p.sums {
+		if s.last != m {
+			continue
+		}
+		f.try("err = %s.Untap(%s)", f.rw, s.sum)
+		if !s.forward {
+			continue
+		}
+		if f.mode == modeDecode {
+			f.printf("field, at = %q, %s\n", s.field.Name, s.pos)
+			f.verifySum(s)
+			continue
+		}
+		f.printf("field = %q\n", s.field.Name)
+		dst := f.fillSum(s)
+		t, _ := typeNode(s.field.Type)
+		bits, _, le, _ := f.g.intType(t)
+		v := "uint64(" + dst + ")"
+		if le {
+			f.g.use("math/bits")
+			v = fmt.Sprintf("uint64(bits.ReverseBytes%d(%s))", bits, dst)
+		}
+		f.try("err = w.Patch(%s, %s, %d)", s.pos, v, bits)
+		f.try("err = w.Release()")
+	}
+}
+
+// sumField returns the checksum computed into m, or nil.
+func (f *fn) sumField(m *ast.PacketField) *checksum {
+	for _, s := range f.p.sums {
+		if s.field == m {
+			return s
+		}
+	}
+	return nil
+}
+
+// verifySum emits the comparison of a decoded checksum field with the
+// checksum computed over the bytes it covers.
+func (f *fn) verifySum(s *checksum) {
+	f.try("err = wire.VerifyChecksum(%q, %s, uint64(p.%s))", s.field.Checksum.Algorithm, s.sum, f.p.fields[s.field.Name].name)
+}
+
+// fillSum emits the setting of a checksum field from its computed checksum
+// and returns the field.
+func (f *fn) fillSum(s *checksum) string {
+	m := f.p.fields[s.field.Name]
+	dst := "p." + m.name
+	if m.typ == "uint64" {
+		f.printf("%s = %s.Sum()\n", dst, s.sum)
+	} else {
+		f.printf("%s = %s(%s.Sum())\n", dst, m.typ, s.sum)
+	}
+	return dst
+}
@@ -1,22 +1,180 @@
 package compile
 
 import (
+	"bytes"
+	"fmt"
+	"go/format"
 	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode"
 
 	"github.com/unsafe-risk/protodecl/ast"
 )
 
+const wirePackage = "github.com/unsafe-risk/protodecl/wire"
+
+type generator struct {
+	pkg     string
+	imports map[string]bool
+	body    bytes.Buffer
+
+	// decls maps declared type names to their declarations.
+	decls map[string]ast.Node
+	// packets holds the packets to generate by Go name, in order.
+	packets map[string]*packet
+	order   []*packet
+	// instances maps each instantiation of a generic packet, as written in
+	// the schema, to the Go name of its packet.
+	instances map[string]string
+}
+
+func (g *generator) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.body, format, args...)
+}
+
+// deprecated generates the Deprecated paragraph of the doc comment of a
+// declaration annotated @deprecated.
+func (g *generator) deprecated(indent string, list []*ast.Annotation) {
+	message, ok := ast.Deprecation(list)
+	if !ok {
+		return
+	}
+	if message == "" {
+		message = "marked @deprecated in the schema."
+	}
+	g.printf("%s// Deprecated: %s\n", indent, message)
+}
+
+func (g *generator) use(path string) {
+	g.imports[path] = true
+}
+
+func (g *generator) output() ([]byte, error) {
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by protodecl. DO NOT EDIT.\n\npackage %s\n\n", g.pkg)
+	if len(g.imports) > 0 {
+		var std, other []string
+		for path := range g.imports {
+			if strings.Contains(strings.SplitN(path, "/", 2)[0], ".") {
+				other = append(other, path)
+			} else {
+				std = append(std, path)
+			}
+		}
+		sort.Strings(std)
+		sort.Strings(other)
+		out.WriteString("import (\n")
+		for _, path := range std {
+			fmt.Fprintf(&out, "\t%q\n", path)
+		}
+		if len(std) > 0 && len(other) > 0 {
+			out.WriteString("\n")
+		}
+		for _, path := range other {
+			fmt.Fprintf(&out, "\t%q\n", path)
+		}
+		out.WriteString(")\n\n")
+	}
+	out.Write(g.body.Bytes())
+	return format.Source(out.Bytes())
+}
+
+// packageName derives a Go package name from the schema file name.
+func packageName(filename string) string {
+	base := filepath.Base(filename)
+	base = strings.TrimSuffix(base, filepath.Ext(base))
+	name := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '_'
+	}, base)
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
+
+// goType returns the Go type used to hold values of a primitive type.
+// 128-bit integers are held in the runtime's Uint128 and Int128.
+func (g *generator) goType(n ast.Node) (string, error) {
+	if bits, signed, ok := ast.IntegerType(n); ok {
+		if bits > 64 {
+			g.use(wirePackage)
+			if signed {
+				return "wire.Int128", nil
+			}
+			return "wire.Uint128", nil
+		}
+		if signed {
+			return fmt.Sprintf("int%d", bits), nil
+		}
+		return fmt.Sprintf("uint%d", bits), nil
+	}
+	if bits, _, ok := ast.FloatType(n); ok {
+		return fmt.Sprintf("float%d", bits), nil
+	}
+	if t, ok := n.(*ast.TypeType); ok {
+		if t.TypeName == "bool" {
+			return "bool", nil
+		}
+		return "", fmt.Errorf("%s: unsupported type %s", n.Pos(), t.TypeName)
+	}
+	return "", fmt.Errorf("%s: unsupported type", n.Pos())
+}
+
 func Compile(t *ast.Tree) ([]byte, error) {
+	g := &generator{
+		pkg:     packageName(t.FileName),
+		imports: make(map[string]bool),
+		decls:   make(map[string]ast.Node),
+		packets: make(map[string]*packet),
+
+		instances: make(map[string]string),
+	}
+	for _, node := range t.Nodes {
+		switch node := node.(type) {
+		case *ast.EnumerationType:
+			g.decls[node.Name] = node
+		case *ast.FlagsType:
+			g.decls[node.Name] = node
+		case *ast.PacketType:
+			g.decls[node.Name] = node
+		case *ast.MessageType:
+			g.decls[node.Name] = node
+		}
+	}
 	for i := range t.Nodes {
 		switch node := t.Nodes[i].(type) {
 		case *ast.EnumerationType:
-			for j := range node.Values {
-				_ = j
+			if err := g.genEnum(node); err != nil {
+				return nil, err
+			}
+		case *ast.FlagsType:
+			if err := g.genFlags(node); err != nil {
+				return nil, err
+			}
+		case *ast.PacketType:
+			// Generic packets are generated for each instantiation.
+			if len(node.TypeParameters) == 0 {
+				g.declarePacket(node, node.Name)
+			}
+		case *ast.MessageType:
+			if err := g.genMessage(node); err != nil {
+				return nil, err
 			}
 		default:
 			// skip
 			log.Println("Warning: unknown node type:", node)
 		}
 	}
-	return nil, nil
+	// Generating a packet may add the packets its fields refer to.
+	for i := 0; i < len(g.order); i++ {
+		if err := g.genPacket(g.order[i]); err != nil {
+			return nil, err
+		}
+	}
+	return g.output()
 }
@@ -0,0 +1,359 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// decodeFields emits the reading of fields in order.
+func (f *fn) decodeFields(fields []ast.PacketField) error {
+	for i := range fields {
+		m := &fields[i]
+		f.beginSums(m)
+		if err := f.present(m, func() error { return f.decodeField(m) }); err != nil {
+			return err
+		}
+		f.endSums(m)
+	}
+	return nil
+}
+
+func (f *fn) decodeField(m *ast.PacketField) error {
+	if offset, from := atField(m); offset != nil {
+		return f.decodeAt(m, offset, from)
+	}
+	return f.decodeValue(m)
+}
+
+// decodeValue emits the reading of m from the current reader.
+func (f *fn) decodeValue(m *ast.PacketField) error {
+	switch t := m.Type.(type) {
+	case *ast.AlignType:
+		bits, _ := constExpr(t.Bits)
+		offset, err := f.offset()
+		if err != nil {
+			return err
+		}
+		size := fmt.Sprintf("wire.AlignPadding(%s, %d)", offset, bits)
+		if pad := f.p.pads[m]; pad != nil {
+			f.readPadding(pad, size)
+			return nil
+		}
+		f.try("err = %s.ReadPadding(%s, %t)", f.rw, size, zeroPadding(m))
+		return nil
+	case *ast.AssertType:
+		f.printf("field, at = \"\", %s\n", f.at())
+		return f.assert(t)
+	case *ast.SizedType:
+		return f.decodeSized(m, t)
+	case *ast.LetType:
+		// Computed fields take no bits.
+		return nil
+	}
+
+	f.printf("field, at = %q, %s\n", m.Name, f.at())
+	if m.Magic != nil {
+		return f.decodeMagic(m)
+	}
+	if m.Peek && m.Name == "_" {
+		return nil
+	}
+	if m.Name == "_" || isPadding(m.Type) {
+		size, err := f.skipSize(m)
+		if err != nil {
+			return err
+		}
+		if pad := f.p.pads[m]; pad != nil {
+			f.checkPadWidth(m, size)
+			f.readPadding(pad, size)
+		} else if isPadding(m.Type) {
+			f.try("err = %s.ReadPadding(%s, %t)", f.rw, size, zeroPadding(m))
+		} else {
+			f.try("err = %s.Skip(%s)", f.rw, size)
+		}
+		return nil
+	}
+
+	dst := "p." + f.p.fields[m.Name].name
+	f.peek = m.Peek
+	err := f.decodeType(dst, m.Type, m)
+	f.peek = false
+	if err != nil {
+		return err
+	}
+	if m.Constraint != nil {
+		if err := f.constraint(m, dst); err != nil {
+			return err
+		}
+	}
+	if s := f.sumField(m); s != nil {
+		if s.forward {
+			f.use(s.pos, "int64")
+			f.printf("%s = at\n", s.pos)
+		} else {
+			f.verifySum(s)
+		}
+	}
+	return nil
+}
+
+// checkPadWidth emits a check that the preserved padding m, of size bits,
+// fits in the 64 bits kept for it. Constant widths are checked by the
+// checker.
+func (f *fn) checkPadWidth(m *ast.PacketField, size string) {
+	if t, ok := m.Type.(*ast.TypeType); ok && len(t.Arguments) == 1 {
+		if _, ok := constExpr(t.Arguments[0]); ok {
+			return
+		}
+	}
+	f.printf("if n := %s; n > 64 {\n", size)
+	f.fail("&wire.PaddingWidthError{Bits: n}")
+	f.printf("}\n")
+}
+
+// readPadding emits the reading of size bits of preserved padding into pad.
+func (f *fn) readPadding(pad *field, size string) {
+	f.use("u", "uint64")
+	f.try("u, err = %s.ReadBits(uint(%s))", f.rw, size)
+	if pad.typ == "uint64" {
+		f.printf("p.%s = u\n", pad.name)
+	} else {
+		f.printf("p.%s = %s(u)\n", pad.name, pad.typ)
+	}
+}
+
+// decodeMagic emits the reading of a magic field and the comparison with
+// its value.
+func (f *fn) decodeMagic(m *ast.PacketField) error {
+	b, err := f.g.magicBytes(m)
+	if err != nil {
+		return err
+	}
+	offset, err := f.offset()
+	if err != nil {
+		return err
+	}
+	f.use("o", "int64")
+	f.printf("o = %s / 8\n", offset)
+	if _, ok := m.Magic.(*ast.BooleanLiteralType); ok && boolBits(m) == 1 {
+		f.use("u", "uint64")
+		f.try("u, err = %s.ReadBits(1)", f.rw)
+		f.try("err = wire.CheckMagic(o, %s, []byte{byte(u)})", byteLiteral(b))
+		return nil
+	}
+	f.use("b", "[]byte")
+	f.try("b, err = wire.ReadBytes(%s, %d)", f.rw, len(b))
+	f.try("err = wire.CheckMagic(o, %s, b)", byteLiteral(b))
+	return nil
+}
+
+// decodeType emits the reading of a value of type n into dst. m is the field
+// being read, or nil for array elements.
+func (f *fn) decodeType(dst string, n ast.Node, m *ast.PacketField) error {
+	t, err := typeNode(n)
+	if err != nil {
+		return err
+	}
+	if bits, signed, le, ok := f.g.intType(t); ok {
+		typ, _, _, err := f.g.typeOf(t)
+		if err != nil {
+			return err
+		}
+		f.readInt(dst, typ, bits, signed, le)
+		if f.closedEnum(t) {
+			f.try("err = %s.Validate()", dst)
+		}
+		return nil
+	}
+	if s, ok := stringType(t.TypeName); ok {
+		return f.decodeString(dst, t, s, m)
+	}
+	if bits, le, ok := ast.FloatType(t); ok {
+		f.use("u", "uint64")
+		f.try("u, err = %s.ReadBits(%d)", f.rw, bits)
+		v := fmt.Sprintf("uint%d(u)", bits)
+		if le {
+			f.g.use("math/bits")
+			v = fmt.Sprintf("bits.ReverseBytes%d(%s)", bits, v)
+		}
+		f.g.use("math")
+		f.printf("%s = math.Float%dfrombits(%s)\n", dst, bits, v)
+		return nil
+	}
+	switch t.TypeName {
+	case "bool":
+		if f.peek {
+			f.use("u", "uint64")
+			f.try("u, err = %s.PeekBits(%d)", f.rw, boolBits(m))
+			f.printf("%s = u != 0\n", dst)
+			return nil
+		}
+		f.try("%s, err = %s.ReadBool(%d)", dst, f.rw, boolBits(m))
+		return nil
+	case "Bits":
+		typ, _, _, err := f.g.typeOf(t)
+		if err != nil {
+			return err
+		}
+		width, err := f.width(t)
+		if err != nil {
+			return err
+		}
+		f.use("u", "uint64")
+		f.try("u, err = %s.%s(%s)", f.rw, f.readBits(), width)
+		if typ == "uint64" {
+			f.printf("%s = u\n", dst)
+		} else {
+			f.printf("%s = %s(u)\n", dst, typ)
+		}
+		return nil
+	case "Array":
+		return f.decodeArray(dst, t)
+	}
+
+	_, _, inner, err := f.g.typeOf(t)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.g.decls[t.TypeName].(*ast.MessageType); ok {
+		f.try("err = %s.Decode(%s)", dst, f.rw)
+		return nil
+	}
+	if inner == nil {
+		return fmt.Errorf("%s: cannot decode %s", t.Position, ast.ExprString(t))
+	}
+	if err := f.setParams(dst, inner, t.Arguments); err != nil {
+		return err
+	}
+	f.try("err = %s.Decode(%s)", dst, f.rw)
+	return nil
+}
+
+// readBits returns the method reading the bits of an integer: PeekBits for
+// peek fields, which do not move the offset, and ReadBits otherwise.
+func (f *fn) readBits() string {
+	if f.peek {
+		return "PeekBits"
+	}
+	return "ReadBits"
+}
+
+// readInt emits the reading of a bits wide integer into dst of Go type typ.
+func (f *fn) readInt(dst, typ string, bits int, signed, le bool) {
+	if bits > 64 {
+		f.use("u128", "wire.Uint128")
+		f.try("u128, err = %s.ReadUint128(%t)", f.rw, le)
+		v := "u128"
+		if signed {
+			v += ".Int128()"
+		}
+		if typ != "wire.Uint128" && typ != "wire.Int128" {
+			v = typ + "(" + v + ")"
+		}
+		f.printf("%s = %s\n", dst, v)
+		return
+	}
+	f.use("u", "uint64")
+	f.try("u, err = %s.%s(%d)", f.rw, f.readBits(), bits)
+	v, vtyp := "u", "uint64"
+	if le {
+		f.g.use("math/bits")
+		v, vtyp = fmt.Sprintf("bits.ReverseBytes%d(uint%d(u))", bits, bits), fmt.Sprintf("uint%d", bits)
+	}
+	if typ != vtyp {
+		v = typ + "(" + v + ")"
+	}
+	f.printf("%s = %s\n", dst, v)
+}
+
+func (f *fn) decodeString(dst string, t *ast.TypeType, s strType, m *ast.PacketField) error {
+	replace, units := textOptions(m)
+	enc := textEncoding(t, s)
+	target := dst
+	if s.text {
+		f.use("b", "[]byte")
+		target = "b"
+	}
+	switch {
+	case s.sized:
+		n, err := f.length(t, enc.UnitSize(), units)
+		if err != nil {
+			return err
+		}
+		f.try("%s, err = wire.ReadBytes(%s, %s)", target, f.rw, n)
+	case s.terminated:
+		unit := 1
+		if s.text {
+			unit = enc.UnitSize()
+		}
+		f.try("%s, err = wire.ReadTerminated(%s, %d)", target, f.rw, unit)
+	default:
+		f.try("%s, err = wire.ReadPrefixed(%s, %d, %t)", target, f.rw, s.prefix, s.le)
+	}
+	if s.text {
+		f.try("%s, err = wire.DecodeText(b, %s, %t)", dst, encodingNames[enc], replace)
+	}
+	return nil
+}
+
+func (f *fn) decodeArray(dst string, t *ast.TypeType) error {
+	mode, expr, ok := ast.ArrayRepeat(t)
+	if !ok {
+		return fmt.Errorf("%s: invalid array %s", t.Position, ast.ExprString(t))
+	}
+	elem, err := typeNode(t.Arguments[0])
+	if err != nil {
+		return err
+	}
+	var head, tail string
+	switch mode {
+	case ast.RepeatCount:
+		count, err := f.expr(expr)
+		if err != nil {
+			return err
+		}
+		if f.isByte(elem) {
+			f.try("%s, err = wire.ReadBytes(%s, %s)", dst, f.rw, count.arg(kindUnsigned))
+			return nil
+		}
+		head = fmt.Sprintf("wire.ReadCount(%s, ", count.arg(kindUnsigned))
+	case ast.RepeatUntil:
+		head = "wire.ReadUntil("
+		cond, err := f.until(elem, expr)
+		if err != nil {
+			return err
+		}
+		tail = ", " + cond
+	case ast.RepeatWhile:
+		cond, err := f.expr(expr)
+		if err != nil {
+			return err
+		}
+		head = fmt.Sprintf("wire.ReadWhile(func() bool {\nreturn %s\n}, ", cond.as(kindBool))
+	case ast.RepeatEOS:
+		head = fmt.Sprintf("wire.ReadToEnd(%s, ", f.rw)
+	}
+	typ, _, _, err := f.g.typeOf(elem)
+	if err != nil {
+		return err
+	}
+	e, outer := f.enter()
+	f.printf("if %s, err = %sfunc() (%s, error) {\nvar %s %s\n", dst, head, typ, e, typ)
+	if err := f.decodeType(e, elem, nil); err != nil {
+		return err
+	}
+	f.printf("return %s, nil\n}%s); err != nil {\nreturn %serr\n}\n", e, tail, outer)
+	f.leave(outer)
+	return nil
+}
+
+// until returns the function literal reporting whether the element of type
+// elem just read, called last, ends an `Array(T, until = cond)`.
+func (f *fn) until(elem *ast.TypeType, cond ast.Node) (string, error) {
+	v, last, err := f.lastCond(elem, cond)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("func(last %s) bool {\nreturn %s\n}", last.typ, v.as(kindBool)), nil
+}
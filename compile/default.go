@@ -0,0 +1,189 @@
+package compile
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// genNew generates New<Packet>, which returns a packet with the defaults of
+// its parameters and fields, including those of the packets it holds. It is
+// only generated for packets with defaults.
+func (g *generator) genNew(p *packet) error {
+	if !g.hasDefaults(p) {
+		return nil
+	}
+	values := make(map[*field]string)
+	var defaults func(fields []ast.PacketField) error
+	defaults = func(fields []ast.PacketField) error {
+		for i := range fields {
+			m := &fields[i]
+			if t, ok := m.Type.(*ast.SizedType); ok {
+				if err := defaults(t.Fields); err != nil {
+					return err
+				}
+				continue
+			}
+			dst := p.fields[m.Name]
+			if m.Default == nil || dst == nil || dst.magic != nil || dst.let != nil {
+				continue
+			}
+			code, err := g.defaultValue(p, dst, m.Default)
+			if err != nil {
+				return err
+			}
+			values[dst] = code
+		}
+		return nil
+	}
+	if err := defaults(p.decl.Parameters); err != nil {
+		return err
+	}
+	if err := defaults(p.decl.Fields); err != nil {
+		return err
+	}
+
+	g.printf("// New%s returns a %s with the default values of its fields.\n", p.name, p.name)
+	g.printf("func New%s() *%s {\n", p.name, p.name)
+	g.printf("return &%s{\n", p.name)
+	for _, m := range p.members {
+		if code, ok := values[m]; ok {
+			g.printf("%s: %s,\n", m.name, code)
+		} else if m.packet != nil && g.hasDefaults(m.packet) {
+			g.printf("%s: *New%s(),\n", m.name, m.packet.name)
+		}
+	}
+	g.printf("}\n}\n\n")
+	return nil
+}
+
+// hasDefaults reports whether New<Packet> is generated for p.
+func (g *generator) hasDefaults(p *packet) bool {
+	if err := g.fill(p); err != nil {
+		// The error is reported when p is generated.
+		return false
+	}
+	var has func(fields []ast.PacketField) bool
+	has = func(fields []ast.PacketField) bool {
+		for i := range fields {
+			switch t := fields[i].Type.(type) {
+			case *ast.SizedType:
+				if has(t.Fields) {
+					return true
+				}
+				continue
+			case *ast.LetType:
+				continue
+			}
+			if fields[i].Default != nil {
+				return true
+			}
+			if m := p.fields[fields[i].Name]; m != nil && m.packet != nil && m.packet != p && g.hasDefaults(m.packet) {
+				return true
+			}
+		}
+		return false
+	}
+	return has(p.decl.Parameters) || has(p.decl.Fields)
+}
+
+// defaultValue returns the Go code of the default value n of the field m of
+// p.
+func (g *generator) defaultValue(p *packet, m *field, n ast.Node) (string, error) {
+	t, err := typeNode(m.decl.Type)
+	if err != nil {
+		return "", err
+	}
+	switch decl := g.decls[t.TypeName].(type) {
+	case *ast.EnumerationType:
+		if id, ok := n.(*ast.IdentifierType); ok {
+			return decl.Name + id.Value, nil
+		}
+	case *ast.FlagsType:
+		names := []ast.Node{n}
+		if a, ok := n.(*ast.ArrayLiteralType); ok {
+			names = a.Elements
+		}
+		code := ""
+		for _, e := range names {
+			id, ok := e.(*ast.IdentifierType)
+			if !ok {
+				return "", fmt.Errorf("%s: the default of %s must name flags", n.Pos(), m.decl.Name)
+			}
+			if code != "" {
+				code += " | "
+			}
+			code += decl.Name + id.Value
+		}
+		if code == "" {
+			return "0", nil
+		}
+		return code, nil
+	}
+	switch m.typ {
+	case "wire.Uint128", "wire.Int128":
+		hi, lo, ok := int128Const(n)
+		if !ok {
+			return "", fmt.Errorf("%s: the default of %s must be a number", n.Pos(), m.decl.Name)
+		}
+		if m.typ == "wire.Int128" {
+			return fmt.Sprintf("wire.Int128{Hi: %d, Lo: %#x}", int64(hi), lo), nil
+		}
+		return fmt.Sprintf("wire.Uint128{Hi: %#x, Lo: %#x}", hi, lo), nil
+	case "float32", "float64":
+		v, ok := floatExpr(n)
+		if !ok {
+			return "", fmt.Errorf("%s: the default of %s must be a number", n.Pos(), m.decl.Name)
+		}
+		return floatLiteral(v), nil
+	case "string":
+		if s, ok := n.(*ast.StringLiteralType); ok {
+			return strconv.Quote(s.Value), nil
+		}
+	case "[]byte":
+		switch n := n.(type) {
+		case *ast.StringLiteralType:
+			return "[]byte(" + strconv.Quote(n.Value) + ")", nil
+		case *ast.ArrayLiteralType:
+			b := make([]byte, len(n.Elements))
+			for i, e := range n.Elements {
+				v, ok := constExpr(e)
+				if !ok {
+					return "", fmt.Errorf("%s: default bytes must be numbers", e.Pos())
+				}
+				b[i] = byte(v)
+			}
+			return byteLiteral(b), nil
+		}
+	}
+	if m.kind != kindNone {
+		v, err := g.newFn(p, modeValidate).expr(n)
+		if err != nil {
+			return "", err
+		}
+		if v.constant {
+			return v.arg(m.kind), nil
+		}
+	}
+	return "", fmt.Errorf("%s: unsupported default %s for %s", n.Pos(), ast.ExprString(n), m.decl.Name)
+}
+
+// int128Const evaluates a possibly negated 128-bit number literal as its
+// two's complement halves.
+func int128Const(n ast.Node) (hi, lo uint64, ok bool) {
+	switch n := n.(type) {
+	case *ast.NumberLiteralType:
+		return n.High, n.Value, true
+	case *ast.UnaryExpression:
+		if n.Operator != "-" {
+			break
+		}
+		hi, lo, ok := int128Const(n.Operand)
+		if lo == 0 {
+			return -hi, 0, ok
+		}
+		return ^hi, -lo, ok
+	}
+	return 0, 0, false
+}
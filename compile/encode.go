@@ -0,0 +1,296 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// encodeFields emits the writing of fields in order.
+func (f *fn) encodeFields(fields []ast.PacketField) error {
+	for i := range fields {
+		m := &fields[i]
+		f.beginSums(m)
+		if err := f.present(m, func() error { return f.encodeField(m) }); err != nil {
+			return err
+		}
+		f.endSums(m)
+	}
+	return nil
+}
+
+func (f *fn) encodeField(m *ast.PacketField) error {
+	if offset, _ := atField(m); offset != nil {
+		// The data of an @at field lies outside the packet; it is written
+		// by whoever lays out the rest of the data.
+		return nil
+	}
+	switch t := m.Type.(type) {
+	case *ast.AlignType:
+		bits, _ := constExpr(t.Bits)
+		offset, err := f.offset()
+		if err != nil {
+			return err
+		}
+		size := fmt.Sprintf("wire.AlignPadding(%s, %d)", offset, bits)
+		if pad := f.p.pads[m]; pad != nil {
+			f.try("err = %s.WriteUint(uint64(p.%s), uint(%s))", f.rw, pad.name, size)
+			return nil
+		}
+		f.try("err = %s.Zero(%s)", f.rw, size)
+		return nil
+	case *ast.AssertType:
+		f.printf("field = \"\"\n")
+		return f.assert(t)
+	case *ast.SizedType:
+		return f.encodeSized(m, t)
+	case *ast.LetType:
+		// Computed fields take no bits.
+		return nil
+	}
+
+	if m.Peek {
+		// The bits of a peek field are written by the fields after it.
+		return nil
+	}
+	if s := f.p.lengths[m]; s != nil {
+		if err := f.fillLength(s); err != nil {
+			return err
+		}
+	} else {
+		f.printf("field = %q\n", m.Name)
+	}
+	if m.Magic != nil {
+		b, err := f.g.magicBytes(m)
+		if err != nil {
+			return err
+		}
+		if _, ok := m.Magic.(*ast.BooleanLiteralType); ok && boolBits(m) == 1 {
+			f.try("err = %s.WriteBits(%d, 1)", f.rw, b[0])
+			return nil
+		}
+		f.try("_, err = %s.Write(%s)", f.rw, byteLiteral(b))
+		return nil
+	}
+	if m.Name == "_" || isPadding(m.Type) {
+		size, err := f.skipSize(m)
+		if err != nil {
+			return err
+		}
+		if pad := f.p.pads[m]; pad != nil {
+			f.checkPadWidth(m, size)
+			f.try("err = %s.WriteUint(uint64(p.%s), uint(%s))", f.rw, pad.name, size)
+			return nil
+		}
+		f.try("err = %s.Zero(%s)", f.rw, size)
+		return nil
+	}
+
+	src := "p." + f.p.fields[m.Name].name
+	if s := f.sumField(m); s != nil {
+		if s.forward {
+			f.printf("w.Hold()\n")
+			f.use(s.pos, "int64")
+			f.printf("%s = w.Offset()\n", s.pos)
+		} else {
+			f.fillSum(s)
+		}
+	}
+	if m.Constraint != nil {
+		if err := f.constraint(m, src); err != nil {
+			return err
+		}
+	}
+	return f.encodeType(src, m.Type, m)
+}
+
+// encodeType emits the writing of src, a value of type n. m is the field
+// being written, or nil for array elements.
+func (f *fn) encodeType(src string, n ast.Node, m *ast.PacketField) error {
+	t, err := typeNode(n)
+	if err != nil {
+		return err
+	}
+	if bits, signed, le, ok := f.g.intType(t); ok {
+		_, declared := f.g.decls[t.TypeName]
+		if f.closedEnum(t) {
+			f.try("err = %s.Validate()", src)
+		}
+		f.writeInt(src, declared, bits, signed, le)
+		return nil
+	}
+	if s, ok := stringType(t.TypeName); ok {
+		return f.encodeString(src, t, s, m)
+	}
+	if bits, le, ok := ast.FloatType(t); ok {
+		f.g.use("math")
+		v := fmt.Sprintf("math.Float%dbits(%s)", bits, src)
+		if le {
+			f.g.use("math/bits")
+			v = fmt.Sprintf("bits.ReverseBytes%d(%s)", bits, v)
+		}
+		f.try("err = %s.WriteBits(uint64(%s), %d)", f.rw, v, bits)
+		return nil
+	}
+	switch t.TypeName {
+	case "bool":
+		f.try("err = %s.WriteBool(%s, %d)", f.rw, src, boolBits(m))
+		return nil
+	case "Bits":
+		width, err := f.width(t)
+		if err != nil {
+			return err
+		}
+		f.try("err = %s.WriteUint(uint64(%s), %s)", f.rw, src, width)
+		return nil
+	case "Array":
+		return f.encodeArray(src, t, m)
+	}
+
+	_, _, inner, err := f.g.typeOf(t)
+	if err != nil {
+		return err
+	}
+	if _, ok := f.g.decls[t.TypeName].(*ast.MessageType); ok {
+		f.try("err = %s.Encode(%s)", src, f.rw)
+		return nil
+	}
+	if inner == nil {
+		return fmt.Errorf("%s: cannot encode %s", t.Position, ast.ExprString(t))
+	}
+	if err := f.setParams(src, inner, t.Arguments); err != nil {
+		return err
+	}
+	f.try("err = %s.Encode(%s)", src, f.rw)
+	return nil
+}
+
+// writeInt emits the writing of src as a bits wide integer. declared is set
+// for enums and flags, whose values are converted to their storage first.
+func (f *fn) writeInt(src string, declared bool, bits int, signed, le bool) {
+	if bits > 64 {
+		v := src
+		switch {
+		case declared && signed:
+			v = "wire.Int128(" + v + ")"
+		case declared:
+			v = "wire.Uint128(" + v + ")"
+		}
+		if signed {
+			v += ".Uint128()"
+		}
+		f.try("err = %s.WriteUint128(%s, %t)", f.rw, v, le)
+		return
+	}
+	v := "uint64(" + src + ")"
+	if le {
+		f.g.use("math/bits")
+		v = fmt.Sprintf("uint64(bits.ReverseBytes%d(uint%d(%s)))", bits, bits, src)
+	}
+	f.try("err = %s.WriteBits(%s, %d)", f.rw, v, bits)
+}
+
+func (f *fn) encodeString(src string, t *ast.TypeType, s strType, m *ast.PacketField) error {
+	replace, units := textOptions(m)
+	enc := textEncoding(t, s)
+	data := src
+	if s.text {
+		f.use("b", "[]byte")
+		f.try("b, err = wire.EncodeText(%s, %s, %t)", src, encodingNames[enc], replace)
+		data = "b"
+	}
+	switch {
+	case s.sized:
+		n, err := f.length(t, enc.UnitSize(), units)
+		if err != nil {
+			return err
+		}
+		f.try("err = wire.WriteBytes(%s, %s, %s)", f.rw, data, n)
+	case s.terminated:
+		unit := 1
+		if s.text {
+			unit = enc.UnitSize()
+		}
+		f.try("err = wire.WriteTerminated(%s, %s, %d)", f.rw, data, unit)
+	default:
+		f.try("err = wire.WritePrefixed(%s, %s, %d, %t)", f.rw, data, s.prefix, s.le)
+	}
+	return nil
+}
+
+func (f *fn) encodeArray(src string, t *ast.TypeType, m *ast.PacketField) error {
+	mode, expr, ok := ast.ArrayRepeat(t)
+	if !ok {
+		return fmt.Errorf("%s: invalid array %s", t.Position, ast.ExprString(t))
+	}
+	elem, err := typeNode(t.Arguments[0])
+	if err != nil {
+		return err
+	}
+	path := f.p.name
+	if m != nil {
+		path += "." + m.Name
+	}
+	fail := fmt.Sprintf("&wire.ConstraintError{Path: %q, Value: %s, Condition: %q}", path, src, ast.ExprString(t.Arguments[1]))
+
+	var cond value
+	switch mode {
+	case ast.RepeatCount:
+		v, err := f.expr(expr)
+		if err != nil {
+			return err
+		}
+		count := v.arg(kindUnsigned)
+		f.printf("if n := uint64(len(%s)); n != %s {\n", src, count)
+		f.fail("&wire.LengthError{Length: n, Want: " + count + "}")
+		f.printf("}\n")
+		if f.isByte(elem) {
+			f.try("_, err = %s.Write(%s)", f.rw, src)
+			return nil
+		}
+	case ast.RepeatUntil:
+		// The decoder stops at the first element the condition holds
+		// for, which must be the last one.
+		v, last, err := f.lastCond(elem, expr)
+		if err != nil {
+			return err
+		}
+		if last.used {
+			f.printf("for i, last := range %s {\n", src)
+		} else {
+			f.printf("for i := range %s {\n", src)
+		}
+		f.printf("if %s != (i == len(%s)-1) {\n", v.as(kindBool), src)
+		f.fail(fail)
+		f.printf("}\n}\n")
+		f.printf("if len(%s) == 0 {\n", src)
+		f.fail(fail)
+		f.printf("}\n")
+	case ast.RepeatWhile:
+		// The condition must hold before each element and fail after the
+		// last one, as the decoder checks it.
+		if cond, err = f.expr(expr); err != nil {
+			return err
+		}
+	}
+
+	f.depth++
+	i := fmt.Sprintf("i%d", f.depth)
+	f.printf("for %s := range %s {\n", i, src)
+	if mode == ast.RepeatWhile {
+		f.printf("if !%s {\n", cond.as(kindBool))
+		f.fail(fail)
+		f.printf("}\n")
+	}
+	if err := f.encodeType(src+"["+i+"]", elem, nil); err != nil {
+		return err
+	}
+	f.printf("}\n")
+	f.depth--
+	if mode == ast.RepeatWhile {
+		f.printf("if %s {\n", cond.as(kindBool))
+		f.fail(fail)
+		f.printf("}\n")
+	}
+	return nil
+}
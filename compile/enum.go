@@ -0,0 +1,89 @@
+package compile
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+func (g *generator) genEnum(e *ast.EnumerationType) error {
+	typ, err := g.goType(e.ReturnType)
+	if err != nil {
+		return err
+	}
+	bits, signed, _ := ast.IntegerType(e.ReturnType)
+	wide := bits > 64
+
+	g.deprecated("", e.Annotations)
+	g.printf("type %s %s\n\n", e.Name, typ)
+	// 128-bit values are structs, which cannot be constants.
+	if wide {
+		g.printf("var (\n")
+	} else {
+		g.printf("const (\n")
+	}
+	for _, v := range e.Values {
+		n, ok := v.Value.(*ast.NumberLiteralType)
+		if !ok {
+			return fmt.Errorf("%s: value of %s.%s must be a number", v.Value.Pos(), e.Name, v.Key)
+		}
+		g.deprecated("\t", v.Annotations)
+		switch {
+		case wide && signed:
+			g.printf("\t%s%s = %s{Hi: %d, Lo: %#x}\n", e.Name, v.Key, e.Name, int64(n.High), n.Value)
+		case wide:
+			g.printf("\t%s%s = %s{Hi: %#x, Lo: %#x}\n", e.Name, v.Key, e.Name, n.High, n.Value)
+		default:
+			g.printf("\t%s%s %s = %d\n", e.Name, v.Key, e.Name, n.Value)
+		}
+	}
+	g.printf(")\n\n")
+
+	g.printf("// IsKnown reports whether e is a declared case of %s.\n", e.Name)
+	g.printf("func (e %s) IsKnown() bool {\n", e.Name)
+	if len(e.Values) > 0 {
+		cases := make([]string, len(e.Values))
+		for i, v := range e.Values {
+			cases[i] = e.Name + v.Key
+		}
+		g.printf("\tswitch e {\n\tcase %s:\n\t\treturn true\n\t}\n", strings.Join(cases, ", "))
+	}
+	g.printf("\treturn false\n}\n\n")
+
+	g.use(wirePackage)
+	if e.IsOpen() {
+		g.printf("// Validate always succeeds; %s is open and keeps unknown values.\n", e.Name)
+		g.printf("func (e %s) Validate() error {\n\treturn nil\n}\n\n", e.Name)
+	} else {
+		g.printf("// Validate returns a *wire.UnknownEnumError if e is not a declared case.\n")
+		g.printf("func (e %s) Validate() error {\n", e.Name)
+		g.printf("\tif !e.IsKnown() {\n")
+		if wide {
+			g.printf("\t\treturn &wire.UnknownEnumError{Enum: %q, Value: e.Lo, High: uint64(e.Hi)}\n", e.Name)
+		} else {
+			g.printf("\t\treturn &wire.UnknownEnumError{Enum: %q, Value: uint64(e)}\n", e.Name)
+		}
+		g.printf("\t}\n\treturn nil\n}\n\n")
+	}
+
+	g.printf("func (e %s) String() string {\n", e.Name)
+	g.printf("\tswitch e {\n")
+	for _, v := range e.Values {
+		g.printf("\tcase %s%s:\n\t\treturn %q\n", e.Name, v.Key, v.Key)
+	}
+	g.printf("\t}\n")
+	if !wide {
+		g.use("strconv")
+	}
+	switch {
+	case wide:
+		g.printf("\treturn %q + %s(e).String() + \")\"\n", e.Name+"(", typ)
+	case signed:
+		g.printf("\treturn %q + strconv.FormatInt(int64(e), 10) + \")\"\n", e.Name+"(")
+	default:
+		g.printf("\treturn %q + strconv.FormatUint(uint64(e), 10) + \")\"\n", e.Name+"(")
+	}
+	g.printf("}\n\n")
+	return nil
+}
@@ -0,0 +1,402 @@
+package compile
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/token"
+)
+
+// kind is how a value takes part in generated expressions. Integers are
+// widened to uint64 or int64, and an operation on a signed operand is
+// signed.
+type kind int
+
+const (
+	kindNone kind = iota
+	kindUnsigned
+	kindSigned
+	kindBool
+)
+
+func (k kind) goType() string {
+	switch k {
+	case kindUnsigned:
+		return "uint64"
+	case kindSigned:
+		return "int64"
+	case kindBool:
+		return "bool"
+	}
+	return ""
+}
+
+// errNoOffset is returned for expressions that use the offset where it is
+// not known, as in Validate.
+var errNoOffset = errors.New("offset is only known while decoding or encoding")
+
+// value is a compiled expression. Constant subexpressions are folded, so
+// that the generated code never contains a constant Go would reject, such
+// as an overflowing shift.
+type value struct {
+	code     string
+	kind     kind
+	constant bool
+	v        uint64 // two's complement for signed constants
+
+	// narrow is the code of a field value in its own Go type, typ,
+	// before it is widened to kind.
+	narrow, typ string
+}
+
+func constant(v uint64, k kind) value {
+	return value{kind: k, constant: true, v: v}
+}
+
+// as converts the value to kind k and returns its code.
+func (v value) as(k kind) string {
+	if v.constant {
+		switch k {
+		case kindBool:
+			return strconv.FormatBool(v.v != 0)
+		case kindSigned:
+			return fmt.Sprintf("int64(%d)", int64(v.v))
+		default:
+			return fmt.Sprintf("uint64(%d)", v.v)
+		}
+	}
+	switch {
+	case v.kind == k:
+		return v.code
+	case k == kindBool:
+		return "(" + v.code + " != 0)"
+	case v.kind == kindBool && k == kindUnsigned:
+		return "wire.Bool(" + v.code + ")"
+	case v.kind == kindBool:
+		return "int64(wire.Bool(" + v.code + "))"
+	default:
+		return k.goType() + "(" + v.code + ")"
+	}
+}
+
+// arg returns the code of the value as an argument of Go type k. Constants
+// are written as untyped literals.
+func (v value) arg(k kind) string {
+	switch {
+	case !v.constant || k == kindBool:
+		return v.as(k)
+	case k == kindSigned:
+		return strconv.FormatInt(int64(v.v), 10)
+	}
+	return strconv.FormatUint(v.v, 10)
+}
+
+// numeric returns the kind arithmetic on operands of kinds a and b uses.
+func numeric(a, b kind) kind {
+	if a == kindSigned || b == kindSigned {
+		return kindSigned
+	}
+	return kindUnsigned
+}
+
+// expr compiles a schema expression.
+func (f *fn) expr(n ast.Node) (value, error) {
+	switch n := n.(type) {
+	case *ast.NumberLiteralType:
+		if n.High != 0 {
+			return value{}, fmt.Errorf("%s: 128-bit constants are not supported in expressions", n.Position)
+		}
+		return constant(n.Value, kindUnsigned), nil
+	case *ast.BooleanLiteralType:
+		if n.Value {
+			return constant(1, kindBool), nil
+		}
+		return constant(0, kindBool), nil
+	case *ast.IdentifierType:
+		return f.ident(n)
+	case *ast.SelectorExpression:
+		return f.selector(n)
+	case *ast.UnaryExpression:
+		return f.unary(n)
+	case *ast.BinaryExpression:
+		return f.binary(n)
+	case *ast.InExpression:
+		return f.in(n)
+	}
+	return value{}, fmt.Errorf("%s: unsupported expression %s", n.Pos(), ast.ExprString(n))
+}
+
+func (f *fn) ident(n *ast.IdentifierType) (value, error) {
+	if n.Value == "offset" {
+		offset, err := f.offset()
+		if err != nil {
+			return value{}, err
+		}
+		return value{code: "uint64(" + offset + ")", kind: kindUnsigned}, nil
+	}
+	if f.last != nil && n.Value == "last" {
+		return f.last.value(n)
+	}
+	m, ok := f.p.fields[n.Value]
+	if !ok {
+		return value{}, fmt.Errorf("%s: undefined: %s", n.Position, n.Value)
+	}
+	return m.value(n.Position, "p")
+}
+
+// selector compiles `x.field`, where x names a packet value.
+func (f *fn) selector(n *ast.SelectorExpression) (value, error) {
+	code, p, err := f.object(n.Operand)
+	if err != nil {
+		return value{}, err
+	}
+	m, ok := p.fields[n.Field]
+	if !ok {
+		return value{}, fmt.Errorf("%s: %s has no field %s", n.Position, p.decl.Name, n.Field)
+	}
+	return m.value(n.Position, code)
+}
+
+// object resolves the operand of a selector to the code of a packet value
+// and its packet.
+func (f *fn) object(n ast.Node) (string, *packet, error) {
+	switch n := n.(type) {
+	case *ast.IdentifierType:
+		if f.last != nil && n.Value == "last" {
+			if f.last.packet == nil {
+				return "", nil, fmt.Errorf("%s: last is not a packet", n.Position)
+			}
+			f.last.used = true
+			return f.last.name, f.last.packet, nil
+		}
+		m, ok := f.p.fields[n.Value]
+		if !ok || m.packet == nil || m.let != nil {
+			return "", nil, fmt.Errorf("%s: %s is not a packet field", n.Position, n.Value)
+		}
+		return "p." + m.name, m.packet, f.g.fill(m.packet)
+	case *ast.SelectorExpression:
+		code, p, err := f.object(n.Operand)
+		if err != nil {
+			return "", nil, err
+		}
+		m, ok := p.fields[n.Field]
+		if !ok || m.packet == nil || m.let != nil {
+			return "", nil, fmt.Errorf("%s: %s is not a packet field of %s", n.Position, n.Field, p.decl.Name)
+		}
+		return code + "." + m.name, m.packet, f.g.fill(m.packet)
+	}
+	return "", nil, fmt.Errorf("%s: %s is not a packet", n.Pos(), ast.ExprString(n))
+}
+
+// value returns the expression value of the field of the packet value
+// owner.
+func (m *field) value(pos token.Position, owner string) (value, error) {
+	if m.magic != nil && m.magic.kind != kindNone {
+		return *m.magic, nil
+	}
+	if m.kind == kindNone {
+		return value{}, fmt.Errorf("%s: %s cannot be used in an expression", pos, m.decl.Name)
+	}
+	code := owner + "." + m.name
+	switch {
+	case m.code != "":
+		code = m.code
+	case m.let != nil:
+		code += "()"
+	}
+	v := value{code: code, kind: m.kind, narrow: code, typ: m.typ}
+	if m.kind != kindBool && m.typ != m.kind.goType() {
+		v.code = m.kind.goType() + "(" + code + ")"
+	}
+	return v, nil
+}
+
+func (f *fn) unary(n *ast.UnaryExpression) (value, error) {
+	x, err := f.expr(n.Operand)
+	if err != nil {
+		return value{}, err
+	}
+	switch n.Operator {
+	case "-":
+		if x.constant {
+			return constant(-x.v, kindSigned), nil
+		}
+		return value{code: "(-" + x.as(kindSigned) + ")", kind: kindSigned}, nil
+	case "~":
+		k := numeric(x.kind, kindUnsigned)
+		if x.constant {
+			return constant(^x.v, k), nil
+		}
+		return value{code: "(^" + x.as(k) + ")", kind: k}, nil
+	case "!":
+		if x.constant {
+			return constant(boolValue(x.v == 0), kindBool), nil
+		}
+		return value{code: "!" + x.as(kindBool), kind: kindBool}, nil
+	}
+	return value{}, fmt.Errorf("%s: unknown operator %s", n.Position, n.Operator)
+}
+
+func (f *fn) binary(n *ast.BinaryExpression) (value, error) {
+	l, err := f.expr(n.Left)
+	if err != nil {
+		return value{}, err
+	}
+	r, err := f.expr(n.Right)
+	if err != nil {
+		return value{}, err
+	}
+
+	switch n.Operator {
+	case "&&", "||":
+		if l.constant && r.constant {
+			if n.Operator == "&&" {
+				return constant(boolValue(l.v != 0 && r.v != 0), kindBool), nil
+			}
+			return constant(boolValue(l.v != 0 || r.v != 0), kindBool), nil
+		}
+		return value{code: "(" + l.as(kindBool) + " " + n.Operator + " " + r.as(kindBool) + ")", kind: kindBool}, nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		k := numeric(l.kind, r.kind)
+		if l.kind == kindBool && r.kind == kindBool && (n.Operator == "==" || n.Operator == "!=") {
+			k = kindBool
+		}
+		if l.constant && r.constant {
+			return constant(boolValue(compare(n.Operator, l.v, r.v, k == kindSigned)), kindBool), nil
+		}
+		return value{code: "(" + l.arg(k) + " " + n.Operator + " " + r.arg(k) + ")", kind: kindBool}, nil
+	}
+
+	k := numeric(l.kind, r.kind)
+	if l.constant && r.constant {
+		return constant(arith(n.Operator, l.v, r.v, k == kindSigned), k), nil
+	}
+	switch n.Operator {
+	case "/":
+		f.g.use(wirePackage)
+		return value{code: "wire.Div(" + l.arg(k) + ", " + r.arg(k) + ")", kind: k}, nil
+	case "%":
+		f.g.use(wirePackage)
+		return value{code: "wire.Mod(" + l.arg(k) + ", " + r.arg(k) + ")", kind: k}, nil
+	case "<<", ">>":
+		// A shift keeps the kind of its left operand, which stays typed
+		// so that a constant is not shifted as an int; the count is
+		// unsigned so that a negative count cannot panic.
+		k = numeric(l.kind, kindUnsigned)
+		return value{code: "(" + l.as(k) + " " + n.Operator + " " + r.arg(kindUnsigned) + ")", kind: k}, nil
+	case "+", "-", "*", "&", "|", "^":
+		return value{code: "(" + l.arg(k) + " " + n.Operator + " " + r.arg(k) + ")", kind: k}, nil
+	}
+	return value{}, fmt.Errorf("%s: unknown operator %s", n.Position, n.Operator)
+}
+
+// in compiles `x in lo..hi` as a chain of range tests.
+func (f *fn) in(n *ast.InExpression) (value, error) {
+	x, err := f.expr(n.Operand)
+	if err != nil {
+		return value{}, err
+	}
+	var tests []string
+	folded, folds := uint64(0), x.constant
+	for _, r := range n.Ranges {
+		lo, err := f.expr(r.Low)
+		if err != nil {
+			return value{}, err
+		}
+		hi, err := f.expr(r.High)
+		if err != nil {
+			return value{}, err
+		}
+		k := numeric(numeric(x.kind, lo.kind), hi.kind)
+		if x.constant && lo.constant && hi.constant {
+			if compare("<=", lo.v, x.v, k == kindSigned) && compare("<=", x.v, hi.v, k == kindSigned) {
+				folded = 1
+			}
+		} else {
+			folds = false
+		}
+		if r.Low == r.High {
+			tests = append(tests, x.arg(k)+" == "+lo.arg(k))
+			continue
+		}
+		tests = append(tests, lo.arg(k)+" <= "+x.arg(k)+" && "+x.arg(k)+" <= "+hi.arg(k))
+	}
+	if folds {
+		return constant(folded, kindBool), nil
+	}
+	return value{code: "(" + strings.Join(tests, " || ") + ")", kind: kindBool}, nil
+}
+
+func boolValue(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func compare(op string, l, r uint64, signed bool) bool {
+	less, equal := l < r, l == r
+	if signed {
+		less = int64(l) < int64(r)
+	}
+	switch op {
+	case "==":
+		return equal
+	case "!=":
+		return !equal
+	case "<":
+		return less
+	case "<=":
+		return less || equal
+	case ">":
+		return !less && !equal
+	default:
+		return !less
+	}
+}
+
+// arith folds an arithmetic operation the way the generated code evaluates
+// it at run time.
+func arith(op string, l, r uint64, signed bool) uint64 {
+	switch op {
+	case "+":
+		return l + r
+	case "-":
+		return l - r
+	case "*":
+		return l * r
+	case "/":
+		switch {
+		case r == 0:
+			return 0
+		case signed:
+			return uint64(int64(l) / int64(r))
+		}
+		return l / r
+	case "%":
+		switch {
+		case r == 0:
+			return 0
+		case signed:
+			return uint64(int64(l) % int64(r))
+		}
+		return l % r
+	case "<<":
+		return l << r
+	case ">>":
+		if signed {
+			return uint64(int64(l) >> r)
+		}
+		return l >> r
+	case "&":
+		return l & r
+	case "|":
+		return l | r
+	case "^":
+		return l ^ r
+	}
+	return 0
+}
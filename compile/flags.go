@@ -0,0 +1,52 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+func (g *generator) genFlags(f *ast.FlagsType) error {
+	if bits, _, ok := ast.IntegerType(f.StorageType); ok && bits > 64 {
+		return fmt.Errorf("%s: %d-bit flags are not supported", f.StorageType.Pos(), bits)
+	}
+	typ, err := g.goType(f.StorageType)
+	if err != nil {
+		return err
+	}
+
+	g.deprecated("", f.Annotations)
+	g.printf("type %s %s\n\n", f.Name, typ)
+	g.printf("const (\n")
+	for _, v := range f.Values {
+		n, ok := v.Value.(*ast.NumberLiteralType)
+		if !ok {
+			return fmt.Errorf("%s: flag %s.%s must be a bit index", v.Value.Pos(), f.Name, v.Key)
+		}
+		g.deprecated("\t", v.Annotations)
+		g.printf("\t%s%s %s = 1 << %d\n", f.Name, v.Key, f.Name, n.Value)
+	}
+	g.printf(")\n\n")
+
+	g.printf("// Has reports whether every bit of flag is set in f.\n")
+	g.printf("func (f %s) Has(flag %s) bool {\n\treturn f&flag == flag\n}\n\n", f.Name, f.Name)
+	g.printf("// Set sets the bits of flag in f.\n")
+	g.printf("func (f *%s) Set(flag %s) {\n\t*f |= flag\n}\n\n", f.Name, f.Name)
+	g.printf("// Clear clears the bits of flag in f.\n")
+	g.printf("func (f *%s) Clear(flag %s) {\n\t*f &^= flag\n}\n\n", f.Name, f.Name)
+
+	g.use("strconv")
+	g.use("strings")
+	g.printf("func (f %s) String() string {\n", f.Name)
+	g.printf("\tvar names []string\n")
+	g.printf("\trest := f\n")
+	for _, v := range f.Values {
+		g.printf("\tif f&%s%s != 0 {\n\t\tnames = append(names, %q)\n\t\trest &^= %s%s\n\t}\n", f.Name, v.Key, v.Key, f.Name, v.Key)
+	}
+	g.printf("\tif rest != 0 || len(names) == 0 {\n")
+	g.printf("\t\tnames = append(names, \"0x\"+strconv.FormatUint(uint64(rest), 16))\n")
+	g.printf("\t}\n")
+	g.printf("\treturn strings.Join(names, \"|\")\n")
+	g.printf("}\n\n")
+	return nil
+}
@@ -0,0 +1,40 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// addLet records the computed field m of p. Its kind is that of its value,
+// which may only use the fields before it.
+func (g *generator) addLet(p *packet, m *ast.PacketField, t *ast.LetType) error {
+	v, err := g.newFn(p, modeValidate).expr(t.Value)
+	if err == errNoOffset {
+		return fmt.Errorf("%s: let %s cannot depend on the offset", t.Position, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	name := exportedName(m.Name)
+	if methodNames[name] {
+		name += "_"
+	}
+	f := &field{decl: m, name: name, typ: v.kind.goType(), kind: v.kind, let: t}
+	p.fields[m.Name] = f
+	p.lets = append(p.lets, f)
+	return nil
+}
+
+// genLets generates a read-only accessor for each computed field of p.
+func (g *generator) genLets(p *packet) error {
+	for _, m := range p.lets {
+		v, err := g.newFn(p, modeValidate).expr(m.let.Value)
+		if err != nil {
+			return err
+		}
+		g.printf("// %s returns %s.\n", m.name, ast.ExprString(m.let.Value))
+		g.printf("func (p *%s) %s() %s {\n\treturn %s\n}\n\n", p.name, m.name, m.typ, v.as(m.kind))
+	}
+	return nil
+}
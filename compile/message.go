@@ -0,0 +1,196 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// message is a message declaration being generated as a Go struct with a
+// pointer field per entry, nil when the entry is absent.
+type message struct {
+	decl *ast.MessageType
+	name string
+	// entry is the packet an entry value is generated in, whose
+	// parameters are the tag and length of the entry.
+	entry            *packet
+	members          []*field
+	tagBits, lenBits int
+}
+
+// genMessage generates the struct and methods of a message.
+func (g *generator) genMessage(decl *ast.MessageType) error {
+	if len(decl.Header) != 2 {
+		return fmt.Errorf("%s: message %s must declare a tag and a length", decl.Position, decl.Name)
+	}
+	m := &message{decl: decl, name: decl.Name}
+	for i, bits := range []*int{&m.tagBits, &m.lenBits} {
+		t, err := typeNode(decl.Header[i].Type)
+		if err != nil {
+			return err
+		}
+		n, signed, _, ok := g.intType(t)
+		if !ok || signed || n > 64 {
+			return fmt.Errorf("%s: the header of message %s must be unsigned integers of up to 64 bits", t.Position, decl.Name)
+		}
+		*bits = n
+	}
+	m.entry = &packet{
+		decl:   &ast.PacketType{Position: decl.Position, Name: decl.Name, Parameters: decl.Header},
+		name:   decl.Name,
+		fields: make(map[string]*field),
+		filled: true,
+	}
+	for i := range decl.Header {
+		h := &decl.Header[i]
+		m.entry.fields[h.Name] = &field{decl: h, name: exportedName(h.Name), typ: "uint64", kind: kindUnsigned}
+	}
+	for i := range decl.Fields {
+		e := &decl.Fields[i]
+		typ, k, inner, err := g.typeOf(e.Type)
+		if err != nil {
+			return err
+		}
+		name := exportedName(e.Name)
+		if methodNames[name] || name == "Unknown" {
+			name += "_"
+		}
+		f := &field{decl: &ast.PacketField{Name: e.Name, Type: e.Type, Annotations: e.Annotations}, name: name, typ: typ, kind: k, packet: inner}
+		m.members = append(m.members, f)
+	}
+
+	g.use(wirePackage)
+	g.deprecated("", decl.Annotations)
+	g.printf("type %s struct {\n", m.name)
+	for _, f := range m.members {
+		g.deprecated("\t", f.decl.Annotations)
+		g.printf("\t%s *%s\n", f.name, f.typ)
+	}
+	g.printf("\t// Unknown holds the entries with undeclared tags, which are written\n\t// back after the others.\n")
+	g.printf("\tUnknown []wire.TLV\n")
+	g.printf("}\n\n")
+
+	dec := g.newFn(m.entry, modeDecode)
+	dec.start = ""
+	if err := m.decode(dec); err != nil {
+		return err
+	}
+	g.printf("// Decode reads the entries of p until r is exhausted. Errors are\n// *wire.DecodeError values giving the entry that could not be read.\n")
+	g.printf("func (p *%s) Decode(r *wire.BitReader) (err error) {\n", m.name)
+	g.printf("%s", dec.header())
+	g.printf("field, at := \"\", r.DataOffset()\n")
+	g.printf("defer func() {\nif err != nil {\nerr = wire.WrapDecodeError(err, %q, field, at)\n}\n}()\n", m.name)
+	g.body.Write(dec.buf.Bytes())
+	g.printf("return nil\n}\n\n")
+
+	enc := g.newFn(m.entry, modeEncode)
+	enc.start = ""
+	if err := m.encode(enc); err != nil {
+		return err
+	}
+	g.printf("// Encode writes the entries of p that are set, in declaration order, and\n// then its unknown entries. Errors are *wire.EncodeError values giving the\n// entry that could not be written.\n")
+	g.printf("func (p *%s) Encode(w *wire.BitWriter) (err error) {\n", m.name)
+	g.printf("%s", enc.header())
+	g.printf("field := \"\"\n")
+	g.printf("defer func() {\nif err != nil {\nerr = wire.WrapEncodeError(err, %q, field)\n}\n}()\n", m.name)
+	g.body.Write(enc.buf.Bytes())
+	g.printf("return nil\n}\n\n")
+
+	val := g.newFn(m.entry, modeValidate)
+	for _, f := range m.members {
+		inner := fn{g: g, p: m.entry, mode: modeValidate}
+		if err := inner.validateValue("(*p."+f.name+")", f.decl.Type, 0); err != nil {
+			return err
+		}
+		if inner.buf.Len() > 0 {
+			val.printf("if p.%s != nil {\n", f.name)
+			val.buf.Write(inner.buf.Bytes())
+			val.printf("}\n")
+		}
+	}
+	g.printf("// Validate checks the entries of p that are set.\n")
+	g.printf("func (p *%s) Validate() error {\n", m.name)
+	g.body.Write(val.buf.Bytes())
+	g.printf("return nil\n}\n\n")
+
+	g.printf("func (p *%s) MarshalBinary() ([]byte, error) {\n\treturn wire.Marshal(p)\n}\n\n", m.name)
+	g.printf("func (p *%s) UnmarshalBinary(data []byte) error {\n\treturn wire.Unmarshal(data, p)\n}\n\n", m.name)
+	return nil
+}
+
+// setTag makes the tag of the entry the constant tag of e while its value
+// is generated.
+func (m *message) setTag(e *ast.MessageField) {
+	c := constant(e.Tag.Value, kindUnsigned)
+	m.entry.fields[m.decl.Header[0].Name].magic = &c
+}
+
+func (m *message) decode(f *fn) error {
+	f.use("entries", "[]wire.TLV")
+	f.try("entries, err = wire.ReadTLVs(r, %d, %d)", m.tagBits, m.lenBits)
+	// The length of an entry is the length of its value.
+	m.entry.fields[m.decl.Header[1].Name].code = "uint64(len(e.Value))"
+	f.printf("for _, e := range entries {\nswitch e.Tag {\n")
+	for i, e := range m.decl.Fields {
+		dst := m.members[i]
+		m.setTag(&m.decl.Fields[i])
+		f.printf("case %d:\n", e.Tag.Value)
+		f.printf("field = %q\n", e.Name)
+		f.printf("var v %s\n", dst.typ)
+		f.printf("if err = wire.UnmarshalFunc(e.Value, func(r *wire.BitReader) (err error) {\n")
+		if err := f.decodeType("v", e.Type, dst.decl); err != nil {
+			return err
+		}
+		f.printf("return nil\n}); err != nil {\nreturn err\n}\n")
+		f.printf("p.%s = &v\n", dst.name)
+	}
+	f.printf("default:\np.Unknown = append(p.Unknown, e)\n}\n}\n")
+	return nil
+}
+
+func (m *message) encode(f *fn) error {
+	f.use("value", "[]byte")
+	// The length of an entry follows from its value, so it can only size
+	// a Bytes or String value taking the whole entry.
+	m.entry.fields[m.decl.Header[1].Name].kind = kindNone
+	for i, e := range m.decl.Fields {
+		src := m.members[i]
+		m.setTag(&m.decl.Fields[i])
+		f.printf("if v := p.%s; v != nil {\n", src.name)
+		f.printf("field = %q\n", e.Name)
+		if t, s, ok := m.whole(e.Type); ok {
+			if s.text {
+				replace, _ := textOptions(src.decl)
+				f.try("value, err = wire.EncodeText(*v, %s, %t)", encodingNames[textEncoding(t, s)], replace)
+			} else {
+				f.printf("value = *v\n")
+			}
+		} else {
+			f.printf("if value, err = wire.MarshalFunc(func(w *wire.BitWriter) (err error) {\n")
+			if err := f.encodeType("(*v)", e.Type, src.decl); err != nil {
+				return err
+			}
+			f.printf("return nil\n}); err != nil {\nreturn err\n}\n")
+		}
+		f.try("err = wire.WriteTLV(w, %d, %d, wire.TLV{Tag: %d, Value: value})", m.tagBits, m.lenBits, e.Tag.Value)
+		f.printf("}\n")
+	}
+	f.printf("field = \"\"\n")
+	f.try("err = wire.WriteTLVs(w, %d, %d, p.Unknown)", m.tagBits, m.lenBits)
+	return nil
+}
+
+// whole reports whether n is a Bytes(len) or String(len) value sized by the
+// length of its entry.
+func (m *message) whole(n ast.Node) (*ast.TypeType, strType, bool) {
+	t, err := typeNode(n)
+	if err != nil {
+		return nil, strType{}, false
+	}
+	s, ok := stringType(t.TypeName)
+	if !ok || !s.sized || len(t.Arguments) == 0 {
+		return nil, strType{}, false
+	}
+	id, ok := t.Arguments[0].(*ast.IdentifierType)
+	return t, s, ok && id.Value == m.decl.Header[1].Name
+}
@@ -0,0 +1,76 @@
+package compile
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// initialisms are written in capitals in Go names, as in PacketID.
+var initialisms = map[string]bool{
+	"api": true, "crc": true, "http": true, "id": true, "ip": true,
+	"json": true, "tcp": true, "udp": true, "url": true, "uuid": true,
+	"xml": true,
+}
+
+// exportedName converts a snake_case schema name to an exported Go name:
+// packet_id becomes PacketID and some_enum SomeEnum.
+func exportedName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		if initialisms[strings.ToLower(part)] {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(part)
+		b.WriteRune(unicode.ToUpper(r))
+		b.WriteString(part[size:])
+	}
+	if b.Len() == 0 {
+		return "X"
+	}
+	return b.String()
+}
+
+// instanceName returns the Go name of the packet generated for an
+// instantiation of a generic packet. A name already taken by a declaration or
+// another instantiation gets trailing underscores: P<u8> is PU8_ if a packet
+// PU8 is declared.
+func (g *generator) instanceName(t *ast.TypeType) string {
+	key := ast.ExprString(t)
+	if name, ok := g.instances[key]; ok {
+		return name
+	}
+	name := joinedName(t)
+	for {
+		_, declared := g.decls[name]
+		_, generated := g.packets[name]
+		if !declared && !generated {
+			break
+		}
+		name += "_"
+	}
+	g.instances[key] = name
+	return name
+}
+
+// joinedName joins the names in an instantiation of a generic packet:
+// Prefixed<u8> becomes PrefixedU8.
+func joinedName(t *ast.TypeType) string {
+	var b strings.Builder
+	b.WriteString(exportedName(t.TypeName))
+	for _, arg := range t.TypeArguments {
+		switch arg := arg.(type) {
+		case *ast.TypeType:
+			b.WriteString(joinedName(arg))
+		case *ast.IdentifierType:
+			b.WriteString(exportedName(arg.Value))
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,963 @@
+package compile
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/wire"
+)
+
+// packet is a packet declaration being generated as a Go struct.
+type packet struct {
+	decl *ast.PacketType
+	name string
+
+	// fields maps the schema names of parameters and fields to their Go
+	// counterparts; members lists the struct fields in order.
+	fields  map[string]*field
+	members []*field
+	sums    []*checksum
+	// pads holds the struct fields of preserved padding, which may be
+	// unnamed.
+	pads map[*ast.PacketField]*field
+	// blocks holds the sized blocks, and lengths the blocks by the field
+	// holding their size.
+	blocks  map[*ast.SizedType]*sized
+	lengths map[*ast.PacketField]*sized
+	// lets lists the computed fields, generated as methods.
+	lets   []*field
+	filled bool
+}
+
+// field is a parameter or named field of a packet.
+type field struct {
+	decl *ast.PacketField
+	name string
+	typ  string
+	kind kind
+
+	// packet is set for fields holding a packet.
+	packet *packet
+	// let is set for computed fields, which are methods rather than
+	// struct fields.
+	let *ast.LetType
+	// magic is the fixed value of a magic field, which has no struct
+	// field.
+	magic *value
+	// code is set for values held in local variables rather than struct
+	// fields, such as the length of a message entry.
+	code string
+}
+
+// methodNames are the methods generated on every packet. Fields with the same
+// Go name get a trailing underscore.
+var methodNames = map[string]bool{
+	"Decode":          true,
+	"Encode":          true,
+	"Validate":        true,
+	"MarshalBinary":   true,
+	"UnmarshalBinary": true,
+}
+
+// declarePacket returns the packet generated for decl under name, adding it
+// to the packets to generate the first time.
+func (g *generator) declarePacket(decl *ast.PacketType, name string) *packet {
+	if p, ok := g.packets[name]; ok {
+		return p
+	}
+	p := &packet{
+		decl:    decl,
+		name:    name,
+		fields:  make(map[string]*field),
+		pads:    make(map[*ast.PacketField]*field),
+		blocks:  make(map[*ast.SizedType]*sized),
+		lengths: make(map[*ast.PacketField]*sized),
+	}
+	g.packets[name] = p
+	g.order = append(g.order, p)
+	return p
+}
+
+// fill resolves the parameters and fields of p. It is called lazily, so
+// that a packet may refer to packets declared after it.
+func (g *generator) fill(p *packet) error {
+	if p.filled {
+		return nil
+	}
+	p.filled = true
+	for i := range p.decl.Parameters {
+		if err := g.addField(p, &p.decl.Parameters[i]); err != nil {
+			return err
+		}
+	}
+	if err := g.addFields(p, p.decl.Fields); err != nil {
+		return err
+	}
+	return g.addChecksums(p)
+}
+
+func (g *generator) addFields(p *packet, fields []ast.PacketField) error {
+	for i := range fields {
+		m := &fields[i]
+		switch t := m.Type.(type) {
+		case *ast.AlignType:
+			if preservePadding(m) {
+				g.addPadding(p, m)
+			}
+			continue
+		case *ast.AssertType:
+			continue
+		case *ast.SizedType:
+			if err := g.addSized(p, t); err != nil {
+				return err
+			}
+			continue
+		case *ast.LetType:
+			if err := g.addLet(p, m, t); err != nil {
+				return err
+			}
+			continue
+		}
+		if m.Magic != nil {
+			if m.Name != "_" {
+				g.addMagic(p, m)
+			}
+			continue
+		}
+		if isPadding(m.Type) && preservePadding(m) {
+			g.addPadding(p, m)
+			continue
+		}
+		if m.Name == "_" || isPadding(m.Type) {
+			continue
+		}
+		if err := g.addField(p, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *generator) addField(p *packet, m *ast.PacketField) error {
+	typ, k, inner, err := g.typeOf(m.Type)
+	if err != nil {
+		return err
+	}
+	name := exportedName(m.Name)
+	if methodNames[name] {
+		name += "_"
+	}
+	f := &field{decl: m, name: name, typ: typ, kind: k, packet: inner}
+	p.fields[m.Name] = f
+	p.members = append(p.members, f)
+	return nil
+}
+
+// addMagic records the magic field m of p. It has no struct field; integer
+// and bool magic values can still be used in expressions as constants.
+func (g *generator) addMagic(p *packet, m *ast.PacketField) {
+	v := &value{}
+	switch n := m.Magic.(type) {
+	case *ast.NumberLiteralType:
+		if _, k, _, err := g.typeOf(m.Type); err == nil && k != kindNone {
+			c := constant(n.Value, k)
+			v = &c
+		}
+	case *ast.BooleanLiteralType:
+		c := constant(0, kindBool)
+		if n.Value {
+			c.v = 1
+		}
+		v = &c
+	}
+	p.fields[m.Name] = &field{decl: m, name: exportedName(m.Name), magic: v}
+}
+
+// magicBytes returns the encoding of the magic value of m.
+func (g *generator) magicBytes(m *ast.PacketField) ([]byte, error) {
+	switch n := m.Magic.(type) {
+	case *ast.BooleanLiteralType:
+		if n.Value {
+			return []byte{1}, nil
+		}
+		return []byte{0}, nil
+	case *ast.StringLiteralType:
+		return []byte(n.Value), nil
+	case *ast.ArrayLiteralType:
+		b := make([]byte, len(n.Elements))
+		for i, e := range n.Elements {
+			v, ok := constExpr(e)
+			if !ok {
+				return nil, fmt.Errorf("%s: magic bytes must be numbers", e.Pos())
+			}
+			b[i] = byte(v)
+		}
+		return b, nil
+	case *ast.NumberLiteralType:
+		t, err := typeNode(m.Type)
+		if err != nil {
+			return nil, err
+		}
+		bits, _, le, ok := g.intType(t)
+		if !ok || bits%8 != 0 {
+			return nil, fmt.Errorf("%s: magic numbers need a whole-byte integer type", n.Position)
+		}
+		b := make([]byte, bits/8)
+		for i := range b {
+			shift := uint(len(b)-1-i) * 8
+			if shift < 64 {
+				b[i] = byte(n.Value >> shift)
+			} else {
+				b[i] = byte(n.High >> (shift - 64))
+			}
+		}
+		if le {
+			for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+				b[i], b[j] = b[j], b[i]
+			}
+		}
+		return b, nil
+	}
+	return nil, fmt.Errorf("%s: unsupported magic value %s", m.Magic.Pos(), ast.ExprString(m.Magic))
+}
+
+// byteLiteral returns the Go code for b.
+func byteLiteral(b []byte) string {
+	var buf strings.Builder
+	buf.WriteString("[]byte{")
+	for i, c := range b {
+		if i > 0 {
+			buf.WriteString(", ")
+		}
+		fmt.Fprintf(&buf, "0x%02x", c)
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// addPadding adds the struct field keeping the bits of the preserved
+// padding m. Unnamed padding gets an unexported field.
+func (g *generator) addPadding(p *packet, m *ast.PacketField) {
+	typ := "uint64"
+	var width ast.Node
+	switch t := m.Type.(type) {
+	case *ast.TypeType:
+		if len(t.Arguments) == 1 {
+			width = t.Arguments[0]
+		}
+	}
+	if width != nil {
+		if n, ok := constExpr(width); ok && n <= 64 {
+			typ = uintType(n)
+		}
+	}
+	f := &field{decl: m, typ: typ, kind: kindUnsigned}
+	if unnamed(m) {
+		n := 1
+		for _, pad := range p.pads {
+			if unnamed(pad.decl) {
+				n++
+			}
+		}
+		f.name = fmt.Sprintf("pad%d", n)
+	} else {
+		f.name = exportedName(m.Name)
+		if methodNames[f.name] {
+			f.name += "_"
+		}
+		p.fields[m.Name] = f
+	}
+	p.pads[m] = f
+	p.members = append(p.members, f)
+}
+
+// typeNode returns n as a type. Declared types used as arguments, as in
+// Array(Header, 2), parse as identifiers.
+func typeNode(n ast.Node) (*ast.TypeType, error) {
+	switch n := n.(type) {
+	case *ast.TypeType:
+		return n, nil
+	case *ast.IdentifierType:
+		return &ast.TypeType{Position: n.Position, TypeName: n.Value}, nil
+	}
+	return nil, fmt.Errorf("%s: %s is not a type", n.Pos(), ast.ExprString(n))
+}
+
+// typeOf returns the Go type and expression kind of values of a field type,
+// and the packet for packet types.
+func (g *generator) typeOf(n ast.Node) (string, kind, *packet, error) {
+	t, err := typeNode(n)
+	if err != nil {
+		return "", kindNone, nil, err
+	}
+	if bits, signed, _, ok := g.intType(t); ok {
+		k := kindUnsigned
+		switch {
+		case bits > 64:
+			k = kindNone
+		case signed:
+			k = kindSigned
+		}
+		if _, declared := g.decls[t.TypeName]; declared {
+			return t.TypeName, k, nil, nil
+		}
+		typ, err := g.goType(t)
+		return typ, k, nil, err
+	}
+	if s, ok := stringType(t.TypeName); ok {
+		if s.text {
+			return "string", kindNone, nil, nil
+		}
+		return "[]byte", kindNone, nil, nil
+	}
+	if _, _, ok := ast.FloatType(t); ok {
+		typ, err := g.goType(t)
+		return typ, kindNone, nil, err
+	}
+	switch t.TypeName {
+	case "bool":
+		return "bool", kindBool, nil, nil
+	case "Bits":
+		if len(t.Arguments) == 1 {
+			if n, ok := constExpr(t.Arguments[0]); ok {
+				return uintType(n), kindUnsigned, nil, nil
+			}
+		}
+		return "uint64", kindUnsigned, nil, nil
+	case "Array":
+		if len(t.Arguments) != 2 {
+			return "", kindNone, nil, fmt.Errorf("%s: Array takes an element type and a count", t.Position)
+		}
+		elem, _, _, err := g.typeOf(t.Arguments[0])
+		return "[]" + elem, kindNone, nil, err
+	}
+	switch decl := g.decls[t.TypeName].(type) {
+	case *ast.PacketType:
+		if len(t.TypeArguments) != len(decl.TypeParameters) {
+			return "", kindNone, nil, fmt.Errorf("%s: %s takes %d type arguments", t.Position, decl.Name, len(decl.TypeParameters))
+		}
+		if len(decl.TypeParameters) > 0 {
+			// Each instantiation is generated as its own packet.
+			name := g.instanceName(t)
+			return name, kindNone, g.declarePacket(ast.Instantiate(decl, t.TypeArguments), name), nil
+		}
+		return decl.Name, kindNone, g.declarePacket(decl, decl.Name), nil
+	case *ast.MessageType:
+		return t.TypeName, kindNone, nil, nil
+	}
+	return "", kindNone, nil, fmt.Errorf("%s: unsupported type %s", t.Position, ast.ExprString(t))
+}
+
+// intType reports the width, signedness and byte order of an integer type,
+// or of the storage of an enum or flags type.
+func (g *generator) intType(t *ast.TypeType) (bits int, signed, le, ok bool) {
+	if bits, signed, ok := ast.IntegerType(t); ok {
+		return bits, signed, bits > 8 && strings.HasSuffix(t.TypeName, "le"), true
+	}
+	if len(t.Arguments) > 0 {
+		return 0, false, false, false
+	}
+	switch decl := g.decls[t.TypeName].(type) {
+	case *ast.EnumerationType:
+		if st, ok := decl.ReturnType.(*ast.TypeType); ok {
+			return g.intType(st)
+		}
+	case *ast.FlagsType:
+		if st, ok := decl.StorageType.(*ast.TypeType); ok {
+			return g.intType(st)
+		}
+	}
+	return 0, false, false, false
+}
+
+// uintType returns the smallest unsigned Go type holding n bits.
+func uintType(n uint64) string {
+	switch {
+	case n <= 8:
+		return "uint8"
+	case n <= 16:
+		return "uint16"
+	case n <= 32:
+		return "uint32"
+	}
+	return "uint64"
+}
+
+// strType describes a byte or text string type.
+type strType struct {
+	text bool
+	// sized types take their length in bytes as an argument.
+	sized bool
+	// terminated types end with an all-zero code unit.
+	terminated bool
+	// prefix is the width of the length that precedes the others.
+	prefix uint
+	le     bool
+}
+
+// stringType classifies the byte and text string types, such as Bytes,
+// CString and String16le.
+func stringType(name string) (strType, bool) {
+	var s strType
+	switch {
+	case strings.HasPrefix(name, "String"):
+		s.text, name = true, name[len("String"):]
+	case strings.HasPrefix(name, "Bytes"):
+		name = name[len("Bytes"):]
+	case name == "CString":
+		return strType{text: true, terminated: true}, true
+	case name == "Cbytes":
+		return strType{terminated: true}, true
+	case name == "LongString":
+		return strType{text: true, prefix: 64}, true
+	case name == "LongBytes":
+		return strType{prefix: 64}, true
+	default:
+		return s, false
+	}
+	if name == "" {
+		s.sized = true
+		return s, true
+	}
+	switch {
+	case strings.HasSuffix(name, "le"):
+		s.le = true
+	case !strings.HasSuffix(name, "be"):
+		return s, false
+	}
+	switch name[:len(name)-2] {
+	case "8":
+		s.prefix, s.le = 8, false
+	case "16":
+		s.prefix = 16
+	case "32":
+		s.prefix = 32
+	case "64":
+		s.prefix = 64
+	default:
+		return s, false
+	}
+	return s, true
+}
+
+// encodingNames are the Go names of the text encodings in package wire.
+var encodingNames = map[wire.Encoding]string{
+	wire.UTF8:    "wire.UTF8",
+	wire.UTF16LE: "wire.UTF16LE",
+	wire.UTF16BE: "wire.UTF16BE",
+	wire.Latin1:  "wire.Latin1",
+	wire.ASCII:   "wire.ASCII",
+}
+
+// textEncoding returns the encoding given as the trailing argument of a
+// string type, which defaults to UTF-8.
+func textEncoding(t *ast.TypeType, s strType) wire.Encoding {
+	arity := 0
+	if s.sized {
+		arity = 1
+	}
+	if len(t.Arguments) == arity+1 {
+		if id, ok := t.Arguments[arity].(*ast.IdentifierType); ok {
+			if e, ok := wire.ParseEncoding(id.Value); ok {
+				return e
+			}
+		}
+	}
+	return wire.UTF8
+}
+
+// textOptions returns the settings of a field's @text annotation: whether
+// invalid text is replaced, and whether String(len) counts code units.
+func textOptions(m *ast.PacketField) (replace, units bool) {
+	if m == nil {
+		return false, false
+	}
+	a := ast.FindAnnotation(m.Annotations, "text")
+	if a == nil {
+		return false, false
+	}
+	for _, arg := range a.Arguments {
+		if id, ok := arg.Value.(*ast.IdentifierType); ok {
+			switch {
+			case arg.Key == "invalid" && id.Value == "replace":
+				replace = true
+			case arg.Key == "length" && id.Value == "units":
+				units = true
+			}
+		}
+	}
+	return replace, units
+}
+
+// annotationIdent returns the first positional identifier argument of a,
+// as in @padding(zero).
+func annotationIdent(a *ast.Annotation) string {
+	if a == nil {
+		return ""
+	}
+	for _, arg := range a.Arguments {
+		if id, ok := arg.Value.(*ast.IdentifierType); ok && arg.Key == "" {
+			return id.Value
+		}
+	}
+	return ""
+}
+
+func isPadding(n ast.Node) bool {
+	t, ok := n.(*ast.TypeType)
+	return ok && t.TypeName == "Padding"
+}
+
+// unnamed reports whether m is an align statement or a field named _.
+func unnamed(m *ast.PacketField) bool {
+	return m.Name == "" || m.Name == "_"
+}
+
+// preservePadding reports whether the padding of m is kept for re-encoding.
+func preservePadding(m *ast.PacketField) bool {
+	return annotationIdent(ast.FindAnnotation(m.Annotations, "padding")) == "preserve"
+}
+
+// boolBits returns the width of a bool: one bit with @bit, otherwise a
+// byte. m is nil for array elements.
+func boolBits(m *ast.PacketField) int {
+	if m != nil && ast.FindAnnotation(m.Annotations, "bit") != nil {
+		return 1
+	}
+	return 8
+}
+
+// zeroPadding reports whether the padding of m must be zero on decode.
+func zeroPadding(m *ast.PacketField) bool {
+	return annotationIdent(ast.FindAnnotation(m.Annotations, "padding")) == "zero"
+}
+
+// constExpr evaluates an expression that does not depend on any field, such
+// as the width of Bits(8).
+func constExpr(n ast.Node) (uint64, bool) {
+	f := &fn{g: &generator{imports: make(map[string]bool)}, p: &packet{}, mode: modeValidate}
+	v, err := f.expr(n)
+	return v.v, err == nil && v.constant
+}
+
+type fnMode int
+
+const (
+	modeDecode fnMode = iota
+	modeEncode
+	modeValidate
+)
+
+// fn is a generated method of a packet being written.
+type fn struct {
+	g    *generator
+	p    *packet
+	mode fnMode
+	buf  bytes.Buffer
+
+	// rw is the reader or writer variable. start is the variable holding
+	// its offset at the start of the packet, or empty if its offset is
+	// already relative to the packet.
+	rw        string
+	start     string
+	needStart bool
+	// needOrigin is set once an @at field counts from the start of the
+	// packet, whose byte offset in the data is held in origin.
+	needOrigin bool
+
+	// ret precedes the error in return statements, as in `return e1, err`
+	// inside the closure reading an array element.
+	ret string
+	// vars are the scratch variables used, by name.
+	vars  map[string]string
+	depth int
+	// ats counts the @at fields read, which name their readers.
+	ats  int
+	last *lastElem
+	// peek is set while a peek field is read.
+	peek bool
+}
+
+func (g *generator) newFn(p *packet, mode fnMode) *fn {
+	f := &fn{g: g, p: p, mode: mode, vars: make(map[string]string)}
+	switch mode {
+	case modeDecode:
+		f.rw, f.start = "r", "start"
+	case modeEncode:
+		f.rw, f.start = "w", "start"
+	}
+	return f
+}
+
+func (f *fn) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&f.buf, format, args...)
+}
+
+// use declares a scratch variable.
+func (f *fn) use(name, typ string) {
+	f.vars[name] = typ
+}
+
+// try emits a statement assigning err and returns the error if it is set.
+func (f *fn) try(format string, args ...interface{}) {
+	f.printf("if "+format+"; err != nil {\nreturn %serr\n}\n", append(args, f.ret)...)
+}
+
+// fail emits a return of the error code.
+func (f *fn) fail(code string) {
+	f.printf("return %s%s\n", f.ret, code)
+}
+
+// at returns the code of the bit offset in the data, which decode errors
+// report.
+func (f *fn) at() string {
+	return f.rw + ".DataOffset()"
+}
+
+// offset returns the code of the bit offset from the start of the packet.
+func (f *fn) offset() (string, error) {
+	if f.mode == modeValidate {
+		return "", errNoOffset
+	}
+	if f.start == "" {
+		return f.rw + ".Offset()", nil
+	}
+	f.needStart = true
+	return "(" + f.rw + ".Offset() - " + f.start + ")", nil
+}
+
+// header returns the declarations of the start offset and scratch
+// variables.
+func (f *fn) header() string {
+	var b strings.Builder
+	if f.needStart {
+		fmt.Fprintf(&b, "start := %s.Offset()\n", f.rw)
+	}
+	if f.needOrigin {
+		fmt.Fprintf(&b, "origin := %s.DataOffset() / 8\n", f.rw)
+	}
+	names := make([]string, 0, len(f.vars))
+	for name := range f.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(&b, "var %s %s\n", name, f.vars[name])
+	}
+	return b.String()
+}
+
+// lastElem is the element just read, which the condition of an
+// `Array(T, until = ...)` calls last.
+type lastElem struct {
+	name   string
+	typ    string
+	kind   kind
+	packet *packet
+	// used is set once the condition refers to last.
+	used bool
+}
+
+// lastCond compiles the condition of an `Array(T, until = cond)` whose
+// elements have type elem.
+func (f *fn) lastCond(elem *ast.TypeType, cond ast.Node) (value, *lastElem, error) {
+	typ, k, inner, err := f.g.typeOf(elem)
+	if err != nil {
+		return value{}, nil, err
+	}
+	last, outer := &lastElem{name: "last", typ: typ, kind: k, packet: inner}, f.last
+	f.last = last
+	v, err := f.expr(cond)
+	f.last = outer
+	return v, last, err
+}
+
+func (l *lastElem) value(n *ast.IdentifierType) (value, error) {
+	l.used = true
+	if l.kind == kindNone {
+		return value{}, fmt.Errorf("%s: last cannot be used in an expression", n.Position)
+	}
+	code := l.name
+	if l.kind != kindBool && l.typ != l.kind.goType() {
+		code = l.kind.goType() + "(" + code + ")"
+	}
+	return value{code: code, kind: l.kind}, nil
+}
+
+// constraint emits the check of a field's where condition, whose value is
+// in the Go expression dst.
+func (f *fn) constraint(m *ast.PacketField, dst string) error {
+	v, err := f.expr(m.Constraint)
+	if err != nil {
+		return err
+	}
+	f.g.use(wirePackage)
+	f.printf("if !%s {\n", v.as(kindBool))
+	f.fail(fmt.Sprintf("&wire.ConstraintError{Path: %q, Value: %s, Condition: %q}", f.p.name+"."+m.Name, dst, ast.ExprString(m.Constraint)))
+	f.printf("}\n")
+	return nil
+}
+
+// assert emits the check of an assert statement.
+func (f *fn) assert(a *ast.AssertType) error {
+	v, err := f.expr(a.Condition)
+	if err != nil {
+		return err
+	}
+	message := ""
+	if a.Message != nil {
+		message = a.Message.Value
+	}
+	f.g.use(wirePackage)
+	f.printf("if !%s {\n", v.as(kindBool))
+	f.fail(fmt.Sprintf("&wire.ConstraintError{Path: %q, Condition: %q, Message: %q}", f.p.name, ast.ExprString(a.Condition), message))
+	f.printf("}\n")
+	return nil
+}
+
+func (g *generator) genPacket(p *packet) error {
+	if err := g.fill(p); err != nil {
+		return err
+	}
+	g.use(wirePackage)
+
+	g.deprecated("", p.decl.Annotations)
+	g.printf("type %s struct {\n", p.name)
+	for _, m := range p.members {
+		g.deprecated("\t", m.decl.Annotations)
+		g.printf("\t%s %s\n", m.name, m.typ)
+	}
+	g.printf("}\n\n")
+	if err := g.genNew(p); err != nil {
+		return err
+	}
+
+	dec := g.newFn(p, modeDecode)
+	if err := dec.decodeFields(p.decl.Fields); err != nil {
+		return err
+	}
+	g.printf("// Decode reads p from r. Errors are *wire.DecodeError values giving the\n// field and bit offset at which decoding failed.\n")
+	g.printf("func (p *%s) Decode(r *wire.BitReader) (err error) {\n", p.name)
+	g.printf("%s", dec.header())
+	g.printf("field, at := \"\", r.DataOffset()\n")
+	g.printf("defer func() {\nif err != nil {\nerr = wire.WrapDecodeError(err, %q, field, at)\n}\n}()\n", p.name)
+	g.body.Write(dec.buf.Bytes())
+	g.printf("return nil\n}\n\n")
+
+	enc := g.newFn(p, modeEncode)
+	if err := enc.encodeFields(p.decl.Fields); err != nil {
+		return err
+	}
+	g.printf("// Encode writes p to w. Errors are *wire.EncodeError values giving the\n// field that could not be written.\n")
+	g.printf("func (p *%s) Encode(w *wire.BitWriter) (err error) {\n", p.name)
+	g.printf("%s", enc.header())
+	g.printf("field := \"\"\n")
+	g.printf("defer func() {\nif err != nil {\nerr = wire.WrapEncodeError(err, %q, field)\n}\n}()\n", p.name)
+	g.body.Write(enc.buf.Bytes())
+	g.printf("return nil\n}\n\n")
+
+	val := g.newFn(p, modeValidate)
+	if err := val.validateFields(p.decl.Fields); err != nil {
+		return err
+	}
+	g.printf("// Validate checks the constraints and assertions of p that do not depend\n// on its position in the data.\n")
+	g.printf("func (p *%s) Validate() error {\n", p.name)
+	g.body.Write(val.buf.Bytes())
+	g.printf("return nil\n}\n\n")
+
+	g.printf("func (p *%s) MarshalBinary() ([]byte, error) {\n\treturn wire.Marshal(p)\n}\n\n", p.name)
+	g.printf("func (p *%s) UnmarshalBinary(data []byte) error {\n\treturn wire.Unmarshal(data, p)\n}\n\n", p.name)
+	if err := g.genLets(p); err != nil {
+		return err
+	}
+	return g.genScales(p)
+}
+
+// validateFields emits the checks of Validate. Conditions that depend on the
+// offset are only checked while decoding and encoding.
+func (f *fn) validateFields(fields []ast.PacketField) error {
+	for i := range fields {
+		m := &fields[i]
+		if err := f.present(m, func() error { return f.validateField(m) }); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *fn) validateField(m *ast.PacketField) error {
+	switch t := m.Type.(type) {
+	case *ast.AssertType:
+		if err := f.assert(t); err != nil && err != errNoOffset {
+			return err
+		}
+		return nil
+	case *ast.SizedType:
+		return f.validateFields(t.Fields)
+	case *ast.LetType:
+		return nil
+	}
+	dst, ok := f.p.fields[m.Name]
+	if !ok || m.Name == "_" || dst.magic != nil || m.Peek {
+		// Peek fields are only checked when they are decoded.
+		return nil
+	}
+	if m.Constraint != nil {
+		if err := f.constraint(m, "p."+dst.name); err != nil && err != errNoOffset {
+			return err
+		}
+	}
+	return f.validateValue("p."+dst.name, m.Type, 0)
+}
+
+// validateValue emits the validation of nested packets in a value.
+func (f *fn) validateValue(code string, n ast.Node, depth int) error {
+	t, err := typeNode(n)
+	if err != nil {
+		return err
+	}
+	if t.TypeName == "Array" && len(t.Arguments) == 2 {
+		inner := fn{g: f.g, p: f.p, mode: modeValidate}
+		i := fmt.Sprintf("i%d", depth+1)
+		if err := inner.validateValue(code+"["+i+"]", t.Arguments[0], depth+1); err != nil {
+			return err
+		}
+		if inner.buf.Len() > 0 {
+			f.printf("for %s := range %s {\n", i, code)
+			f.buf.Write(inner.buf.Bytes())
+			f.printf("}\n")
+		}
+		return nil
+	}
+	switch f.g.decls[t.TypeName].(type) {
+	case *ast.PacketType, *ast.MessageType:
+		f.printf("if err := %s.Validate(); err != nil {\nreturn err\n}\n", code)
+		return nil
+	}
+	if f.closedEnum(t) {
+		f.printf("if err := %s.Validate(); err != nil {\nreturn err\n}\n", code)
+	}
+	return nil
+}
+
+// closedEnum reports whether t is a closed enum, whose values are validated
+// when they are decoded or encoded.
+func (f *fn) closedEnum(t *ast.TypeType) bool {
+	e, ok := f.g.decls[t.TypeName].(*ast.EnumerationType)
+	return ok && !e.IsOpen()
+}
+
+// enter starts the closure reading an array element and returns the
+// element variable and the previous return prefix.
+func (f *fn) enter() (string, string) {
+	f.depth++
+	e, outer := fmt.Sprintf("e%d", f.depth), f.ret
+	f.ret = e + ", "
+	return e, outer
+}
+
+func (f *fn) leave(outer string) {
+	f.ret = outer
+	f.depth--
+}
+
+// isByte reports whether t is u8, whose arrays are read as byte slices.
+func (f *fn) isByte(t *ast.TypeType) bool {
+	bits, signed, ok := ast.IntegerType(t)
+	return ok && bits == 8 && !signed
+}
+
+// width returns the code of the width of Bits(n) as a uint.
+func (f *fn) width(t *ast.TypeType) (string, error) {
+	if len(t.Arguments) != 1 {
+		return "", fmt.Errorf("%s: Bits takes a width", t.Position)
+	}
+	v, err := f.expr(t.Arguments[0])
+	if err != nil {
+		return "", err
+	}
+	if v.constant {
+		return v.arg(kindUnsigned), nil
+	}
+	return "uint(" + v.as(kindUnsigned) + ")", nil
+}
+
+// length returns the code of the length in bytes of String(len) or
+// Bytes(len). Under @text(length = units) len counts code units of unit
+// bytes.
+func (f *fn) length(t *ast.TypeType, unit int, units bool) (string, error) {
+	if len(t.Arguments) == 0 {
+		return "", fmt.Errorf("%s: %s takes a length", t.Position, t.TypeName)
+	}
+	v, err := f.expr(t.Arguments[0])
+	if err != nil {
+		return "", err
+	}
+	if !units || unit == 1 {
+		return v.arg(kindUnsigned), nil
+	}
+	if v.constant {
+		return constant(v.v*uint64(unit), kindUnsigned).arg(kindUnsigned), nil
+	}
+	return fmt.Sprintf("(%s * %d)", v.as(kindUnsigned), unit), nil
+}
+
+// skipSize returns the code of the size in bits of padding or an unnamed
+// field, which decoders skip and encoders write as zero bits.
+func (f *fn) skipSize(m *ast.PacketField) (string, error) {
+	t, err := typeNode(m.Type)
+	if err != nil {
+		return "", err
+	}
+	if bits, _, _, ok := f.g.intType(t); ok {
+		return strconv.Itoa(bits), nil
+	}
+	if bits, _, ok := ast.FloatType(t); ok {
+		return strconv.Itoa(bits), nil
+	}
+	switch t.TypeName {
+	case "Bits", "Padding":
+		if len(t.Arguments) == 1 {
+			v, err := f.expr(t.Arguments[0])
+			if err != nil {
+				return "", err
+			}
+			return v.arg(kindSigned), nil
+		}
+	}
+	return "", fmt.Errorf("%s: unnamed %s fields are not supported", t.Position, ast.ExprString(t))
+}
+
+// setParams emits the assignment of the arguments of a packet type, as in
+// Body(len), to the parameters of the packet value dst.
+func (f *fn) setParams(dst string, inner *packet, args []ast.Node) error {
+	if err := f.g.fill(inner); err != nil {
+		return err
+	}
+	for i, arg := range args {
+		if i >= len(inner.decl.Parameters) {
+			return fmt.Errorf("%s: too many arguments for %s", arg.Pos(), inner.decl.Name)
+		}
+		param := inner.fields[inner.decl.Parameters[i].Name]
+		if param.kind == kindNone {
+			return fmt.Errorf("%s: parameter %s of %s cannot be set from an expression", arg.Pos(), param.decl.Name, inner.decl.Name)
+		}
+		v, err := f.expr(arg)
+		if err != nil {
+			return err
+		}
+		code := v.as(param.kind)
+		switch {
+		case v.typ == param.typ:
+			code = v.narrow
+		case param.kind != kindBool && param.typ != param.kind.goType():
+			code = param.typ + "(" + v.arg(param.kind) + ")"
+		}
+		f.printf("%s.%s = %s\n", dst, param.name, code)
+	}
+	return nil
+}
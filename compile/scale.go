@@ -0,0 +1,108 @@
+package compile
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/wire"
+)
+
+// genScales generates the accessors of the physical values of the fields of
+// p annotated with @scale, @offset or @unit. The struct field keeps the raw
+// value.
+func (g *generator) genScales(p *packet) error {
+	for _, m := range p.members {
+		s, ok, err := scaleOf(m.decl)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		t, err := typeNode(m.decl.Type)
+		if err != nil {
+			return err
+		}
+		bits, signed, _, ok := g.intType(t)
+		if !ok {
+			bits = 64
+			if len(t.Arguments) == 1 {
+				if n, ok := constExpr(t.Arguments[0]); ok {
+					bits = int(n)
+				}
+			}
+		}
+		if bits > 64 {
+			return fmt.Errorf("%s: @scale is not supported on integers wider than 64 bits", t.Position)
+		}
+		scale := fmt.Sprintf("wire.Scale{Factor: %s, Offset: %s, Unit: %q}", floatLiteral(s.Factor), floatLiteral(s.Offset), s.Unit)
+		unit := ""
+		if s.Unit != "" {
+			unit = ", in " + s.Unit
+		}
+		g.printf("// %sPhysical returns the physical value of p.%s%s.\n", m.name, m.name, unit)
+		g.printf("func (p *%s) %sPhysical() float64 {\n", p.name, m.name)
+		g.printf("return %s.Physical(float64(p.%s))\n}\n\n", scale, m.name)
+
+		g.printf("// Set%sPhysical sets p.%s to the raw value nearest to the physical\n// value v. Errors are *wire.OutOfRangeError values.\n", m.name, m.name)
+		g.printf("func (p *%s) Set%sPhysical(v float64) error {\n", p.name, m.name)
+		g.printf("raw, err := %s.Raw(v, %d, %t)\n", scale, bits, signed)
+		g.printf("if err != nil {\nreturn err\n}\n")
+		g.printf("p.%s = %s(raw)\nreturn nil\n}\n\n", m.name, m.typ)
+
+		g.printf("// %sString formats the physical value of p.%s with its unit.\n", m.name, m.name)
+		g.printf("func (p *%s) %sString() string {\n", p.name, m.name)
+		g.printf("return %s.Format(float64(p.%s))\n}\n\n", scale, m.name)
+	}
+	return nil
+}
+
+// scaleOf returns the scale of a field annotated with @scale, @offset or
+// @unit.
+func scaleOf(m *ast.PacketField) (wire.Scale, bool, error) {
+	s := wire.Scale{Factor: 1}
+	found := false
+	for _, a := range []struct {
+		name string
+		dst  *float64
+	}{{"scale", &s.Factor}, {"offset", &s.Offset}} {
+		an := ast.FindAnnotation(m.Annotations, a.name)
+		if an == nil {
+			continue
+		}
+		v, ok := floatExpr(an.Arguments[0].Value)
+		if !ok {
+			return s, false, fmt.Errorf("%s: @%s expects a number", an.Position, a.name)
+		}
+		*a.dst, found = v, true
+	}
+	if an := ast.FindAnnotation(m.Annotations, "unit"); an != nil {
+		u, ok := an.Arguments[0].Value.(*ast.StringLiteralType)
+		if !ok {
+			return s, false, fmt.Errorf("%s: @unit expects a string", an.Position)
+		}
+		s.Unit, found = u.Value, true
+	}
+	return s, found, nil
+}
+
+func floatLiteral(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// floatExpr evaluates a possibly negated number literal.
+func floatExpr(n ast.Node) (float64, bool) {
+	switch n := n.(type) {
+	case *ast.NumberLiteralType:
+		return float64(n.High)*(1<<64) + float64(n.Value), true
+	case *ast.FloatLiteralType:
+		return n.Value, true
+	case *ast.UnaryExpression:
+		if n.Operator == "-" {
+			v, ok := floatExpr(n.Operand)
+			return -v, ok
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,161 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// sized is a `sized(len) { ... }` block of a packet.
+type sized struct {
+	decl *ast.SizedType
+	// v is the variable holding the wire.SizedReader or wire.SizedWriter,
+	// and n the one holding the encoded size in bytes.
+	v, n string
+	// length is the field named by the size of the block, which the
+	// encoder fills in, or nil if the size is only checked.
+	length *field
+	bits   int
+}
+
+// addSized records the sized block t of p and adds its fields.
+func (g *generator) addSized(p *packet, t *ast.SizedType) error {
+	i := len(p.blocks) + 1
+	s := &sized{decl: t, v: fmt.Sprintf("s%d", i), n: fmt.Sprintf("n%d", i)}
+	p.blocks[t] = s
+	if id, ok := t.Size.(*ast.IdentifierType); ok {
+		if m := p.fields[id.Value]; m != nil && m.magic == nil && m.let == nil && !p.isParameter(m) && p.lengths[m.decl] == nil {
+			if bits, ok := g.lengthBits(m); ok {
+				s.length, s.bits = m, bits
+				p.lengths[m.decl] = s
+			}
+		}
+	}
+	return g.addFields(p, t.Fields)
+}
+
+// lengthBits returns the width of a field that can hold the size of a
+// sized block: an unsigned integer or Bits(n) of at most 64 bits.
+func (g *generator) lengthBits(m *field) (int, bool) {
+	if m.kind != kindUnsigned || m.decl.Checksum != nil {
+		return 0, false
+	}
+	t, err := typeNode(m.decl.Type)
+	if err != nil {
+		return 0, false
+	}
+	if _, declared := g.decls[t.TypeName]; declared {
+		return 0, false
+	}
+	if bits, _, _, ok := g.intType(t); ok {
+		return bits, bits <= 64
+	}
+	if t.TypeName == "Bits" && len(t.Arguments) == 1 {
+		if n, ok := constExpr(t.Arguments[0]); ok && n <= 64 {
+			return int(n), true
+		}
+	}
+	return 0, false
+}
+
+func (p *packet) isParameter(m *field) bool {
+	for i := range p.decl.Parameters {
+		if m.decl == &p.decl.Parameters[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// decodeSized emits the reading of the sized block of m through a
+// wire.SizedReader, whose offsets start at zero.
+func (f *fn) decodeSized(m *ast.PacketField, t *ast.SizedType) error {
+	s := f.p.blocks[t]
+	size, err := f.expr(t.Size)
+	if err != nil {
+		return err
+	}
+	f.use(s.v, "*wire.SizedReader")
+	f.printf("%s = wire.NewSizedReader(%s, int64(%s))\n", s.v, f.rw, size.as(kindUnsigned))
+	f.printf("if err = func() (err error) {\n")
+	if err := f.block(s.v+".BitReader", func() error { return f.decodeFields(t.Fields) }); err != nil {
+		return err
+	}
+	f.printf("return nil\n}(); err != nil {\nreturn %s.Err(err)\n}\n", s.v)
+	f.try("err = %s.Close(%t)", s.v, trailingSkip(m))
+	return nil
+}
+
+// encodeSized emits the writing of the sized block of m. Blocks whose size
+// is filled in were encoded before their length field; others are checked
+// against their size, and padded with zero bytes under @trailing(skip).
+func (f *fn) encodeSized(m *ast.PacketField, t *ast.SizedType) error {
+	s := f.p.blocks[t]
+	if s.length == nil {
+		if err := f.encodeBlock(s); err != nil {
+			return err
+		}
+		size, err := f.expr(t.Size)
+		if err != nil {
+			return err
+		}
+		want := size.as(kindUnsigned)
+		if trailingSkip(m) {
+			f.printf("if n := uint64(%s); n > %s {\n", s.n, want)
+			f.fail("&wire.LengthError{Length: n, Want: " + want + "}")
+			f.printf("}\n")
+			f.try("err = %s.Zero(int64(%s-uint64(%s)) * 8)", s.v, want, s.n)
+		} else {
+			f.printf("if n := uint64(%s); n != %s {\n", s.n, want)
+			f.fail("&wire.LengthError{Length: n, Want: " + want + "}")
+			f.printf("}\n")
+		}
+	}
+	f.try("_, err = %s.WriteTo(%s)", s.v, f.rw)
+	return nil
+}
+
+// fillLength emits the encoding of the sized block s and the setting of its
+// length field to its size.
+func (f *fn) fillLength(s *sized) error {
+	if err := f.encodeBlock(s); err != nil {
+		return err
+	}
+	f.printf("field = %q\n", s.length.decl.Name)
+	if s.bits < 64 {
+		f.printf("if uint64(%s) >= 1<<%d {\n", s.n, s.bits)
+		f.fail(fmt.Sprintf("&wire.OverflowError{Value: uint64(%s), Bits: %d}", s.n, s.bits))
+		f.printf("}\n")
+	}
+	f.printf("p.%s = %s(%s)\n", s.length.name, s.length.typ, s.n)
+	return nil
+}
+
+// encodeBlock emits the encoding of the fields of s into a
+// wire.SizedWriter, and sets the size variable to its length in bytes.
+func (f *fn) encodeBlock(s *sized) error {
+	f.use(s.v, "*wire.SizedWriter")
+	f.use(s.n, "int64")
+	f.printf("%s = wire.NewSizedWriter()\n", s.v)
+	f.printf("if err = func() (err error) {\n")
+	if err := f.block(s.v+".BitWriter", func() error { return f.encodeFields(s.decl.Fields) }); err != nil {
+		return err
+	}
+	f.printf("return nil\n}(); err != nil {\nreturn err\n}\n")
+	f.try("%s, err = %s.Len()", s.n, s.v)
+	return nil
+}
+
+// trailingSkip reports whether the sized block of m ignores bytes its fields
+// leave unread.
+func trailingSkip(m *ast.PacketField) bool {
+	return annotationIdent(ast.FindAnnotation(m.Annotations, "trailing")) == "skip"
+}
+
+// block emits the fields of a sized block, read or written through rw.
+func (f *fn) block(rw string, emit func() error) error {
+	outerRW, outerStart := f.rw, f.start
+	f.rw, f.start = rw, ""
+	defer func() { f.rw, f.start = outerRW, outerStart }()
+	return emit()
+}
@@ -0,0 +1,62 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+// present emits the code written by emit so that it only runs in the
+// versions in which m is present, according to its @since and @until
+// annotations and the version named by @version on the packet.
+func (f *fn) present(m *ast.PacketField, emit func() error) error {
+	since, hasSince := versionBound(m, "since")
+	until, hasUntil := versionBound(m, "until")
+	if !hasSince && !hasUntil {
+		return emit()
+	}
+	a := ast.FindAnnotation(f.p.decl.Annotations, "version")
+	name := annotationIdent(a)
+	if name == "" {
+		return fmt.Errorf("%s: versioned field %s requires @version on %s", m.Type.Pos(), m.Name, f.p.decl.Name)
+	}
+	version, err := f.expr(&ast.IdentifierType{Position: a.Position, Value: name})
+	if err != nil {
+		return err
+	}
+	bounds := fmt.Sprintf("Since: %d, Until: %d", since, until)
+	if !hasUntil {
+		f.g.use("math")
+		bounds = fmt.Sprintf("Since: %d, Until: math.MaxUint64", since)
+	}
+	start := f.buf.Len()
+	f.printf("if (wire.Versions{%s}).Contains(%s) {\n", bounds, version.as(kindUnsigned))
+	body := f.buf.Len()
+	if err := emit(); err != nil {
+		return err
+	}
+	if f.buf.Len() == body {
+		f.buf.Truncate(start)
+		return nil
+	}
+	f.printf("}\n")
+	return nil
+}
+
+// versionBound returns the version given by the @since or @until
+// annotation of m.
+func versionBound(m *ast.PacketField, name string) (uint64, bool) {
+	n, ok := annotationNode(ast.FindAnnotation(m.Annotations, name)).(*ast.NumberLiteralType)
+	if !ok {
+		return 0, false
+	}
+	return n.Value, true
+}
+
+// annotationNode returns the single argument of a, or nil.
+func annotationNode(a *ast.Annotation) ast.Node {
+	if a == nil || len(a.Arguments) != 1 {
+		return nil
+	}
+	return a.Arguments[0].Value
+}
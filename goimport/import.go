@@ -0,0 +1,570 @@
+// Package goimport converts annotated Go struct types to a protodecl schema,
+// so that a service that started from hand-written structs can move to a
+// schema as its source of truth.
+//
+// Each struct type becomes a packet and each field a packet field named in
+// snake_case. Field types follow from the Go types: sized integers, floats
+// and bool map directly, [N]byte becomes Bytes(N), other arrays become
+// Array(T, N), struct types become packet references and named integer
+// types with constants become enums. A pd struct tag refines the mapping:
+//
+//	type Header struct {
+//		Version uint8  `pd:"bits=2"`
+//		_       uint8  `pd:"bits=6"`
+//		Length  uint16 `pd:"u16be"`
+//		Scale   float32 `pd:"f32le"`
+//		Name    string `pd:"len=16"`
+//		Payload []byte `pd:"len=Length"`
+//		Cache   []int  `pd:"-"`
+//	}
+//
+// The first item of the tag may name a protodecl type, such as u16be,
+// f32le, bool or CString. The options are bits=N for a Bits(N) field, or a
+// one bit bool; len=N, len=Field or len=eos for the length of strings,
+// slices and arrays; be and le for the byte order; and name=field to
+// choose the field name. Blank fields become padding, and fields tagged
+// pd:"-" are left out.
+package goimport
+
+import (
+	"fmt"
+	goast "go/ast"
+	"go/build"
+	"go/constant"
+	goimporter "go/importer"
+	goparser "go/parser"
+	gotoken "go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/token"
+)
+
+// Options configures Import.
+type Options struct {
+	// Types names the struct types to convert. By default every struct
+	// type with a pd tag is converted. Types they refer to are converted
+	// as well.
+	Types []string
+}
+
+type importer struct {
+	fset *gotoken.FileSet
+	// typeErr is the first type checking error. Packages often fail to
+	// check completely, for example when a dependency cannot be found, so
+	// it is reported only for fields whose type it leaves unknown.
+	typeErr error
+
+	tree *ast.Tree
+	// decls maps the converted named types to their declarations.
+	decls map[*types.TypeName]ast.Node
+	// consts lists the constants of each named type in source order.
+	consts map[*types.TypeName][]*types.Const
+}
+
+// Import converts the struct types of the Go package in dir to a protodecl
+// tree. Types are declared before the packets that refer to them.
+func Import(dir string, opts Options) (*ast.Tree, error) {
+	bp, err := build.ImportDir(dir, 0)
+	if err != nil {
+		return nil, err
+	}
+	im := &importer{
+		fset:   gotoken.NewFileSet(),
+		tree:   &ast.Tree{PackageName: bp.Name, FileName: bp.Dir},
+		decls:  make(map[*types.TypeName]ast.Node),
+		consts: make(map[*types.TypeName][]*types.Const),
+	}
+	var files []*goast.File
+	for _, name := range append(bp.GoFiles, bp.CgoFiles...) {
+		f, err := goparser.ParseFile(im.fset, filepath.Join(bp.Dir, name), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	conf := types.Config{
+		Importer:    goimporter.ForCompiler(im.fset, "source", nil),
+		FakeImportC: true,
+		Error: func(err error) {
+			if im.typeErr == nil {
+				im.typeErr = err
+			}
+		},
+	}
+	path := bp.ImportPath
+	if path == "." {
+		path = bp.Name
+	}
+	pkg, _ := conf.Check(path, im.fset, files, nil)
+
+	scope := pkg.Scope()
+	objs := make([]types.Object, 0, scope.Len())
+	for _, name := range scope.Names() {
+		objs = append(objs, scope.Lookup(name))
+	}
+	sort.Slice(objs, func(i, j int) bool { return objs[i].Pos() < objs[j].Pos() })
+	for _, obj := range objs {
+		if c, ok := obj.(*types.Const); ok {
+			if named, ok := c.Type().(*types.Named); ok && named.Obj().Pkg() == pkg {
+				im.consts[named.Obj()] = append(im.consts[named.Obj()], c)
+			}
+		}
+	}
+
+	var roots []*types.TypeName
+	if len(opts.Types) > 0 {
+		for _, name := range opts.Types {
+			tn, ok := scope.Lookup(name).(*types.TypeName)
+			if !ok || !isStruct(tn) {
+				return nil, fmt.Errorf("%s is not a struct type of package %s", name, bp.Name)
+			}
+			roots = append(roots, tn)
+		}
+	} else {
+		for _, obj := range objs {
+			if tn, ok := obj.(*types.TypeName); ok && isStruct(tn) && hasTags(tn) {
+				roots = append(roots, tn)
+			}
+		}
+		if len(roots) == 0 {
+			return nil, fmt.Errorf("package %s has no struct type with pd tags", bp.Name)
+		}
+	}
+	for _, tn := range roots {
+		if _, err := im.packet(tn); err != nil {
+			return nil, err
+		}
+	}
+	return im.tree, nil
+}
+
+func isStruct(tn *types.TypeName) bool {
+	_, ok := tn.Type().Underlying().(*types.Struct)
+	return ok
+}
+
+func hasTags(tn *types.TypeName) bool {
+	st := tn.Type().Underlying().(*types.Struct)
+	for i := 0; i < st.NumFields(); i++ {
+		if _, ok := reflect.StructTag(st.Tag(i)).Lookup("pd"); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (im *importer) position(pos gotoken.Pos) token.Position {
+	p := im.fset.Position(pos)
+	return token.Position{File: p.Filename, Line: p.Line, Col: p.Column}
+}
+
+// importError is an error at a position in the package.
+type importError struct {
+	pos gotoken.Position
+	msg string
+}
+
+func (e *importError) Error() string {
+	return fmt.Sprintf("%s: %s", e.pos, e.msg)
+}
+
+func (im *importer) errorf(pos gotoken.Pos, format string, args ...interface{}) error {
+	return &importError{pos: im.fset.Position(pos), msg: fmt.Sprintf(format, args...)}
+}
+
+// packet converts a struct type, and the types it refers to, and returns
+// the name of its packet.
+func (im *importer) packet(tn *types.TypeName) (string, error) {
+	name := safeName(tn.Name())
+	if _, ok := im.decls[tn]; ok {
+		return name, nil
+	}
+	if named, ok := tn.Type().(*types.Named); ok && named.TypeParams().Len() > 0 {
+		return "", im.errorf(tn.Pos(), "generic type %s is not supported", tn.Name())
+	}
+	decl := &ast.PacketType{Position: im.position(tn.Pos()), Name: name}
+	im.decls[tn] = decl
+
+	st := tn.Type().Underlying().(*types.Struct)
+	// names maps Go field names to the fields they became, for len=Field.
+	names := make(map[string]string)
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		tag, err := parseTag(reflect.StructTag(st.Tag(i)).Get("pd"))
+		if err != nil {
+			return "", im.errorf(f.Pos(), "field %s of %s: %v", f.Name(), tn.Name(), err)
+		}
+		if tag.skip {
+			continue
+		}
+		field, err := im.field(f, tag, names)
+		if _, nested := err.(*importError); nested {
+			// The error is in a type the field refers to.
+			return "", err
+		}
+		if err != nil {
+			return "", im.errorf(f.Pos(), "field %s of %s: %v", f.Name(), tn.Name(), err)
+		}
+		names[f.Name()] = field.Name
+		decl.Fields = append(decl.Fields, field)
+	}
+	im.tree.Nodes = append(im.tree.Nodes, decl)
+	return name, nil
+}
+
+func (im *importer) field(f *types.Var, tag fieldTag, names map[string]string) (ast.PacketField, error) {
+	pos := im.position(f.Pos())
+	if f.Name() == "_" {
+		bits := tag.bits
+		if bits < 0 {
+			bits = fixedBits(f.Type())
+		}
+		if bits <= 0 {
+			return ast.PacketField{}, fmt.Errorf("padding of type %s needs bits=N", f.Type())
+		}
+		return ast.PacketField{Name: "_", Type: typeNode(pos, "Padding", number(pos, uint64(bits)))}, nil
+	}
+
+	field := ast.PacketField{Name: tag.name}
+	if field.Name == "" {
+		field.Name = safeName(snakeCase(f.Name()))
+	}
+	var err error
+	switch {
+	case tag.bits >= 0:
+		field.Type, err = bitsType(pos, f.Type(), tag.bits)
+		if isKind(f.Type(), types.IsBoolean) {
+			field.Annotations = append(field.Annotations, &ast.Annotation{Position: pos, Name: "bit"})
+		}
+	case tag.typ != "":
+		field.Type, err = im.taggedType(pos, f.Type(), tag, names)
+	default:
+		field.Type, err = im.goType(pos, f.Type(), tag.length, names)
+	}
+	if err != nil {
+		return ast.PacketField{}, err
+	}
+	if tag.endian != "" {
+		if err := im.setEndian(field.Type, tag.endian); err != nil {
+			return ast.PacketField{}, err
+		}
+	}
+	return field, nil
+}
+
+// bitsType returns the type of a field tagged bits=N.
+func bitsType(pos token.Position, t types.Type, bits int64) (ast.Node, error) {
+	switch {
+	case isKind(t, types.IsBoolean):
+		if bits != 1 {
+			return nil, fmt.Errorf("a bool takes one bit, not bits=%d", bits)
+		}
+		return typeNode(pos, "bool"), nil
+	case isKind(t, types.IsInteger):
+		if size := fixedBits(t); size > 0 && bits > size {
+			return nil, fmt.Errorf("bits=%d is wider than %s", bits, t)
+		}
+		return typeNode(pos, "Bits", number(pos, uint64(bits))), nil
+	}
+	return nil, fmt.Errorf("bits=%d applies only to integer and bool fields", bits)
+}
+
+// taggedType returns the type named by a tag after checking that it suits
+// the Go type t.
+func (im *importer) taggedType(pos token.Position, t types.Type, tag fieldTag, names map[string]string) (ast.Node, error) {
+	node := typeNode(pos, tag.typ)
+	if bits, _, ok := ast.IntegerType(node); ok {
+		if named, ok := t.(*types.Named); ok && len(im.consts[named.Obj()]) > 0 {
+			return nil, fmt.Errorf("the type of enum %s comes from its declaration; use be or le for its byte order", named.Obj().Name())
+		}
+		if !isKind(t, types.IsInteger) {
+			return nil, fmt.Errorf("%s does not suit a field of type %s", tag.typ, t)
+		}
+		if size := fixedBits(t); size > 0 && int64(bits) > size {
+			return nil, fmt.Errorf("%s is wider than %s", tag.typ, t)
+		}
+		return node, nil
+	}
+	if _, _, ok := ast.FloatType(node); ok {
+		if isKind(t, types.IsFloat) {
+			return node, nil
+		}
+		return nil, fmt.Errorf("%s does not suit a field of type %s", tag.typ, t)
+	}
+	switch tag.typ {
+	case "bool":
+		if isKind(t, types.IsBoolean) {
+			return node, nil
+		}
+	case "String", "Bytes", "CString", "Cbytes", "LongString", "LongBytes",
+		"String8le", "String16le", "String32le", "String64le",
+		"String8be", "String16be", "String32be", "String64be",
+		"Bytes8le", "Bytes16le", "Bytes32le", "Bytes64le",
+		"Bytes8be", "Bytes16be", "Bytes32be", "Bytes64be":
+		if !isKind(t, types.IsString) && !isByteSlice(t) {
+			break
+		}
+		if tag.typ == "String" || tag.typ == "Bytes" {
+			count, err := countNode(pos, tag.length, names)
+			if err != nil {
+				return nil, err
+			}
+			if isEOS(count) {
+				return nil, fmt.Errorf("len=eos applies only to slices and arrays")
+			}
+			node.Arguments = []ast.Node{count}
+		}
+		return node, nil
+	default:
+		return nil, fmt.Errorf("unknown type %s", tag.typ)
+	}
+	return nil, fmt.Errorf("%s does not suit a field of type %s", tag.typ, t)
+}
+
+// goType returns the type of a field of Go type t. length is the len
+// option, if any.
+func (im *importer) goType(pos token.Position, t types.Type, length string, names map[string]string) (ast.Node, error) {
+	switch t := t.(type) {
+	case *types.Named:
+		if t.TypeArgs().Len() > 0 {
+			return nil, fmt.Errorf("generic type %s is not supported", t)
+		}
+		switch u := t.Underlying().(type) {
+		case *types.Struct:
+			name, err := im.packet(t.Obj())
+			return typeNode(pos, name), err
+		case *types.Basic:
+			if u.Info()&types.IsInteger != 0 && len(im.consts[t.Obj()]) > 0 {
+				name, err := im.enum(t.Obj())
+				return typeNode(pos, name), err
+			}
+			return im.goType(pos, u, length, names)
+		case *types.Array, *types.Slice:
+			return im.goType(pos, u, length, names)
+		}
+	case *types.Basic:
+		if name, ok := basicTypes[t.Kind()]; ok {
+			return typeNode(pos, name), nil
+		}
+		switch t.Kind() {
+		case types.String:
+			count, err := countNode(pos, length, names)
+			if err != nil {
+				return nil, err
+			}
+			if isEOS(count) {
+				return nil, fmt.Errorf("len=eos applies only to slices and arrays")
+			}
+			return typeNode(pos, "String", count), nil
+		case types.Invalid:
+			return nil, fmt.Errorf("type is unknown: %v", im.typeErr)
+		}
+		return nil, fmt.Errorf("%s has no fixed size; give it a type such as pd:\"u32\"", t)
+	case *types.Array:
+		var count ast.Node = number(pos, uint64(t.Len()))
+		if length != "" {
+			var err error
+			if count, err = countNode(pos, length, names); err != nil {
+				return nil, err
+			}
+		}
+		return im.sequence(pos, t.Elem(), count, names)
+	case *types.Slice:
+		count, err := countNode(pos, length, names)
+		if err != nil {
+			return nil, err
+		}
+		return im.sequence(pos, t.Elem(), count, names)
+	}
+	return nil, fmt.Errorf("%s is not supported", t)
+}
+
+// sequence returns the type of count elements of type elem: Bytes for
+// bytes and Array otherwise, or for eos, which only Array accepts.
+func (im *importer) sequence(pos token.Position, elem types.Type, count ast.Node, names map[string]string) (ast.Node, error) {
+	if b, ok := elem.(*types.Basic); ok && b.Kind() == types.Uint8 && !isEOS(count) {
+		return typeNode(pos, "Bytes", count), nil
+	}
+	node, err := im.goType(pos, elem, "", names)
+	if err != nil {
+		return nil, err
+	}
+	return typeNode(pos, "Array", node, count), nil
+}
+
+// enum converts a named integer type to an enum of its constants.
+// Constants of int and uint types are stored in the smallest unsigned type
+// that holds them.
+func (im *importer) enum(tn *types.TypeName) (string, error) {
+	name := safeName(tn.Name())
+	if _, ok := im.decls[tn]; ok {
+		return name, nil
+	}
+	pos := im.position(tn.Pos())
+	decl := &ast.EnumerationType{Position: pos, Name: name}
+	var max uint64
+	for _, c := range im.consts[tn] {
+		v, exact := constant.Uint64Val(constant.ToInt(c.Val()))
+		if !exact {
+			return "", im.errorf(c.Pos(), "value %s of %s cannot be expressed in protodecl", c.Val(), c.Name())
+		}
+		decl.Values = append(decl.Values, ast.EnumerationValue{
+			Key:   safeName(c.Name()),
+			Value: number(im.position(c.Pos()), v),
+		})
+		if v > max {
+			max = v
+		}
+	}
+
+	storage, ok := basicTypes[tn.Type().Underlying().(*types.Basic).Kind()]
+	if !ok {
+		switch {
+		case max <= 1<<8-1:
+			storage = "u8"
+		case max <= 1<<16-1:
+			storage = "u16"
+		case max <= 1<<32-1:
+			storage = "u32"
+		default:
+			storage = "u64"
+		}
+	}
+	decl.ReturnType = typeNode(pos, storage)
+	im.decls[tn] = decl
+	im.tree.Nodes = append(im.tree.Nodes, decl)
+	return name, nil
+}
+
+// basicTypes maps the Go types of fixed size to protodecl types.
+var basicTypes = map[types.BasicKind]string{
+	types.Bool:    "bool",
+	types.Int8:    "i8",
+	types.Int16:   "i16",
+	types.Int32:   "i32",
+	types.Int64:   "i64",
+	types.Uint8:   "u8",
+	types.Uint16:  "u16",
+	types.Uint32:  "u32",
+	types.Uint64:  "u64",
+	types.Float32: "f32",
+	types.Float64: "f64",
+}
+
+// fixedBits returns the size in bits of a fixed-size integer, float or bool
+// type, or an array of one, or 0.
+func fixedBits(t types.Type) int64 {
+	switch t := t.Underlying().(type) {
+	case *types.Basic:
+		if name, ok := basicTypes[t.Kind()]; ok {
+			if name == "bool" {
+				return 8
+			}
+			bits, _ := strconv.Atoi(name[1:])
+			return int64(bits)
+		}
+	case *types.Array:
+		return t.Len() * fixedBits(t.Elem())
+	}
+	return 0
+}
+
+func isKind(t types.Type, info types.BasicInfo) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&info != 0
+}
+
+func isByteSlice(t types.Type) bool {
+	s, ok := t.Underlying().(*types.Slice)
+	return ok && isKind(s.Elem(), types.IsInteger) && fixedBits(s.Elem()) == 8
+}
+
+// countNode returns the count of a String, Bytes or Array field from its
+// len option.
+func countNode(pos token.Position, length string, names map[string]string) (ast.Node, error) {
+	if length == "" {
+		return nil, fmt.Errorf("a length is needed, as in len=16 or len=Field")
+	}
+	if length == "eos" {
+		return &ast.IdentifierType{Position: pos, Value: "eos"}, nil
+	}
+	if n, err := strconv.ParseUint(length, 0, 64); err == nil {
+		return number(pos, n), nil
+	}
+	if name, ok := names[length]; ok {
+		return &ast.IdentifierType{Position: pos, Value: name}, nil
+	}
+	return nil, fmt.Errorf("len=%s does not name an earlier field", length)
+}
+
+func isEOS(count ast.Node) bool {
+	id, ok := count.(*ast.IdentifierType)
+	return ok && id.Value == "eos"
+}
+
+// setEndian gives the numbers of n the byte order endian through their
+// type names. The byte order of an enum is that of its storage type, which
+// its fields share.
+func (im *importer) setEndian(n ast.Node, endian string) error {
+	t, ok := n.(*ast.TypeType)
+	if !ok {
+		return fmt.Errorf("be and le do not apply to %s", ast.ExprString(n))
+	}
+	if t.TypeName == "Array" {
+		return im.setEndian(t.Arguments[0], endian)
+	}
+	if _, _, ok := ast.IntegerType(t); ok {
+		return orderType(t, endian)
+	}
+	if _, _, ok := ast.FloatType(t); ok {
+		return orderType(t, endian)
+	}
+	switch t.TypeName {
+	case "bool", "Bits", "Bytes", "String":
+		// The byte order does not apply.
+		return nil
+	}
+	for _, decl := range im.decls {
+		if e, ok := decl.(*ast.EnumerationType); ok && e.Name == t.TypeName {
+			if err := orderType(e.ReturnType.(*ast.TypeType), endian); err != nil {
+				return fmt.Errorf("enum %s: %v", e.Name, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("be and le apply only to numbers, enums and arrays of them, not %s", t.TypeName)
+}
+
+// orderType appends the suffix of the byte order endian to the name of the
+// integer or float type t. Types of a single byte have no byte order.
+func orderType(t *ast.TypeType, endian string) error {
+	suffix := "le"
+	if endian == "big" {
+		suffix = "be"
+	}
+	name := t.TypeName
+	switch {
+	case name == "u8" || name == "i8":
+	case strings.HasSuffix(name, "le") || strings.HasSuffix(name, "be"):
+		if !strings.HasSuffix(name, suffix) {
+			return fmt.Errorf("%s is not %s-endian", name, endian)
+		}
+	default:
+		t.TypeName += suffix
+	}
+	return nil
+}
+
+func typeNode(pos token.Position, name string, args ...ast.Node) *ast.TypeType {
+	return &ast.TypeType{Position: pos, TypeName: name, Arguments: args}
+}
+
+func number(pos token.Position, v uint64) *ast.NumberLiteralType {
+	return &ast.NumberLiteralType{Position: pos, Value: v}
+}
@@ -0,0 +1,84 @@
+package goimport
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/unsafe-risk/protodecl/printer"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+func TestImportGolden(t *testing.T) {
+	tests := []struct {
+		dir    string
+		golden string
+		opts   Options
+	}{
+		{"tags", "tags.pd", Options{}},
+		{"nested", "nested.pd", Options{}},
+		{"nested", "segment.pd", Options{Types: []string{"Segment"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.golden, func(t *testing.T) {
+			tree, err := Import(filepath.Join("testdata", tt.dir), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tree.FileName = ""
+			got, err := printer.Print(tree)
+			if err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", tt.golden)
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("Import(%s) =\n%s\nwant\n%s", tt.dir, got, want)
+			}
+		})
+	}
+}
+
+func TestImportErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"type T struct { A int `pd:\"\"` }", "int has no fixed size"},
+		{"type T struct { A map[string]int `pd:\"\"` }", "map[string]int is not supported"},
+		{"type T struct { A *int32 `pd:\"\"` }", "*int32 is not supported"},
+		{"type T struct { A chan int `pd:\"\"` }", "chan int is not supported"},
+		{"type T struct { A []uint16 `pd:\"\"` }", "a length is needed"},
+		{"type T struct { A string `pd:\"len=eos\"` }", "len=eos applies only to slices and arrays"},
+		{"type T struct { A uint8 `pd:\"bits=9\"` }", "bits=9 is wider than uint8"},
+		{"type T struct { A float32 `pd:\"u32\"` }", "u32 does not suit a field of type float32"},
+		{"type T struct { A int32 `pd:\"f32\"` }", "f32 does not suit a field of type int32"},
+		{"type T struct { A uint16 `pd:\"u16le,be\"` }", "u16le is not big-endian"},
+		{"type P struct { X uint8 }\ntype T struct { A P `pd:\"le\"` }", "be and le apply only to numbers"},
+		{"type G[X any] struct { V X }\ntype T struct { A G[int32] `pd:\"\"` }", "generic type"},
+		{"type T struct { A uint8 `pd:\"u8,size=2\"` }", "unknown item \"size=2\""},
+		{"type T struct { A uint8 `pd:\"len\"` }", "unknown type len"},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		src := "package p\n\n" + tt.src + "\n"
+		if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		_, err := Import(dir, Options{})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Import(%q) = %v, want an error containing %q", tt.src, err, tt.want)
+		}
+	}
+}
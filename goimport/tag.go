@@ -0,0 +1,107 @@
+package goimport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/unsafe-risk/protodecl/parser"
+	"github.com/unsafe-risk/protodecl/token"
+)
+
+// fieldTag is a parsed pd struct tag.
+type fieldTag struct {
+	// skip is set by pd:"-".
+	skip bool
+	// typ is the protodecl type named by the tag, or empty to derive it
+	// from the Go type.
+	typ string
+	// endian is "big" or "little" for the be and le items.
+	endian string
+	// bits is the width given by bits=N, or -1.
+	bits int64
+	// length is the len=N, len=Field or len=eos item.
+	length string
+	// name replaces the field name derived from the Go name.
+	name string
+}
+
+// parseTag parses the value of a pd struct tag: an optional type followed
+// by comma separated options, as in pd:"u16be", pd:"bits=2" or
+// pd:"len=Count,name=items".
+func parseTag(tag string) (fieldTag, error) {
+	t := fieldTag{bits: -1}
+	if tag == "-" {
+		t.skip = true
+		return t, nil
+	}
+	if tag == "" {
+		return t, nil
+	}
+	for i, item := range strings.Split(tag, ",") {
+		item = strings.TrimSpace(item)
+		key, value, hasValue := strings.Cut(item, "=")
+		switch {
+		case !hasValue && (item == "be" || item == "le"):
+			t.endian = endianName(item)
+		case !hasValue && i == 0 && item != "":
+			t.typ = item
+		case key == "bits":
+			n, err := strconv.ParseInt(value, 0, 64)
+			if err != nil || n < 1 || n > 64 {
+				return t, fmt.Errorf("bits=%s is not a width from 1 to 64", value)
+			}
+			t.bits = n
+		case key == "len" && value != "":
+			t.length = value
+		case key == "name" && value != "":
+			t.name = value
+		default:
+			return t, fmt.Errorf("unknown item %q", item)
+		}
+	}
+	if t.typ != "" && t.bits >= 0 {
+		return t, fmt.Errorf("bits=%d cannot be combined with the type %s", t.bits, t.typ)
+	}
+	return t, nil
+}
+
+func endianName(suffix string) string {
+	if suffix == "be" {
+		return "big"
+	}
+	return "little"
+}
+
+// snakeCase converts a Go name to the snake_case used for protodecl
+// fields, keeping initialisms together: PacketID becomes packet_id and
+// HTTPStatus http_status.
+func snakeCase(name string) string {
+	runes := []rune(name)
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			if i > 0 && runes[i-1] != '_' && (!unicode.IsUpper(runes[i-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// safeName appends an underscore to names that are protodecl keywords or
+// otherwise reserved.
+func safeName(name string) string {
+	if name == "offset" || name == "last" {
+		return name + "_"
+	}
+	// The lexer needs a character after the name to end it.
+	t, err := parser.NewLexer("", []rune(name+" ")).NextToken()
+	if err != nil || t.Type != token.Identifier || t.Value != name {
+		return name + "_"
+	}
+	return name
+}
@@ -0,0 +1,23 @@
+package nested
+
+type Point struct {
+	X int32 `pd:"le"`
+	Y int32 `pd:"le"`
+}
+
+type Segment struct {
+	From Point
+	To   Point
+}
+
+type Path struct {
+	Count    uint8     `pd:"u8"`
+	Segments []Segment `pd:"len=Count"`
+	Origin   Point
+	Tags     [2][3]byte
+}
+
+// Unrelated has no pd tags and is not converted.
+type Unrelated struct {
+	A int
+}
@@ -0,0 +1,28 @@
+package tags
+
+type Kind uint16
+
+const (
+	KindPing Kind = 1
+	KindPong Kind = 2
+)
+
+type Header struct {
+	Version  uint8    `pd:"bits=2"`
+	_        uint8    `pd:"bits=6"`
+	Flag     bool     `pd:"bits=1"`
+	_        uint8    `pd:"bits=7"`
+	Length   uint16   `pd:"u16be"`
+	Counter  uint32   `pd:"le"`
+	Kind     Kind     `pd:"le"`
+	Scale    float32  `pd:"f32le"`
+	Ratio    float64  `pd:"be"`
+	Samples  [4]int16 `pd:"le"`
+	Name     string   `pd:"len=16"`
+	Label    string   `pd:"CString"`
+	Raw      []byte   `pd:"Cbytes"`
+	Payload  []byte   `pd:"len=Length"`
+	HTTPCode uint16
+	Trailer  []uint32 `pd:"len=eos,be,name=tail"`
+	Cache    []int    `pd:"-"`
+}
@@ -1,16 +1,119 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"os"
+	"strings"
 
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/check"
+	"github.com/unsafe-risk/protodecl/cimport"
 	"github.com/unsafe-risk/protodecl/compile"
+	"github.com/unsafe-risk/protodecl/goimport"
 	"github.com/unsafe-risk/protodecl/parser"
+	"github.com/unsafe-risk/protodecl/printer"
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import-c":
+			importC(os.Args[2:])
+			return
+		case "import-go":
+			importGo(os.Args[2:])
+			return
+		}
+	}
+
 	ast, file, err := parser.ParseFile("example.protodecl")
 	if err != nil {
 		log.Fatalln(parser.ErrorPrint(err, string(file)))
 	}
-	compile.Compile(ast)
+
+	diagnostics := check.Check(ast)
+	lines := strings.Split(string(file), "\n")
+	for _, d := range diagnostics {
+		log.Println(parser.CodeError(lines, d.Position.Line, d.Position.Col, 1, d.Position.File, d.Severity.String()+": "+d.Message))
+	}
+	if check.HasErrors(diagnostics) {
+		os.Exit(1)
+	}
+
+	out, err := compile.Compile(ast)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	os.Stdout.Write(out)
+}
+
+// importC implements `protodecl import-c [-big-endian] header.h`, which
+// writes a schema equivalent to the structs and enums of a C header.
+func importC(args []string) {
+	flags := flag.NewFlagSet("import-c", flag.ExitOnError)
+	bigEndian := flags.Bool("big-endian", false, "the target stores multi-byte values big-endian")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: protodecl import-c [-big-endian] header.h")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	src, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		log.Fatalln(err)
+	}
+	tree, err := cimport.Import(flags.Arg(0), src, cimport.Options{BigEndian: *bigEndian})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	printSchema(tree)
+}
+
+// importGo implements `protodecl import-go [-type T,U] [dir]`, which writes
+// a schema for the struct types of the Go package in dir.
+func importGo(args []string) {
+	flags := flag.NewFlagSet("import-go", flag.ExitOnError)
+	typeNames := flags.String("type", "", "comma separated struct types to convert; by default those with pd tags")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "usage: protodecl import-go [-type T,U] [dir]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+
+	var opts goimport.Options
+	if *typeNames != "" {
+		opts.Types = strings.Split(*typeNames, ",")
+	}
+	tree, err := goimport.Import(dir, opts)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	printSchema(tree)
+}
+
+// printSchema writes an imported tree to stdout, logging what the checker
+// finds in it.
+func printSchema(tree *ast.Tree) {
+	for _, d := range check.Check(tree) {
+		log.Printf("%s: %s: %s", d.Position, d.Severity, d.Message)
+	}
+	out, err := printer.Print(tree)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	os.Stdout.Write(out)
 }
@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"fmt"
+
+	"github.com/unsafe-risk/protodecl/ast"
+	"github.com/unsafe-risk/protodecl/token"
+)
+
+// parseExpression parses a binary expression over numbers, identifiers,
+// field selectors and parenthesized subexpressions.
+func (p *Parser) parseExpression() (ast.Node, error) {
+	return p.parseBinaryExpression(1)
+}
+
+func (p *Parser) parseBinaryExpression(minPrecedence int) (ast.Node, error) {
+	left, err := p.parseUnaryExpression()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		tkn := p.Tokens[p.Position]
+		if isWord(tkn, "in") && ast.InPrecedence >= minPrecedence {
+			left, err = p.parseInExpression(left)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		precedence, ok := ast.BinaryPrecedence[tkn.Value]
+		if tkn.Type != token.Operator || !ok || precedence < minPrecedence {
+			return left, nil
+		}
+		p.Position++
+		right, err := p.parseBinaryExpression(precedence + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &ast.BinaryExpression{
+			Position: tkn.Position,
+			Operator: tkn.Value,
+			Left:     left,
+			Right:    right,
+		}
+	}
+}
+
+// parseInExpression parses `in low..high` or `in [range, ...]` after the
+// operand. It binds like a comparison.
+func (p *Parser) parseInExpression(operand ast.Node) (*ast.InExpression, error) {
+	in := &ast.InExpression{
+		Position: p.Tokens[p.Position].Position,
+		Operand:  operand,
+	}
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if tkn := p.Tokens[p.Position]; tkn.Type != token.Delimiter || tkn.Value != "[" {
+		r, err := p.parseRange()
+		if err != nil {
+			return nil, err
+		}
+		in.Ranges = []*ast.RangeType{r}
+		return in, nil
+	}
+	p.Position++
+	for {
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		tkn := p.Tokens[p.Position]
+		if tkn.Type == token.Delimiter && tkn.Value == "]" {
+			p.Position++
+			return in, nil
+		}
+		if len(in.Ranges) > 0 {
+			if tkn.Type != token.Delimiter || tkn.Value != "," {
+				return nil, p.error(fmt.Sprintf("expected ',' or ']' but got %s", tkn))
+			}
+			p.Position++
+			p.skipComments()
+		}
+		r, err := p.parseRange()
+		if err != nil {
+			return nil, err
+		}
+		in.Ranges = append(in.Ranges, r)
+	}
+}
+
+func (p *Parser) parseUnaryExpression() (ast.Node, error) {
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	tkn := p.Tokens[p.Position]
+	switch {
+	case tkn.Type == token.Operator && (tkn.Value == "-" || tkn.Value == "!" || tkn.Value == "~"):
+		p.Position++
+		operand, err := p.parseUnaryExpression()
+		if err != nil {
+			return nil, err
+		}
+		return &ast.UnaryExpression{
+			Position: tkn.Position,
+			Operator: tkn.Value,
+			Operand:  operand,
+		}, nil
+	case tkn.Type == token.Delimiter && tkn.Value == "(":
+		p.Position++
+		expr, err := p.parseExpression()
+		if err != nil {
+			return nil, err
+		}
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ")" {
+			return nil, p.error(fmt.Sprintf("expected ')' but got %s", p.Tokens[p.Position]))
+		}
+		p.Position++
+		return expr, nil
+	default:
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		return p.parseSelectors(value)
+	}
+}
+
+// parseSelectors parses any `.field` selectors following an operand.
+func (p *Parser) parseSelectors(operand ast.Node) (ast.Node, error) {
+	for {
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		tkn := p.Tokens[p.Position]
+		if tkn.Type != token.Delimiter || tkn.Value != "." {
+			return operand, nil
+		}
+		p.Position++
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		field := p.Tokens[p.Position]
+		if field.Type != token.Identifier {
+			return nil, p.error(fmt.Sprintf("expected field name but got %s", field))
+		}
+		p.Position++
+		operand = &ast.SelectorExpression{
+			Position: tkn.Position,
+			Operand:  operand,
+			Field:    field.Value,
+		}
+	}
+}
@@ -2,9 +2,11 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/unsafe-risk/protodecl/token"
 )
@@ -88,6 +90,123 @@ func (l *Lexer) readIdentifier() string {
 	return string(l.Data[position:l.Position])
 }
 
+// readCharLiteral reads a quoted character such as 'P' or '\n' and returns
+// it as a Number token holding its code point.
+func (l *Lexer) readCharLiteral() (token.Token, error) {
+	line, col := l.Line, l.Col-1
+	position := l.Position
+	for {
+		if !l.readChar() || l.CurrentChar == '\n' {
+			return l.newToken(token.TokenType{Type: token.Number}), l.dumpError("unterminated character literal")
+		}
+		if l.CurrentChar == '\\' {
+			if !l.readChar() {
+				return l.newToken(token.TokenType{Type: token.Number}), l.dumpError("unterminated character literal")
+			}
+			continue
+		}
+		if l.CurrentChar == '\'' {
+			break
+		}
+	}
+	literal := string(l.Data[position+1 : l.Position])
+	l.readChar()
+
+	value, _, tail, err := strconv.UnquoteChar(literal, '\'')
+	if err != nil || tail != "" {
+		return l.newToken(token.TokenType{Type: token.Number}), l.dumpError("invalid character literal " + strconv.Quote(literal))
+	}
+	t := l.newToken(token.TokenType{Type: token.Number, Value: strconv.FormatUint(uint64(value), 10)})
+	t.Line, t.Col = line, col
+	return t, nil
+}
+
+// readFraction reads the fractional part and optional exponent of a decimal
+// literal, starting at the '.'.
+func (l *Lexer) readFraction() string {
+	position := l.Position
+	l.readChar()
+	l.readDigits()
+	if l.CurrentChar == 'e' || l.CurrentChar == 'E' {
+		l.readChar()
+		if l.CurrentChar == '+' || l.CurrentChar == '-' {
+			l.readChar()
+		}
+		l.readDigits()
+	}
+	return string(l.Data[position:l.Position])
+}
+
+func (l *Lexer) readDigits() {
+	for unicode.IsDigit(l.CurrentChar) {
+		if !l.readChar() {
+			break
+		}
+	}
+}
+
+// readString reads a double-quoted string with Go escapes. An unterminated
+// string is reported at its opening quote and a bad escape at its backslash.
+func (l *Lexer) readString() (token.Token, error) {
+	line, col := l.Line, l.Col-1
+	position := l.Position
+	for {
+		if !l.readChar() || l.CurrentChar == '\n' {
+			return l.newToken(token.TokenType{Type: token.String}), l.errorAt(line, col, position, "unterminated string literal")
+		}
+		if l.CurrentChar == '\\' {
+			if !l.readChar() || l.CurrentChar == '\n' {
+				return l.newToken(token.TokenType{Type: token.String}), l.errorAt(line, col, position, "unterminated string literal")
+			}
+			continue
+		}
+		if l.CurrentChar == '"' {
+			break
+		}
+	}
+	body := l.Data[position+1 : l.Position]
+	l.readChar()
+
+	var value strings.Builder
+	for i := 0; i < len(body); {
+		s := string(body[i:])
+		c, multibyte, tail, err := strconv.UnquoteChar(s, '"')
+		if err != nil {
+			return l.newToken(token.TokenType{Type: token.String}), l.errorAt(line, col+1+i, position+1+i, "invalid escape in string literal")
+		}
+		if c < utf8.RuneSelf || !multibyte {
+			value.WriteByte(byte(c))
+		} else {
+			value.WriteRune(c)
+		}
+		i += utf8.RuneCountInString(s[:len(s)-len(tail)])
+	}
+	t := l.newToken(token.TokenType{Type: token.String, Value: value.String()})
+	t.Line, t.Col = line, col
+	return t, nil
+}
+
+// readRawString reads a backquoted string, which has no escapes and may span
+// lines. Carriage returns are dropped, as in Go.
+func (l *Lexer) readRawString() (token.Token, error) {
+	line, col := l.Line, l.Col-1
+	position := l.Position
+	for {
+		if !l.readChar() {
+			return l.newToken(token.TokenType{Type: token.String}), l.errorAt(line, col, position, "unterminated raw string literal")
+		}
+		if l.CurrentChar == '`' {
+			break
+		}
+	}
+	value := strings.ReplaceAll(string(l.Data[position+1:l.Position]), "\r", "")
+	l.readChar()
+
+	t := l.newToken(token.TokenType{Type: token.String, Value: value})
+	t.Line, t.Col = line, col
+	return t, nil
+}
+
 func (l *Lexer) nextChar() (c rune, ok bool) {
 	if l.Cursor >= len(l.Data) {
 		return '\n', false
@@ -95,6 +214,21 @@ func (l *Lexer) nextChar() (c rune, ok bool) {
 	return l.Data[l.Cursor], true
 }
 
+// maxNumberBits is the width of the widest integer type, u128.
+const maxNumberBits = 128
+
+// parseNumberLiteral parses digits in base and returns them in decimal.
+func parseNumberLiteral(digits string, base int) (string, error) {
+	n, ok := new(big.Int).SetString(digits, base)
+	if !ok || n.Sign() < 0 {
+		return "", fmt.Errorf("invalid syntax %q", digits)
+	}
+	if n.BitLen() > maxNumberBits {
+		return "", fmt.Errorf("%q overflows %d bits", digits, maxNumberBits)
+	}
+	return n.String(), nil
+}
+
 type LexerError struct {
 	Message  string
 	Filename string
@@ -117,6 +251,18 @@ func (l *Lexer) dumpError(msg string) *LexerError {
 	}
 }
 
+// errorAt returns an error at an earlier position, such as the start of the
+// current token.
+func (l *Lexer) errorAt(line, col, index int, msg string) *LexerError {
+	return &LexerError{
+		Message:  msg,
+		Filename: l.FileName,
+		Line:     line,
+		Col:      col,
+		Index:    index,
+	}
+}
+
 func (l *Lexer) NextToken() (t token.Token, err error) {
 	if !l.skipWhitespace() {
 		return l.newToken(token.TokenType{Type: token.EOF}), nil
@@ -181,9 +327,32 @@ func (l *Lexer) NextToken() (t token.Token, err error) {
 		}
 	case '+', '-', '*', '%', '=', '<', '>', '!', '&', '|', '^', '~':
 		t := l.newToken(token.TokenType{Type: token.Operator, Value: string(l.CurrentChar)})
+		if nextC, ok := l.nextChar(); ok {
+			switch op := string([]rune{l.CurrentChar, nextC}); op {
+			case "==", "!=", "<=", ">=", "&&", "||", "<<", ">>":
+				t.Value = op
+				l.readChar()
+			}
+		}
 		l.readChar()
 		return t, nil
-	case '{', '}', '(', ')', '[', ']', ';', ':', '.', ',':
+	case '.':
+		if nextC, ok := l.nextChar(); ok && nextC == '.' {
+			t := l.newToken(token.TokenType{Type: token.Operator, Value: ".."})
+			l.readChar()
+			l.readChar()
+			return t, nil
+		}
+		t := l.newToken(token.TokenType{Type: token.Delimiter, Value: "."})
+		l.readChar()
+		return t, nil
+	case '\'':
+		return l.readCharLiteral()
+	case '"':
+		return l.readString()
+	case '`':
+		return l.readRawString()
+	case '{', '}', '(', ')', '[', ']', ';', ':', ',', '@':
 		t := l.newToken(token.TokenType{Type: token.Delimiter, Value: string(l.CurrentChar)})
 		l.readChar()
 		return t, nil
@@ -202,11 +371,14 @@ func (l *Lexer) NextToken() (t token.Token, err error) {
 			"String8le", "String16le", "String32le", "String64le",
 			"String8be", "String16be", "String32be", "String64be",
 			"Array", "Padding", "Bits",
-			"f32", "f64",
-			"true", "false":
+			"f32", "f64":
 			t := l.newToken(token.TokenType{Type: token.Keyword, Value: id})
 			t.Line, t.Col = line, col
 			return t, nil
+		case "true", "false":
+			t := l.newToken(token.TokenType{Type: token.Boolean, Value: id})
+			t.Line, t.Col = line, col
+			return t, nil
 		default:
 			// t := l.newToken(token.TokenType{Type: token.Identifier, Value: id})
 			// t.Line, t.Col = line, col
@@ -222,33 +394,39 @@ func (l *Lexer) NextToken() (t token.Token, err error) {
 			if id[0] >= '0' && id[0] <= '9' {
 				if strings.HasPrefix(id, "0x") {
 					// parse hex number
-					num, err := strconv.ParseUint(id[2:], 16, 64)
+					num, err := parseNumberLiteral(id[2:], 16)
 					if err != nil {
 						return l.newToken(token.TokenType{Type: token.Number}), l.dumpError("invalid hex number (Error: " + strconv.Quote(err.Error()) + ")")
 					}
-					t := l.newToken(token.TokenType{Type: token.Number, Value: id[2:]})
+					t := l.newToken(token.TokenType{Type: token.Number, Value: num})
 					t.Line, t.Col = line, col
-					t.Value = strconv.FormatUint(num, 10)
 					return t, nil
 				} else if strings.HasPrefix(id, "0b") {
 					// parse binary number
-					num, err := strconv.ParseUint(id[2:], 2, 64)
+					num, err := parseNumberLiteral(id[2:], 2)
 					if err != nil {
 						return l.newToken(token.TokenType{Type: token.Number}), l.dumpError("invalid binary number (Error: " + strconv.Quote(err.Error()) + ")")
 					}
-					t := l.newToken(token.TokenType{Type: token.Number, Value: id[2:]})
+					t := l.newToken(token.TokenType{Type: token.Number, Value: num})
+					t.Line, t.Col = line, col
+					return t, nil
+				} else if next, ok := l.nextChar(); ok && l.CurrentChar == '.' && unicode.IsDigit(next) {
+					// parse decimal fraction
+					text := id + l.readFraction()
+					if _, err := strconv.ParseFloat(text, 64); err != nil {
+						return l.newToken(token.TokenType{Type: token.Float}), l.dumpError("invalid decimal number (Error: " + strconv.Quote(err.Error()) + ")")
+					}
+					t := l.newToken(token.TokenType{Type: token.Float, Value: text})
 					t.Line, t.Col = line, col
-					t.Value = strconv.FormatUint(num, 10)
 					return t, nil
 				} else {
 					// parse decimal number
-					num, err := strconv.ParseUint(id, 10, 64)
+					num, err := parseNumberLiteral(id, 10)
 					if err != nil {
 						return l.newToken(token.TokenType{Type: token.Number}), l.dumpError("invalid decimal number (Error: " + strconv.Quote(err.Error()) + ")")
 					}
-					t := l.newToken(token.TokenType{Type: token.Number, Value: id})
+					t := l.newToken(token.TokenType{Type: token.Number, Value: num})
 					t.Line, t.Col = line, col
-					t.Value = strconv.FormatUint(num, 10)
 					return t, nil
 				}
 			}
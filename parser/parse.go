@@ -2,6 +2,8 @@ package parser
 
 import (
 	"fmt"
+	"math/big"
+	"math/bits"
 	"strconv"
 
 	"github.com/unsafe-risk/protodecl/ast"
@@ -79,24 +81,48 @@ func (p *Parser) Parse() error {
 
 	for p.Position < len(p.Tokens) {
 		p.skipComments()
+		annotations, err := p.parseAnnotations()
+		if err != nil {
+			return err
+		}
 		switch p.Tokens[p.Position].Type {
 		case token.Number:
 			return p.error("unexpected numberLiteral " + p.Tokens[p.Position].Value)
 		case token.Identifier:
-			return p.error(fmt.Sprintf("unexpected identifier %s", p.Tokens[p.Position].Value))
+			if !p.atFlags() {
+				return p.error(fmt.Sprintf("unexpected identifier %s", p.Tokens[p.Position].Value))
+			}
+			fallthrough
 		case token.Keyword:
 			switch p.Tokens[p.Position].Value {
-			case "enum", "packet", "protocol":
+			case "enum", "flags", "packet", "message", "protocol":
 				n, err := p.parseType()
 				if err != nil {
 					return err
 				}
+				switch n := n.(type) {
+				case *ast.EnumerationType:
+					n.Annotations = annotations
+				case *ast.FlagsType:
+					n.Annotations = annotations
+				case *ast.PacketType:
+					n.Annotations = annotations
+				case *ast.MessageType:
+					n.Annotations = annotations
+				default:
+					if len(annotations) > 0 {
+						return newParserError(p.Tokens, p.Position-1, "annotations are not allowed here")
+					}
+				}
 				p.Out.Nodes = append(p.Out.Nodes, n)
 			default:
 				return p.error(fmt.Sprintf("unexpected keyword %s", p.Tokens[p.Position].Value))
 			}
 		default:
 			if p.Tokens[p.Position].Type == token.EOF {
+				if len(annotations) > 0 {
+					return p.error("expected declaration after annotation but got EOF")
+				}
 				return nil
 			}
 			return p.error(fmt.Sprintf("unexpected token %s", p.Tokens[p.Position]))
@@ -108,18 +134,186 @@ func (p *Parser) Parse() error {
 
 func (p *Parser) parseNumber() (*ast.NumberLiteralType, error) {
 	tkn := p.Tokens[p.Position]
-	value, err := strconv.ParseUint(tkn.Value, 10, 64)
-	if err != nil {
-		return nil, p.error(err.Error())
+	value, ok := new(big.Int).SetString(tkn.Value, 10)
+	if !ok || value.Sign() < 0 || value.BitLen() > 128 {
+		return nil, p.error(fmt.Sprintf("invalid number literal %s", tkn.Value))
 	}
 	p.Position++
 
+	high := new(big.Int).Rsh(value, 64)
 	return &ast.NumberLiteralType{
 		Position: tkn.Position,
-		Value:    value,
+		Value:    new(big.Int).Sub(value, new(big.Int).Lsh(high, 64)).Uint64(),
+		High:     high.Uint64(),
 	}, nil
 }
 
+// increment adds one to a 128-bit value split into low and high halves.
+func increment(low, high uint64) (uint64, uint64) {
+	low, carry := bits.Add64(low, 1, 0)
+	return low, high + carry
+}
+
+func (p *Parser) parseValue() (ast.Node, error) {
+	p.skipComments()
+	tkn := p.Tokens[p.Position]
+	switch tkn.Type {
+	case token.Number:
+		return p.parseNumber()
+	case token.Float:
+		value, err := strconv.ParseFloat(tkn.Value, 64)
+		if err != nil {
+			return nil, p.error(fmt.Sprintf("invalid number literal %s", tkn.Value))
+		}
+		p.Position++
+		return &ast.FloatLiteralType{
+			Position: tkn.Position,
+			Value:    value,
+		}, nil
+	case token.String:
+		p.Position++
+		return &ast.StringLiteralType{
+			Position: tkn.Position,
+			Value:    tkn.Value,
+		}, nil
+	case token.Boolean:
+		p.Position++
+		return &ast.BooleanLiteralType{
+			Position: tkn.Position,
+			Value:    tkn.Value == "true",
+		}, nil
+	case token.Identifier:
+		p.Position++
+		return &ast.IdentifierType{
+			Position: tkn.Position,
+			Value:    tkn.Value,
+		}, nil
+	default:
+		return nil, p.error(fmt.Sprintf("expected identifier or number but got %s", tkn))
+	}
+}
+
+// parseArrayLiteral parses `[value, ...]`.
+func (p *Parser) parseArrayLiteral() (*ast.ArrayLiteralType, error) {
+	tkn := p.Tokens[p.Position]
+	if tkn.Type != token.Delimiter || tkn.Value != "[" {
+		return nil, p.error(fmt.Sprintf("expected '[' but got %s", tkn))
+	}
+	p.Position++
+	array := &ast.ArrayLiteralType{Position: tkn.Position}
+	for {
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		tkn = p.Tokens[p.Position]
+		if tkn.Type == token.Delimiter && tkn.Value == "]" {
+			p.Position++
+			return array, nil
+		}
+		if len(array.Elements) > 0 {
+			if tkn.Type != token.Delimiter || tkn.Value != "," {
+				return nil, p.error(fmt.Sprintf("expected ',' or ']' but got %s", tkn))
+			}
+			p.Position++
+		}
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		array.Elements = append(array.Elements, value)
+	}
+}
+
+func (p *Parser) parseAnnotations() ([]*ast.Annotation, error) {
+	var annotations []*ast.Annotation
+	for {
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		tkn := p.Tokens[p.Position]
+		if tkn.Type != token.Delimiter || tkn.Value != "@" {
+			return annotations, nil
+		}
+		position := tkn.Position
+		p.Position++
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+
+		tkn = p.Tokens[p.Position]
+		if tkn.Type != token.Identifier && tkn.Type != token.Keyword {
+			return nil, p.error(fmt.Sprintf("expected annotation name but got %s", tkn))
+		}
+		annotation := &ast.Annotation{
+			Position: position,
+			Name:     tkn.Value,
+		}
+		p.Position++
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+
+		tkn = p.Tokens[p.Position]
+		if tkn.Type == token.Delimiter && tkn.Value == "(" {
+			p.Position++
+			for {
+				p.skipComments()
+				if !p.lenCheck() {
+					return nil, p.error("unexpected EOF")
+				}
+				tkn = p.Tokens[p.Position]
+				if tkn.Type == token.Delimiter && tkn.Value == ")" {
+					p.Position++
+					break
+				}
+				if len(annotation.Arguments) > 0 {
+					if tkn.Type != token.Delimiter || tkn.Value != "," {
+						return nil, p.error(fmt.Sprintf("expected ',' or ')' but got %s", tkn))
+					}
+					p.Position++
+					p.skipComments()
+					if !p.lenCheck() {
+						return nil, p.error("unexpected EOF")
+					}
+					tkn = p.Tokens[p.Position]
+				}
+
+				var arg ast.AnnotationArgument
+				if tkn.Type == token.Identifier && p.Position+1 < len(p.Tokens) &&
+					p.Tokens[p.Position+1].Type == token.Operator && p.Tokens[p.Position+1].Value == "=" {
+					arg.Key = tkn.Value
+					p.Position += 2
+				}
+				p.skipComments()
+				if !p.lenCheck() {
+					return nil, p.error("unexpected EOF")
+				}
+				if tkn = p.Tokens[p.Position]; tkn.Type == token.Keyword && (p.peekDelimiter(",") || p.peekDelimiter(")")) {
+					// A keyword on its own is a name, as in @at(0, from = packet).
+					arg.Value = &ast.IdentifierType{
+						Position: tkn.Position,
+						Value:    tkn.Value,
+					}
+					p.Position++
+				} else {
+					value, err := p.parseExpression()
+					if err != nil {
+						return nil, err
+					}
+					arg.Value = value
+				}
+				annotation.Arguments = append(annotation.Arguments, arg)
+			}
+		}
+
+		annotations = append(annotations, annotation)
+	}
+}
+
 func (p *Parser) parseEnum() (*ast.EnumerationType, error) {
 	var err error
 	tkn := p.Tokens[p.Position]
@@ -146,41 +340,713 @@ func (p *Parser) parseEnum() (*ast.EnumerationType, error) {
 		return nil, err
 	}
 
-	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "{" {
-		return nil, p.error(fmt.Sprintf("expected '{' but got %s", tkn))
-	}
-	p.Position++
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "{" {
+		return nil, p.error(fmt.Sprintf("expected '{' but got %s", tkn))
+	}
+	p.Position++
+
+	values, reserved, err := p.parseEnumValues()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.EnumerationType{
+		Position:   p.Tokens[p.Position-1].Position,
+		Name:       name,
+		ReturnType: rettype,
+		Values:     values,
+		Reserved:   reserved,
+	}, nil
+}
+
+// parseEnumValues parses the cases and reserved ranges of an enum or flags
+// body up to and including the closing brace. A case written without a value
+// continues from the previous one, starting at zero.
+func (p *Parser) parseEnumValues() ([]ast.EnumerationValue, []*ast.RangeType, error) {
+	var values []ast.EnumerationValue
+	var reserved []*ast.RangeType
+	var next, nextHigh uint64
+
+L:
+	for {
+		annotations, err := p.parseAnnotations()
+		if err != nil {
+			return nil, nil, err
+		}
+		tkn := p.Tokens[p.Position]
+		switch {
+		case tkn.Type == token.Delimiter && tkn.Value == "}" && len(annotations) == 0:
+			p.Position++
+			break L
+		case isWord(tkn, "reserved") && len(annotations) == 0 && !p.peekOperator("=") && !p.peekDelimiter(";"):
+			p.Position++
+			for {
+				r, err := p.parseRange()
+				if err != nil {
+					return nil, nil, err
+				}
+				reserved = append(reserved, r)
+				p.skipComments()
+				if !p.lenCheck() {
+					return nil, nil, p.error("unexpected EOF")
+				}
+				tkn = p.Tokens[p.Position]
+				if tkn.Type != token.Delimiter || tkn.Value != "," {
+					break
+				}
+				p.Position++
+			}
+			if tkn.Type != token.Delimiter || tkn.Value != ";" {
+				return nil, nil, p.error(fmt.Sprintf("expected ';' but got %s", tkn))
+			}
+			p.Position++
+		case tkn.Type == token.Identifier:
+			v := ast.EnumerationValue{Key: tkn.Value, Annotations: annotations}
+			keyPosition := tkn.Position
+			p.Position++
+			p.skipComments()
+			if !p.lenCheck() {
+				return nil, nil, p.error("unexpected EOF")
+			}
+			tkn = p.Tokens[p.Position]
+			switch {
+			case tkn.Type == token.Operator && tkn.Value == "=":
+				p.Position++
+				p.skipComments()
+				if !p.lenCheck() {
+					return nil, nil, p.error("unexpected EOF")
+				}
+				n, err := p.parseNumber()
+				if err != nil {
+					return nil, nil, err
+				}
+				v.Value = n
+				next, nextHigh = n.Value, n.High
+				next, nextHigh = increment(next, nextHigh)
+			case tkn.Type == token.Delimiter && tkn.Value == ";":
+				v.Value = &ast.NumberLiteralType{
+					Position: keyPosition,
+					Value:    next,
+					High:     nextHigh,
+				}
+				v.Implicit = true
+				next, nextHigh = increment(next, nextHigh)
+			default:
+				return nil, nil, p.error(fmt.Sprintf("expected '=' or ';' but got %s", tkn))
+			}
+			p.skipComments()
+			if !p.lenCheck() {
+				return nil, nil, p.error("unexpected EOF")
+			}
+			tkn = p.Tokens[p.Position]
+			if tkn.Type != token.Delimiter || tkn.Value != ";" {
+				return nil, nil, p.error(fmt.Sprintf("expected ';' but got %s", tkn))
+			}
+			p.Position++
+			values = append(values, v)
+		default:
+			return nil, nil, p.error(fmt.Sprintf("expected identifier but got %s", tkn))
+		}
+	}
+
+	return values, reserved, nil
+}
+
+// parseRange parses `value` or `value..value`, where each value is a number
+// or an identifier.
+func (p *Parser) parseRange() (*ast.RangeType, error) {
+	low, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	r := &ast.RangeType{
+		Position: low.Pos(),
+		Low:      low,
+		High:     low,
+	}
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	tkn := p.Tokens[p.Position]
+	if tkn.Type != token.Operator || tkn.Value != ".." {
+		return r, nil
+	}
+	p.Position++
+	r.High, err = p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// parseDefault parses `default(value)` after a field name.
+func (p *Parser) parseDefault() (ast.Node, error) {
+	tkn := p.Tokens[p.Position]
+	if tkn.Type != token.Identifier || tkn.Value != "default" {
+		return nil, p.error(fmt.Sprintf("expected \"default\" but got %s", tkn))
+	}
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "(" {
+		return nil, p.error(fmt.Sprintf("expected '(' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	value, err := p.parseDefaultValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ")" {
+		return nil, p.error(fmt.Sprintf("expected ')' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	return value, nil
+}
+
+// parseDefaultValue parses a default value: an array literal or an
+// expression.
+func (p *Parser) parseDefaultValue() (ast.Node, error) {
+	if tkn := p.Tokens[p.Position]; tkn.Type == token.Delimiter && tkn.Value == "[" {
+		return p.parseArrayLiteral()
+	}
+	return p.parseExpression()
+}
+
+// parseChecksum parses `checksum(algorithm, first..last)`.
+func (p *Parser) parseChecksum() (*ast.ChecksumType, error) {
+	tkn := p.Tokens[p.Position]
+	if tkn.Type != token.Identifier || tkn.Value != "checksum" {
+		return nil, p.error(fmt.Sprintf("expected \"checksum\" but got %s", tkn))
+	}
+	checksum := &ast.ChecksumType{Position: tkn.Position}
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "(" {
+		return nil, p.error(fmt.Sprintf("expected '(' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Identifier {
+		return nil, p.error(fmt.Sprintf("expected checksum algorithm but got %s", p.Tokens[p.Position]))
+	}
+	checksum.Algorithm = p.Tokens[p.Position].Value
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "," {
+		return nil, p.error(fmt.Sprintf("expected ',' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+
+	r, err := p.parseRange()
+	if err != nil {
+		return nil, err
+	}
+	checksum.Range = r
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ")" {
+		return nil, p.error(fmt.Sprintf("expected ')' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	return checksum, nil
+}
+
+func (p *Parser) parseFlags() (*ast.FlagsType, error) {
+	tkn := p.Tokens[p.Position]
+	if !isWord(tkn, "flags") {
+		return nil, p.error(fmt.Sprintf("expected \"flags\" but got %s", tkn))
+	}
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Identifier {
+		return nil, p.error(fmt.Sprintf("expected identifier but got %s", tkn))
+	}
+	name := p.Tokens[p.Position].Value
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+
+	storage, err := p.parseType()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "{" {
+		return nil, p.error(fmt.Sprintf("expected '{' but got %s", tkn))
+	}
+	p.Position++
+
+	values, reserved, err := p.parseEnumValues()
+	if err != nil {
+		return nil, err
+	}
+
+	return &ast.FlagsType{
+		Position:    p.Tokens[p.Position-1].Position,
+		Name:        name,
+		StorageType: storage,
+		Values:      values,
+		Reserved:    reserved,
+	}, nil
+}
+
+// parseAlign parses `align(bits);`.
+func (p *Parser) parseAlign() (*ast.AlignType, error) {
+	tkn := p.Tokens[p.Position]
+	if !isWord(tkn, "align") {
+		return nil, p.error(fmt.Sprintf("expected \"align\" but got %s", tkn))
+	}
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "(" {
+		return nil, p.error(fmt.Sprintf("expected '(' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	bits, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ")" {
+		return nil, p.error(fmt.Sprintf("expected ')' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ";" {
+		return nil, p.error(fmt.Sprintf("expected ';' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	p.skipComments()
+	return &ast.AlignType{
+		Position: tkn.Position,
+		Bits:     bits,
+	}, nil
+}
+
+func (p *Parser) parsePacket() (*ast.PacketType, error) {
+	tkn := p.Tokens[p.Position]
+	if tkn.Type != token.Keyword || tkn.Value != "packet" {
+		return nil, p.error(fmt.Sprintf("expected \"packet\" but got %s", tkn))
+	}
+	position := tkn.Position
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Identifier {
+		return nil, p.error(fmt.Sprintf("expected identifier but got %s", tkn))
+	}
+	name := p.Tokens[p.Position].Value
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+
+	var typeParams []*ast.IdentifierType
+	if p.Tokens[p.Position].Type == token.Operator && p.Tokens[p.Position].Value == "<" {
+		p.Position++
+		for {
+			p.skipComments()
+			if !p.lenCheck() {
+				return nil, p.error("unexpected EOF")
+			}
+			if p.Tokens[p.Position].Type != token.Identifier {
+				return nil, p.error(fmt.Sprintf("expected type parameter but got %s", p.Tokens[p.Position]))
+			}
+			typeParams = append(typeParams, &ast.IdentifierType{
+				Position: p.Tokens[p.Position].Position,
+				Value:    p.Tokens[p.Position].Value,
+			})
+			p.Position++
+			p.skipComments()
+			if !p.lenCheck() {
+				return nil, p.error("unexpected EOF")
+			}
+			tkn := p.Tokens[p.Position]
+			p.Position++
+			if tkn.Type == token.Operator && tkn.Value == ">" {
+				break
+			}
+			if tkn.Type != token.Delimiter || tkn.Value != "," {
+				return nil, newParserError(p.Tokens, p.Position-1, fmt.Sprintf("expected ',' or '>' but got %s", tkn))
+			}
+		}
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+	}
+
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "(" {
+		return nil, p.error(fmt.Sprintf("expected '(' but got %s", tkn))
+	}
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	args, err := p.parseParameters()
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "{" {
+		return nil, p.error(fmt.Sprintf("expected '{' but got %s", tkn))
+	}
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+
+	fields, err := p.parseFields()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.PacketType{
+		Position:       position,
+		Name:           name,
+		TypeParameters: typeParams,
+		Parameters:     args,
+		Fields:         fields,
+	}, nil
+}
+
+// parseMessage parses a TLV declaration:
+//
+//	message Name(tag: Type, length: Type) { field 1 Name Type; ... }
+func (p *Parser) parseMessage() (*ast.MessageType, error) {
+	tkn := p.Tokens[p.Position]
+	if tkn.Type != token.Keyword || tkn.Value != "message" {
+		return nil, p.error(fmt.Sprintf("expected \"message\" but got %s", tkn))
+	}
+	position := tkn.Position
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Identifier {
+		return nil, p.error(fmt.Sprintf("expected identifier but got %s", p.Tokens[p.Position]))
+	}
+	name := p.Tokens[p.Position].Value
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "(" {
+		return nil, p.error(fmt.Sprintf("expected '(' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	p.skipComments()
+	header, err := p.parseParameters()
+	if err != nil {
+		return nil, err
+	}
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "{" {
+		return nil, p.error(fmt.Sprintf("expected '{' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+
+	var fields []ast.MessageField
+	for {
+		annotations, err := p.parseAnnotations()
+		if err != nil {
+			return nil, err
+		}
+		tkn = p.Tokens[p.Position]
+		if tkn.Type == token.Delimiter && tkn.Value == "}" && len(annotations) == 0 {
+			p.Position++
+			break
+		}
+		if tkn.Type != token.Keyword || tkn.Value != "field" {
+			return nil, p.error(fmt.Sprintf("expected \"field\" but got %s", tkn))
+		}
+		field := ast.MessageField{
+			Position:    tkn.Position,
+			Annotations: annotations,
+		}
+		p.Position++
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		if p.Tokens[p.Position].Type != token.Number {
+			return nil, p.error(fmt.Sprintf("expected tag number but got %s", p.Tokens[p.Position]))
+		}
+		field.Tag, err = p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		if p.Tokens[p.Position].Type != token.Identifier {
+			return nil, p.error(fmt.Sprintf("expected identifier but got %s", p.Tokens[p.Position]))
+		}
+		field.Name = p.Tokens[p.Position].Value
+		p.Position++
+		field.Type, err = p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ";" {
+			return nil, p.error(fmt.Sprintf("expected ';' but got %s", p.Tokens[p.Position]))
+		}
+		p.Position++
+		fields = append(fields, field)
+	}
+
+	return &ast.MessageType{
+		Position: position,
+		Name:     name,
+		Header:   header,
+		Fields:   fields,
+	}, nil
+}
+
+// parseParameters parses `name: Type` parameters up to and including the
+// closing parenthesis.
+func (p *Parser) parseParameters() ([]ast.PacketField, error) {
+	var args []ast.PacketField
+
+	for {
+		annotations, err := p.parseAnnotations()
+		if err != nil {
+			return nil, err
+		}
+		tkn := p.Tokens[p.Position]
+		if tkn.Type == token.Delimiter && tkn.Value == ")" && len(annotations) == 0 {
+			p.Position++
+			break
+		}
+		if tkn.Type != token.Identifier {
+			return nil, p.error(fmt.Sprintf("expected identifier but got %s", tkn))
+		}
+		arg := ast.PacketField{
+			Name:        tkn.Value,
+			Annotations: annotations,
+		}
+		p.Position++
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+
+		tkn = p.Tokens[p.Position]
+		if tkn.Type != token.Delimiter || tkn.Value != ":" {
+			return nil, p.error(fmt.Sprintf("expected ':' but got %s", tkn))
+		}
+
+		p.Position++
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("expected <Type> but got EOF")
+		}
+		arg.Type, err = p.parseType()
+		if err != nil {
+			return nil, err
+		}
+
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		if tkn = p.Tokens[p.Position]; tkn.Type == token.Operator && tkn.Value == "=" {
+			p.Position++
+			p.skipComments()
+			if !p.lenCheck() {
+				return nil, p.error("unexpected EOF")
+			}
+			arg.Default, err = p.parseDefaultValue()
+			if err != nil {
+				return nil, err
+			}
+			p.skipComments()
+			if !p.lenCheck() {
+				return nil, p.error("unexpected EOF")
+			}
+		}
+		args = append(args, arg)
+
+		tkn = p.Tokens[p.Position]
+		switch {
+		case tkn.Type == token.Delimiter && tkn.Value == ",":
+			p.Position++
+			p.skipComments()
+		case tkn.Type != token.Delimiter || tkn.Value != ")":
+			return nil, p.error(fmt.Sprintf("expected ',' or ')' but got %s", tkn))
+		}
+	}
+	return args, nil
+}
+
+// parseFields parses packet fields and statements up to and including the
+// closing brace.
+func (p *Parser) parseFields() ([]ast.PacketField, error) {
+	var fields []ast.PacketField
+	for {
+		annotations, err := p.parseAnnotations()
+		if err != nil {
+			return nil, err
+		}
+		tkn := p.Tokens[p.Position]
+		if tkn.Type == token.Delimiter && tkn.Value == "}" {
+			if len(annotations) > 0 {
+				return nil, p.error("expected field after annotation")
+			}
+			p.Position++
+			break
+		}
+
+		// Statements are stored as unnamed fields.
+		if (isWord(tkn, "align") || isWord(tkn, "sized") || isWord(tkn, "assert")) && p.peekDelimiter("(") {
+			var statement ast.Node
+			switch tkn.Value {
+			case "align":
+				statement, err = p.parseAlign()
+			case "sized":
+				statement, err = p.parseSized()
+			case "assert":
+				statement, err = p.parseAssert()
+			}
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, ast.PacketField{
+				Name:        "_",
+				Type:        statement,
+				Annotations: annotations,
+			})
+			continue
+		}
+
+		if isWord(tkn, "let") && p.peekToken(2).Type == token.Operator && p.peekToken(2).Value == "=" {
+			field, err := p.parseLet()
+			if err != nil {
+				return nil, err
+			}
+			field.Annotations = annotations
+			fields = append(fields, *field)
+			continue
+		}
+
+		peek := false
+		if p.atPeek() {
+			peek = true
+			p.Position++
+			p.skipComments()
+			if !p.lenCheck() {
+				return nil, p.error("unexpected EOF")
+			}
+		}
+
+		t, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
 
-	var values []ast.EnumerationValue
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
 
-L:
-	for {
+		if p.Tokens[p.Position].Type != token.Identifier && p.Tokens[p.Position].Type != token.Keyword {
+			return nil, p.error(fmt.Sprintf("expected identifier but got %s", tkn))
+		}
+		field := ast.PacketField{
+			Name:        p.Tokens[p.Position].Value,
+			Type:        t,
+			Peek:        peek,
+			Annotations: annotations,
+		}
+		p.Position++
 		p.skipComments()
 		if !p.lenCheck() {
 			return nil, p.error("unexpected EOF")
 		}
-		tkn = p.Tokens[p.Position]
-		switch {
-		case tkn.Type == token.Delimiter && tkn.Value == "}":
-			p.Position++
-			break L
-		case tkn.Type == token.Identifier:
-			v := ast.EnumerationValue{Key: tkn.Value}
+
+		if p.Tokens[p.Position].Type == token.Operator && p.Tokens[p.Position].Value == "=" {
 			p.Position++
 			p.skipComments()
 			if !p.lenCheck() {
 				return nil, p.error("unexpected EOF")
 			}
-			tkn = p.Tokens[p.Position]
-			if tkn.Type != token.Operator || tkn.Value != "=" {
-				return nil, p.error(fmt.Sprintf("expected '=' but got %s", tkn))
+			switch {
+			case p.Tokens[p.Position].Type == token.Delimiter && p.Tokens[p.Position].Value == "[":
+				field.Magic, err = p.parseArrayLiteral()
+			case p.Tokens[p.Position].Type == token.Identifier && p.Tokens[p.Position].Value == "checksum":
+				field.Checksum, err = p.parseChecksum()
+			case p.Tokens[p.Position].Type == token.Identifier && p.Tokens[p.Position].Value == "default":
+				field.Default, err = p.parseDefault()
+			default:
+				field.Magic, err = p.parseValue()
+			}
+			if err != nil {
+				return nil, err
 			}
-			p.Position++
 			p.skipComments()
 			if !p.lenCheck() {
 				return nil, p.error("unexpected EOF")
 			}
-			v.Value, err = p.parseNumber()
+		}
+
+		if isWord(p.Tokens[p.Position], "where") {
+			p.Position++
+			field.Constraint, err = p.parseExpression()
 			if err != nil {
 				return nil, err
 			}
@@ -188,38 +1054,29 @@ L:
 			if !p.lenCheck() {
 				return nil, p.error("unexpected EOF")
 			}
-			tkn = p.Tokens[p.Position]
-			if tkn.Type != token.Delimiter || tkn.Value != ";" {
-				return nil, p.error(fmt.Sprintf("expected ';' but got %s", tkn))
-			}
-			p.Position++
-			values = append(values, v)
-		default:
-			return nil, p.error(fmt.Sprintf("expected identifier but got %s", tkn))
 		}
-	}
 
-	return &ast.EnumerationType{
-		Position:   tkn.Position,
-		Name:       name,
-		ReturnType: rettype,
-		Values:     values,
-	}, nil
+		if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ";" {
+			return nil, p.error(fmt.Sprintf("expected ';' but got %s", p.Tokens[p.Position]))
+		}
+		p.Position++
+		p.skipComments()
+
+		fields = append(fields, field)
+	}
+	return fields, nil
 }
 
-func (p *Parser) parsePacket() (*ast.PacketType, error) {
-	var err error
+// parseLet parses a `let name = value;` field.
+func (p *Parser) parseLet() (*ast.PacketField, error) {
 	tkn := p.Tokens[p.Position]
-	if tkn.Type != token.Keyword || tkn.Value != "packet" {
-		return nil, p.error(fmt.Sprintf("expected \"packet\" but got %s", tkn))
-	}
 	p.Position++
 	p.skipComments()
 	if !p.lenCheck() {
 		return nil, p.error("unexpected EOF")
 	}
 	if p.Tokens[p.Position].Type != token.Identifier {
-		return nil, p.error(fmt.Sprintf("expected identifier but got %s", tkn))
+		return nil, p.error(fmt.Sprintf("expected identifier but got %s", p.Tokens[p.Position]))
 	}
 	name := p.Tokens[p.Position].Value
 	p.Position++
@@ -227,112 +1084,133 @@ func (p *Parser) parsePacket() (*ast.PacketType, error) {
 	if !p.lenCheck() {
 		return nil, p.error("unexpected EOF")
 	}
+	if p.Tokens[p.Position].Type != token.Operator || p.Tokens[p.Position].Value != "=" {
+		return nil, p.error(fmt.Sprintf("expected '=' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	value, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ";" {
+		return nil, p.error(fmt.Sprintf("expected ';' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	p.skipComments()
+	return &ast.PacketField{
+		Name: name,
+		Type: &ast.LetType{
+			Position: tkn.Position,
+			Value:    value,
+		},
+	}, nil
+}
 
+// parseAssert parses an `assert(condition);` or `assert(condition, "message");`
+// statement.
+func (p *Parser) parseAssert() (*ast.AssertType, error) {
+	tkn := p.Tokens[p.Position]
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
 	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "(" {
-		return nil, p.error(fmt.Sprintf("expected '(' but got %s", tkn))
+		return nil, p.error(fmt.Sprintf("expected '(' but got %s", p.Tokens[p.Position]))
 	}
 	p.Position++
+	condition, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	a := &ast.AssertType{
+		Position:  tkn.Position,
+		Condition: condition,
+	}
 	p.skipComments()
 	if !p.lenCheck() {
 		return nil, p.error("unexpected EOF")
 	}
-	var args []ast.PacketField
-
-	for {
-		tkn = p.Tokens[p.Position]
-		if tkn.Type == token.Delimiter && tkn.Value == ")" {
-			p.Position++
-			break
-		}
-		if tkn.Type != token.Identifier {
-			return nil, p.error(fmt.Sprintf("expected identifier but got %s", tkn))
-		}
-		arg := ast.PacketField{
-			Name: tkn.Value,
-		}
+	if p.Tokens[p.Position].Type == token.Delimiter && p.Tokens[p.Position].Value == "," {
 		p.Position++
 		p.skipComments()
 		if !p.lenCheck() {
 			return nil, p.error("unexpected EOF")
 		}
-
-		tkn = p.Tokens[p.Position]
-		if tkn.Type != token.Delimiter || tkn.Value != ":" {
-			return nil, p.error(fmt.Sprintf("expected ':' but got %s", tkn))
+		if p.Tokens[p.Position].Type != token.String {
+			return nil, p.error(fmt.Sprintf("expected message string but got %s", p.Tokens[p.Position]))
+		}
+		a.Message = &ast.StringLiteralType{
+			Position: p.Tokens[p.Position].Position,
+			Value:    p.Tokens[p.Position].Value,
 		}
-
 		p.Position++
 		p.skipComments()
 		if !p.lenCheck() {
-			return nil, p.error("expected <Type> but got EOF")
-		}
-		arg.Type, err = p.parseType()
-		if err != nil {
-			return nil, err
+			return nil, p.error("unexpected EOF")
 		}
-
-		args = append(args, arg)
 	}
-
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ")" {
+		return nil, p.error(fmt.Sprintf("expected ')' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
 	p.skipComments()
 	if !p.lenCheck() {
 		return nil, p.error("unexpected EOF")
 	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ";" {
+		return nil, p.error(fmt.Sprintf("expected ';' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	p.skipComments()
+	return a, nil
+}
 
-	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "{" {
-		return nil, p.error(fmt.Sprintf("expected '{' but got %s", tkn))
+// parseSized parses a `sized(len) { ... }` block.
+func (p *Parser) parseSized() (*ast.SizedType, error) {
+	tkn := p.Tokens[p.Position]
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "(" {
+		return nil, p.error(fmt.Sprintf("expected '(' but got %s", p.Tokens[p.Position]))
 	}
 	p.Position++
+	size, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
 	p.skipComments()
 	if !p.lenCheck() {
 		return nil, p.error("unexpected EOF")
 	}
-
-	var fields []ast.PacketField
-	for {
-		tkn = p.Tokens[p.Position]
-		if tkn.Type == token.Delimiter && tkn.Value == "}" {
-			p.Position++
-			break
-		}
-
-		t, err := p.parseType()
-		if err != nil {
-			return nil, err
-		}
-
-		p.skipComments()
-		if !p.lenCheck() {
-			return nil, p.error("unexpected EOF")
-		}
-
-		if p.Tokens[p.Position].Type != token.Identifier && p.Tokens[p.Position].Type != token.Keyword {
-			return nil, p.error(fmt.Sprintf("expected identifier but got %s", tkn))
-		}
-		name := p.Tokens[p.Position].Value
-		p.Position++
-		p.skipComments()
-		if !p.lenCheck() {
-			return nil, p.error("unexpected EOF")
-		}
-
-		if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ";" {
-			return nil, p.error(fmt.Sprintf("expected ';' but got %s", tkn))
-		}
-		p.Position++
-		p.skipComments()
-
-		fields = append(fields, ast.PacketField{
-			Name: name,
-			Type: t,
-		})
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != ")" {
+		return nil, p.error(fmt.Sprintf("expected ')' but got %s", p.Tokens[p.Position]))
 	}
-
-	return &ast.PacketType{
-		Position:   tkn.Position,
-		Name:       name,
-		Parameters: args,
-		Fields:     fields,
+	p.Position++
+	p.skipComments()
+	if !p.lenCheck() {
+		return nil, p.error("unexpected EOF")
+	}
+	if p.Tokens[p.Position].Type != token.Delimiter || p.Tokens[p.Position].Value != "{" {
+		return nil, p.error(fmt.Sprintf("expected '{' but got %s", p.Tokens[p.Position]))
+	}
+	p.Position++
+	p.skipComments()
+	fields, err := p.parseFields()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.SizedType{
+		Position: tkn.Position,
+		Size:     size,
+		Fields:   fields,
 	}, nil
 }
 
@@ -353,6 +1231,87 @@ func (p *Parser) parseProtocol() (*ast.ProtocolType, error) {
 	return nil, nil
 }
 
+// peekToken returns the nth token after the current one, skipping comments,
+// or an EOF token past the end of the input.
+func (p *Parser) peekToken(n int) token.Token {
+	i := p.Position
+	for ; n > 0; n-- {
+		i++
+		for i < len(p.Tokens) && p.Tokens[i].Type == token.Comment {
+			i++
+		}
+	}
+	if i >= len(p.Tokens) {
+		return token.Token{TokenType: token.TokenType{Type: token.EOF}}
+	}
+	return p.Tokens[i]
+}
+
+// peekOperator reports whether the token after the current one is the
+// operator op.
+func (p *Parser) peekOperator(op string) bool {
+	tkn := p.peekToken(1)
+	return tkn.Type == token.Operator && tkn.Value == op
+}
+
+// peekDelimiter reports whether the token after the current one is the
+// delimiter d.
+func (p *Parser) peekDelimiter(d string) bool {
+	tkn := p.peekToken(1)
+	return tkn.Type == token.Delimiter && tkn.Value == d
+}
+
+// atFlags reports whether a flags declaration, `flags Name Storage {`,
+// starts at the current token.
+func (p *Parser) atFlags() bool {
+	next, storage := p.peekToken(1), p.peekToken(2)
+	return isWord(p.Tokens[p.Position], "flags") && next.Type == token.Identifier &&
+		(storage.Type == token.Keyword || storage.Type == token.Identifier)
+}
+
+// atPeek reports whether the current token is the peek prefix of a field
+// rather than the type of a field named after it, as in `peek u8 x;`
+// against `peek x;`.
+func (p *Parser) atPeek() bool {
+	if !isWord(p.Tokens[p.Position], "peek") {
+		return false
+	}
+	next, after := p.peekToken(1), p.peekToken(2)
+	switch {
+	case next.Type == token.Keyword:
+		return true
+	case next.Type != token.Identifier:
+		return false
+	}
+	return !(after.Type == token.Delimiter && after.Value == ";") &&
+		!(after.Type == token.Operator && after.Value == "=") &&
+		!isWord(after, "where")
+}
+
+// isWord reports whether tkn is the identifier word. Words such as flags,
+// align and where only act as keywords where a declaration or statement can
+// start, so they remain usable as names everywhere else.
+func isWord(tkn token.Token, word string) bool {
+	return tkn.Type == token.Identifier && tkn.Value == word
+}
+
+// parseKeywordArgument parses a `key = expression` type argument.
+func (p *Parser) parseKeywordArgument() (*ast.KeywordArgument, error) {
+	tkn := p.Tokens[p.Position]
+	p.Position++
+	p.skipComments()
+	p.Position++ // =
+	value, err := p.parseExpression()
+	if err != nil {
+		return nil, err
+	}
+	return &ast.KeywordArgument{
+		Position: tkn.Position,
+		Key:      tkn.Value,
+		Value:    value,
+	}, nil
+}
+
 func (p *Parser) parseType() (ast.Node, error) {
 	p.skipComments()
 	tkn := p.Tokens[p.Position]
@@ -364,13 +1323,20 @@ func (p *Parser) parseType() (ast.Node, error) {
 	switch tkn.Value {
 	case "enum":
 		return p.parseEnum()
+	case "flags":
+		if p.atFlags() {
+			return p.parseFlags()
+		}
 	case "packet":
 		return p.parsePacket()
+	case "message":
+		return p.parseMessage()
 	case "protocol":
 		return p.parseProtocol()
 	}
 
 	name := tkn.Value
+	position := tkn.Position
 	p.Position++
 	p.skipComments()
 	if !p.lenCheck() {
@@ -378,6 +1344,20 @@ func (p *Parser) parseType() (ast.Node, error) {
 	}
 	tkn = p.Tokens[p.Position]
 
+	var typeArgs []ast.Node
+	if tkn.Type == token.Operator && tkn.Value == "<" {
+		var err error
+		typeArgs, err = p.parseTypeArguments()
+		if err != nil {
+			return nil, err
+		}
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		tkn = p.Tokens[p.Position]
+	}
+
 	var args []ast.Node
 	if tkn.Type == token.Delimiter && tkn.Value == "(" {
 		p.Position++
@@ -401,31 +1381,64 @@ func (p *Parser) parseType() (ast.Node, error) {
 				tkn = p.Tokens[p.Position]
 			}
 
-			switch tkn.Type {
-			case token.Identifier:
-				args = append(args, &ast.IdentifierType{
-					Position: tkn.Position,
-					Value:    tkn.Value,
-				})
-				p.Position++
-				p.skipComments()
-				if !p.lenCheck() {
-					return nil, p.error("unexpected EOF")
-				}
-			case token.Number:
-				n, err := p.parseNumber()
-				if err != nil {
-					return nil, err
-				}
-				args = append(args, n)
+			// Keywords name primitive types, as in Array(u8, 4).
+			var arg ast.Node
+			var err error
+			switch {
+			case tkn.Type == token.Keyword, tkn.Type == token.Identifier && p.peekOperator("<"):
+				arg, err = p.parseType()
+			case tkn.Type == token.Identifier && p.peekOperator("="):
+				arg, err = p.parseKeywordArgument()
 			default:
-				return nil, p.error(fmt.Sprintf("expected identifier or number but got %s", tkn))
+				arg, err = p.parseExpression()
+			}
+			if err != nil {
+				return nil, err
+			}
+			args = append(args, arg)
+			p.skipComments()
+			if !p.lenCheck() {
+				return nil, p.error("unexpected EOF")
 			}
 		}
 	}
 	return &ast.TypeType{
-		Position:  tkn.Position,
-		TypeName:  name,
-		Arguments: args,
+		Position:      position,
+		TypeName:      name,
+		Arguments:     args,
+		TypeArguments: typeArgs,
 	}, nil
 }
+
+// parseTypeArguments parses `<Type, ...>` after a generic packet name. A
+// closing `>>` is split so that nested instantiations can end together.
+func (p *Parser) parseTypeArguments() ([]ast.Node, error) {
+	p.Position++ // <
+	var args []ast.Node
+	for {
+		arg, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		p.skipComments()
+		if !p.lenCheck() {
+			return nil, p.error("unexpected EOF")
+		}
+		tkn := p.Tokens[p.Position]
+		switch {
+		case tkn.Type == token.Delimiter && tkn.Value == ",":
+			p.Position++
+			p.skipComments()
+		case tkn.Type == token.Operator && tkn.Value == ">":
+			p.Position++
+			return args, nil
+		case tkn.Type == token.Operator && tkn.Value == ">>":
+			p.Tokens[p.Position].Value = ">"
+			p.Tokens[p.Position].Col++
+			return args, nil
+		default:
+			return nil, p.error(fmt.Sprintf("expected ',' or '>' but got %s", tkn))
+		}
+	}
+}
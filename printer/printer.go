@@ -0,0 +1,222 @@
+// Package printer formats a protodecl syntax tree as schema source.
+package printer
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/unsafe-risk/protodecl/ast"
+)
+
+const indent = "    "
+
+type printer struct {
+	buf   bytes.Buffer
+	depth int
+}
+
+func (p *printer) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&p.buf, format, args...)
+}
+
+// line writes one indented line.
+func (p *printer) line(format string, args ...interface{}) {
+	p.buf.WriteString(strings.Repeat(indent, p.depth))
+	p.printf(format, args...)
+	p.buf.WriteByte('\n')
+}
+
+// Print formats the declarations of t, separated by blank lines. Numbers
+// are written in decimal except for magic values, which are written in hex.
+func Print(t *ast.Tree) ([]byte, error) {
+	p := new(printer)
+	for i, n := range t.Nodes {
+		if i > 0 {
+			p.buf.WriteByte('\n')
+		}
+		if err := p.decl(n); err != nil {
+			return nil, err
+		}
+	}
+	return p.buf.Bytes(), nil
+}
+
+func (p *printer) decl(n ast.Node) error {
+	switch n := n.(type) {
+	case *ast.CommentType:
+		if n.IsMultiline {
+			p.line("/*%s*/", n.Value)
+		} else {
+			p.line("//%s", n.Value)
+		}
+	case *ast.EnumerationType:
+		p.annotations(n.Annotations)
+		p.line("enum %s %s {", n.Name, ast.ExprString(n.ReturnType))
+		p.enumValues(n.Values, n.Reserved)
+		p.line("}")
+	case *ast.FlagsType:
+		p.annotations(n.Annotations)
+		p.line("flags %s %s {", n.Name, ast.ExprString(n.StorageType))
+		p.enumValues(n.Values, n.Reserved)
+		p.line("}")
+	case *ast.PacketType:
+		p.annotations(n.Annotations)
+		name := n.Name
+		if len(n.TypeParameters) > 0 {
+			params := make([]string, len(n.TypeParameters))
+			for i, t := range n.TypeParameters {
+				params[i] = t.Value
+			}
+			name += "<" + strings.Join(params, ", ") + ">"
+		}
+		p.line("packet %s(%s) {", name, parameters(n.Parameters))
+		if err := p.fields(n.Fields); err != nil {
+			return err
+		}
+		p.line("}")
+	case *ast.MessageType:
+		p.annotations(n.Annotations)
+		p.line("message %s(%s) {", n.Name, parameters(n.Header))
+		p.depth++
+		for _, f := range n.Fields {
+			p.line("%sfield %s %s %s;", inlineAnnotations(f.Annotations), ast.ExprString(f.Tag), f.Name, ast.ExprString(f.Type))
+		}
+		p.depth--
+		p.line("}")
+	default:
+		return fmt.Errorf("%s: cannot print %T", n.Pos(), n)
+	}
+	return nil
+}
+
+// annotations writes declaration annotations, one per line.
+func (p *printer) annotations(list []*ast.Annotation) {
+	for _, a := range list {
+		p.line("%s", annotation(a))
+	}
+}
+
+// inlineAnnotations formats annotations that share a line with what they
+// annotate, including a trailing space.
+func inlineAnnotations(list []*ast.Annotation) string {
+	var b strings.Builder
+	for _, a := range list {
+		b.WriteString(annotation(a))
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func annotation(a *ast.Annotation) string {
+	if len(a.Arguments) == 0 {
+		return "@" + a.Name
+	}
+	args := make([]string, len(a.Arguments))
+	for i, arg := range a.Arguments {
+		args[i] = ast.ExprString(arg.Value)
+		if arg.Key != "" {
+			args[i] = arg.Key + " = " + args[i]
+		}
+	}
+	return "@" + a.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+func (p *printer) enumValues(values []ast.EnumerationValue, reserved []*ast.RangeType) {
+	p.depth++
+	for _, v := range values {
+		if v.Implicit {
+			p.line("%s%s;", inlineAnnotations(v.Annotations), v.Key)
+		} else {
+			p.line("%s%s = %s;", inlineAnnotations(v.Annotations), v.Key, ast.ExprString(v.Value))
+		}
+	}
+	if len(reserved) > 0 {
+		ranges := make([]string, len(reserved))
+		for i, r := range reserved {
+			ranges[i] = ast.ExprString(r)
+		}
+		p.line("reserved %s;", strings.Join(ranges, ", "))
+	}
+	p.depth--
+}
+
+func parameters(params []ast.PacketField) string {
+	list := make([]string, len(params))
+	for i, f := range params {
+		list[i] = inlineAnnotations(f.Annotations) + f.Name + ": " + ast.ExprString(f.Type)
+		if f.Default != nil {
+			list[i] += " = " + ast.ExprString(f.Default)
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+func (p *printer) fields(fields []ast.PacketField) error {
+	p.depth++
+	defer func() { p.depth-- }()
+	for _, f := range fields {
+		prefix := inlineAnnotations(f.Annotations)
+		switch t := f.Type.(type) {
+		case *ast.AlignType:
+			p.line("%salign(%s);", prefix, ast.ExprString(t.Bits))
+			continue
+		case *ast.AssertType:
+			if t.Message != nil {
+				p.line("%sassert(%s, %s);", prefix, ast.ExprString(t.Condition), ast.ExprString(t.Message))
+			} else {
+				p.line("%sassert(%s);", prefix, ast.ExprString(t.Condition))
+			}
+			continue
+		case *ast.LetType:
+			p.line("%slet %s = %s;", prefix, f.Name, ast.ExprString(t.Value))
+			continue
+		case *ast.SizedType:
+			p.line("%ssized(%s) {", prefix, ast.ExprString(t.Size))
+			if err := p.fields(t.Fields); err != nil {
+				return err
+			}
+			p.line("}")
+			continue
+		case *ast.TypeType:
+		default:
+			return fmt.Errorf("%s: cannot print field %s of type %T", f.Type.Pos(), f.Name, f.Type)
+		}
+
+		if f.Peek {
+			prefix += "peek "
+		}
+		s := prefix + ast.ExprString(f.Type) + " " + f.Name
+		switch {
+		case f.Magic != nil:
+			s += " = " + magic(f.Magic)
+		case f.Checksum != nil:
+			s += fmt.Sprintf(" = checksum(%s, %s)", f.Checksum.Algorithm, ast.ExprString(f.Checksum.Range))
+		case f.Default != nil:
+			s += " = default(" + ast.ExprString(f.Default) + ")"
+		}
+		if f.Constraint != nil {
+			s += " where " + ast.ExprString(f.Constraint)
+		}
+		p.line("%s;", s)
+	}
+	return nil
+}
+
+// magic formats a magic value, writing numbers in hex.
+func magic(n ast.Node) string {
+	switch n := n.(type) {
+	case *ast.NumberLiteralType:
+		if n.High != 0 {
+			return fmt.Sprintf("0x%X%016X", n.High, n.Value)
+		}
+		return fmt.Sprintf("0x%X", n.Value)
+	case *ast.ArrayLiteralType:
+		elems := make([]string, len(n.Elements))
+		for i, e := range n.Elements {
+			elems[i] = magic(e)
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+	return ast.ExprString(n)
+}
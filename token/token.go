@@ -16,6 +16,8 @@ const (
 	Keyword
 	Comment
 	EOF
+	String
+	Float
 )
 
 type Position struct {
@@ -56,6 +58,10 @@ func (t TType) String() string {
 		return "Comment"
 	case EOF:
 		return "EOF"
+	case String:
+		return "String"
+	case Float:
+		return "Float"
 	default:
 		return "Unknown"
 	}
@@ -0,0 +1,98 @@
+package wire
+
+import "fmt"
+
+// MaxArrayLength bounds the number of elements decoded into an array, so that
+// a corrupt or hostile count or terminator cannot make a decoder grow without
+// limit. Zero means no limit.
+var MaxArrayLength = 1 << 20
+
+// ArrayTooLongError is returned when an array exceeds MaxArrayLength
+// elements.
+type ArrayTooLongError struct {
+	Limit int
+}
+
+func (e *ArrayTooLongError) Error() string {
+	return fmt.Sprintf("array exceeds %d elements", e.Limit)
+}
+
+func checkArrayLength(n int) error {
+	if MaxArrayLength > 0 && n >= MaxArrayLength {
+		return &ArrayTooLongError{Limit: MaxArrayLength}
+	}
+	return nil
+}
+
+// ReadCount decodes an `Array(T, count)`: it reads n elements. The result
+// grows as elements are read rather than being allocated up front.
+func ReadCount[T any](n uint64, read func() (T, error)) ([]T, error) {
+	if MaxArrayLength > 0 && n > uint64(MaxArrayLength) {
+		return nil, &ArrayTooLongError{Limit: MaxArrayLength}
+	}
+	var out []T
+	for i := uint64(0); i < n; i++ {
+		v, err := read()
+		if err != nil {
+			return out, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// ReadUntil decodes an `Array(T, until = ...)`: it reads elements until done
+// reports true for the element just read, which is included.
+func ReadUntil[T any](read func() (T, error), done func(last T) bool) ([]T, error) {
+	var out []T
+	for {
+		if err := checkArrayLength(len(out)); err != nil {
+			return out, err
+		}
+		v, err := read()
+		if err != nil {
+			return out, err
+		}
+		out = append(out, v)
+		if done(v) {
+			return out, nil
+		}
+	}
+}
+
+// ReadWhile decodes an `Array(T, while = ...)`: it reads elements as long as
+// cond reports true before each one.
+func ReadWhile[T any](cond func() bool, read func() (T, error)) ([]T, error) {
+	var out []T
+	for cond() {
+		if err := checkArrayLength(len(out)); err != nil {
+			return out, err
+		}
+		v, err := read()
+		if err != nil {
+			return out, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+// ReadToEnd decodes an `Array(T, eos)`: it reads elements until b is
+// exhausted. Data that ends inside an element is an error.
+func ReadToEnd[T any](b *BitReader, read func() (T, error)) ([]T, error) {
+	var out []T
+	for {
+		end, err := b.AtEnd()
+		if err != nil || end {
+			return out, err
+		}
+		if err := checkArrayLength(len(out)); err != nil {
+			return out, err
+		}
+		v, err := read()
+		if err != nil {
+			return out, err
+		}
+		out = append(out, v)
+	}
+}
@@ -0,0 +1,196 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// withMaxArrayLength sets MaxArrayLength for the rest of the test.
+func withMaxArrayLength(t *testing.T, n int) {
+	old := MaxArrayLength
+	MaxArrayLength = n
+	t.Cleanup(func() { MaxArrayLength = old })
+}
+
+func readU8(r *BitReader) func() (uint8, error) {
+	return func() (uint8, error) {
+		v, err := r.ReadBits(8)
+		return uint8(v), err
+	}
+}
+
+func readU16(r *BitReader) func() (uint16, error) {
+	return func() (uint16, error) {
+		v, err := r.ReadBits(16)
+		return uint16(v), err
+	}
+}
+
+func isArrayTooLong(err error, limit int) bool {
+	var tooLong *ArrayTooLongError
+	return errors.As(err, &tooLong) && tooLong.Limit == limit
+}
+
+func TestReadCount(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+		n    uint64
+		want []uint8
+		err  error
+	}{
+		{"empty", nil, 0, nil, nil},
+		{"exact", []byte{1, 2, 3}, 3, []uint8{1, 2, 3}, nil},
+		{"leaves the rest", []byte{1, 2, 3}, 2, []uint8{1, 2}, nil},
+		{"short", []byte{1, 2}, 3, []uint8{1, 2}, io.ErrUnexpectedEOF},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadCount(tt.n, readU8(NewBitReader(bytes.NewReader(tt.data))))
+			if err != tt.err {
+				t.Fatalf("ReadCount error = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadCount = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadCountLimit(t *testing.T) {
+	withMaxArrayLength(t, 4)
+	calls := 0
+	read := func() (uint8, error) {
+		calls++
+		return 0, nil
+	}
+	if got, err := ReadCount(4, read); err != nil || len(got) != 4 {
+		t.Errorf("ReadCount(4) = %v, %v", got, err)
+	}
+	calls = 0
+	// A count over the limit fails before anything is read, so a corrupt
+	// count does not cost a loop over the data.
+	if _, err := ReadCount(5, read); !isArrayTooLong(err, 4) {
+		t.Errorf("ReadCount(5) error = %v, want *ArrayTooLongError", err)
+	}
+	if calls != 0 {
+		t.Errorf("ReadCount(5) read %d elements", calls)
+	}
+
+	withMaxArrayLength(t, 0)
+	if got, err := ReadCount(1<<21, read); err != nil || len(got) != 1<<21 {
+		t.Errorf("ReadCount without a limit = %d elements, %v", len(got), err)
+	}
+}
+
+func TestReadUntil(t *testing.T) {
+	zero := func(last uint8) bool { return last == 0 }
+	for _, tt := range []struct {
+		name  string
+		data  []byte
+		want  []uint8
+		rest  int64
+		err   error
+		limit int
+	}{
+		{"terminator included", []byte{'h', 'i', 0, 'x'}, []uint8{'h', 'i', 0}, 24, nil, 0},
+		{"terminator first", []byte{0}, []uint8{0}, 8, nil, 0},
+		{"no terminator", []byte{'h', 'i'}, []uint8{'h', 'i'}, 16, io.ErrUnexpectedEOF, 0},
+		{"at the limit", []byte{1, 2, 0}, []uint8{1, 2, 0}, 24, nil, 3},
+		{"over the limit", []byte{1, 2, 3, 0}, []uint8{1, 2, 3}, 24, &ArrayTooLongError{Limit: 3}, 3},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withMaxArrayLength(t, tt.limit)
+			r := NewBitReader(bytes.NewReader(tt.data))
+			got, err := ReadUntil(readU8(r), zero)
+			if want, ok := tt.err.(*ArrayTooLongError); ok {
+				if !isArrayTooLong(err, want.Limit) {
+					t.Fatalf("ReadUntil error = %v, want %v", err, want)
+				}
+			} else if err != tt.err {
+				t.Fatalf("ReadUntil error = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadUntil = %v, want %v", got, tt.want)
+			}
+			if r.Offset() != tt.rest {
+				t.Errorf("Offset() = %d, want %d", r.Offset(), tt.rest)
+			}
+		})
+	}
+}
+
+func TestReadWhile(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		data  []byte
+		end   int64
+		want  []uint16
+		err   error
+		limit int
+	}{
+		{"stops at offset", []byte{0, 1, 0, 2, 0, 3}, 32, []uint16{1, 2}, nil, 0},
+		{"false at once", []byte{0, 1}, 0, nil, nil, 0},
+		// The condition is checked only before each element, so the last one
+		// may run past the offset.
+		{"checked before each element", []byte{0, 1, 0, 2}, 8, []uint16{1}, nil, 0},
+		{"short", []byte{0, 1, 0}, 32, []uint16{1}, io.ErrUnexpectedEOF, 0},
+		{"over the limit", []byte{0, 1, 0, 2, 0, 3}, 48, []uint16{1, 2}, &ArrayTooLongError{Limit: 2}, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withMaxArrayLength(t, tt.limit)
+			r := NewBitReader(bytes.NewReader(tt.data))
+			got, err := ReadWhile(func() bool { return r.Offset() < tt.end }, readU16(r))
+			if want, ok := tt.err.(*ArrayTooLongError); ok {
+				if !isArrayTooLong(err, want.Limit) {
+					t.Fatalf("ReadWhile error = %v, want %v", err, want)
+				}
+			} else if err != tt.err {
+				t.Fatalf("ReadWhile error = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadWhile = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadToEnd(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		data  []byte
+		skip  uint
+		want  []uint16
+		err   error
+		limit int
+	}{
+		{"empty", nil, 0, nil, nil, 0},
+		{"whole elements", []byte{0, 1, 0, 2}, 0, []uint16{1, 2}, nil, 0},
+		{"partial trailing element", []byte{0, 1, 0, 2, 0xFF}, 0, []uint16{1, 2}, io.ErrUnexpectedEOF, 0},
+		{"unaligned partial element", []byte{0x00, 0x10, 0x02}, 4, []uint16{0x100}, io.ErrUnexpectedEOF, 0},
+		{"unaligned whole elements", []byte{0x00, 0x10, 0x00}, 8, []uint16{0x1000}, nil, 0},
+		{"at the limit", []byte{0, 1, 0, 2}, 0, []uint16{1, 2}, nil, 2},
+		{"over the limit", []byte{0, 1, 0, 2, 0, 3}, 0, []uint16{1, 2}, &ArrayTooLongError{Limit: 2}, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			withMaxArrayLength(t, tt.limit)
+			r := NewBitReader(bytes.NewReader(tt.data))
+			if _, err := r.ReadBits(tt.skip); err != nil {
+				t.Fatal(err)
+			}
+			got, err := ReadToEnd(r, readU16(r))
+			if want, ok := tt.err.(*ArrayTooLongError); ok {
+				if !isArrayTooLong(err, want.Limit) {
+					t.Fatalf("ReadToEnd error = %v, want %v", err, want)
+				}
+			} else if err != tt.err {
+				t.Fatalf("ReadToEnd error = %v, want %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadToEnd = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,119 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// OffsetError is returned when an @at offset lies outside the data.
+type OffsetError struct {
+	Offset int64
+	Size   int64
+}
+
+func (e *OffsetError) Error() string {
+	return fmt.Sprintf("offset %d is outside %d bytes of data", e.Offset, e.Size)
+}
+
+// CycleError is returned when an @at field refers, directly or through other
+// @at fields, to data that is still being decoded.
+type CycleError struct {
+	Offset int64
+}
+
+func (e *CycleError) Error() string {
+	return fmt.Sprintf("cyclic reference to offset %d", e.Offset)
+}
+
+// OverlapError is returned when the data of two @at fields partly overlaps.
+type OverlapError struct {
+	Offset, Size           int64
+	OtherOffset, OtherSize int64
+}
+
+func (e *OverlapError) Error() string {
+	return fmt.Sprintf("%d bytes at offset %d overlap %d bytes at offset %d", e.Size, e.Offset, e.OtherSize, e.OtherOffset)
+}
+
+type span struct {
+	offset, size int64
+}
+
+// ErrNoSeeker is returned when an @at field is decoded from a reader without
+// a Seeker.
+var ErrNoSeeker = errors.New("wire: @at field read without a Seeker")
+
+// Seeker decodes @at fields from an io.ReaderAt. Each field gets its own
+// BitReader, so the reader of the enclosing packet keeps its position. The
+// Seeker remembers what it has decoded to report cycles and overlaps; two
+// fields may share data only if they start at the same offset.
+type Seeker struct {
+	r      io.ReaderAt
+	size   int64
+	active []int64
+	done   []span
+}
+
+// NewSeeker returns a Seeker over size bytes of r.
+func NewSeeker(r io.ReaderAt, size int64) *Seeker {
+	return &Seeker{r: r, size: size}
+}
+
+// Enter returns a reader positioned off bytes from the start of the data for
+// a field of the packet being read from r, whose settings it shares. Every
+// successful Enter must be paired with a Leave. A nil Seeker returns
+// ErrNoSeeker.
+func (s *Seeker) Enter(r *BitReader, off int64) (*BitReader, error) {
+	if s == nil {
+		return nil, ErrNoSeeker
+	}
+	if off < 0 || off > s.size {
+		return nil, &OffsetError{Offset: off, Size: s.size}
+	}
+	for _, a := range s.active {
+		if a == off {
+			return nil, &CycleError{Offset: off}
+		}
+	}
+	s.active = append(s.active, off)
+	at := NewBitReader(io.NewSectionReader(s.r, off, s.size-off))
+	at.Strict, at.Seeker, at.base = r.Strict, s, off*8
+	return at, nil
+}
+
+// Leave ends the field most recently entered, which r has decoded, and
+// checks its bytes against those of earlier fields. It is an error if no
+// field has been entered.
+func (s *Seeker) Leave(r *BitReader) error {
+	if s == nil || len(s.active) == 0 {
+		return errors.New("wire: Leave without Enter")
+	}
+	off := s.active[len(s.active)-1]
+	s.active = s.active[:len(s.active)-1]
+	cur := span{offset: off, size: (r.Offset() + 7) / 8}
+	for _, d := range s.done {
+		if d.offset == cur.offset {
+			continue
+		}
+		if cur.offset < d.offset+d.size && d.offset < cur.offset+cur.size {
+			return &OverlapError{Offset: cur.offset, Size: cur.size, OtherOffset: d.offset, OtherSize: d.size}
+		}
+	}
+	s.done = append(s.done, cur)
+	return nil
+}
+
+// end returns the offset just past the data of the fields decoded so far.
+func (s *Seeker) end() int64 {
+	if s == nil {
+		return 0
+	}
+	var end int64
+	for _, d := range s.done {
+		if d.offset+d.size > end {
+			end = d.offset + d.size
+		}
+	}
+	return end
+}
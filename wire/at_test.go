@@ -0,0 +1,236 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// node decodes the data a generated decoder would for
+//
+//	packet Node() {
+//	    u8 next;
+//	    u8 count;
+//	    @at(next) Array(Node, count) children;
+//	}
+//
+// returning the values of next in the order they were read.
+func node(r *BitReader, seen *[]uint64) error {
+	next, err := r.ReadBits(8)
+	if err != nil {
+		return err
+	}
+	count, err := r.ReadBits(8)
+	if err != nil {
+		return err
+	}
+	*seen = append(*seen, next)
+	if count == 0 {
+		return nil
+	}
+	at, err := r.Seeker.Enter(r, int64(next))
+	if err != nil {
+		return err
+	}
+	if _, err := ReadCount(count, func() (struct{}, error) {
+		return struct{}{}, node(at, seen)
+	}); err != nil {
+		return err
+	}
+	return r.Seeker.Leave(at)
+}
+
+func TestSeekerDecode(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+		seen []uint64
+		err  error
+	}{
+		{"leaf", []byte{0, 0}, []uint64{0}, nil},
+		{"child after header", []byte{4, 1, 0xFF, 0xFF, 0, 0}, []uint64{4, 0}, nil},
+		{"children", []byte{2, 2, 6, 0, 0, 0, 0, 0}, []uint64{2, 6, 0}, nil},
+		{"child inside the header", []byte{1, 1, 0}, []uint64{1, 1}, nil},
+		{"offset past the end", []byte{9, 1}, []uint64{9}, &OffsetError{Offset: 9, Size: 2}},
+		{"offset at the end", []byte{2, 1}, []uint64{2}, io.ErrUnexpectedEOF},
+		{"cycle", []byte{0, 1}, []uint64{0, 0}, &CycleError{Offset: 0}},
+		{"indirect cycle", []byte{2, 1, 0, 1}, []uint64{2, 0, 2}, &CycleError{Offset: 2}},
+		// The children at 2 and 4 take bytes 2 to 5, and the grandchild
+		// at 5 overlaps them.
+		{"overlap", []byte{2, 2, 5, 1, 0, 0, 0}, []uint64{2, 5, 0, 0}, &OverlapError{Offset: 2, Size: 4, OtherOffset: 5, OtherSize: 2}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewBitReader(bytes.NewReader(tt.data))
+			r.Seeker = NewSeeker(bytes.NewReader(tt.data), int64(len(tt.data)))
+			var seen []uint64
+			err := node(r, &seen)
+			if !sameAtError(err, tt.err) {
+				t.Fatalf("error = %v, want %v", err, tt.err)
+			}
+			if len(seen) != len(tt.seen) {
+				t.Fatalf("read next = %v, want %v", seen, tt.seen)
+			}
+			for i := range seen {
+				if seen[i] != tt.seen[i] {
+					t.Errorf("read next = %v, want %v", seen, tt.seen)
+					break
+				}
+			}
+			if tt.err == nil && r.Offset() != 16 {
+				t.Errorf("Offset() = %d after the root, want 16", r.Offset())
+			}
+		})
+	}
+}
+
+func sameAtError(err, want error) bool {
+	switch want := want.(type) {
+	case nil:
+		return err == nil
+	case *OffsetError:
+		var got *OffsetError
+		return errors.As(err, &got) && *got == *want
+	case *CycleError:
+		var got *CycleError
+		return errors.As(err, &got) && *got == *want
+	case *OverlapError:
+		var got *OverlapError
+		return errors.As(err, &got) && *got == *want
+	}
+	return err == want
+}
+
+func TestSeekerReader(t *testing.T) {
+	data := []byte{0xA0, 1, 2, 3}
+	r := NewBitReader(bytes.NewReader(data))
+	r.Strict = true
+	r.Seeker = NewSeeker(bytes.NewReader(data), int64(len(data)))
+	if _, err := r.ReadBits(4); err != nil {
+		t.Fatal(err)
+	}
+	at, err := r.Seeker.Enter(r, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !at.Strict || at.Seeker != r.Seeker {
+		t.Errorf("reader does not share the settings of its parent")
+	}
+	if v, err := at.ReadBits(8); err != nil || v != 2 {
+		t.Errorf("ReadBits = %d, %v, want 2", v, err)
+	}
+	if at.Offset() != 8 || at.DataOffset() != 24 {
+		t.Errorf("Offset, DataOffset = %d, %d, want 8, 24", at.Offset(), at.DataOffset())
+	}
+	if err := r.Seeker.Leave(at); err != nil {
+		t.Fatal(err)
+	}
+	// The parent keeps its position.
+	if v, err := r.ReadBits(4); err != nil || v != 0 {
+		t.Errorf("parent ReadBits = %d, %v, want 0", v, err)
+	}
+	if r.Offset() != 8 {
+		t.Errorf("parent Offset() = %d, want 8", r.Offset())
+	}
+
+	if err := r.Seeker.Leave(at); err == nil {
+		t.Errorf("Leave without Enter succeeded")
+	}
+	if _, err := (*Seeker)(nil).Enter(r, 0); err != ErrNoSeeker {
+		t.Errorf("Enter on a nil Seeker error = %v, want ErrNoSeeker", err)
+	}
+	if _, err := r.Seeker.Enter(r, -1); !sameAtError(err, &OffsetError{Offset: -1, Size: 4}) {
+		t.Errorf("Enter(-1) error = %v", err)
+	}
+}
+
+func TestSeekerSharedStart(t *testing.T) {
+	// Fields may share data if they start at the same offset, as a header
+	// and a table that begins with it.
+	data := []byte{0, 1, 2, 3}
+	r := NewBitReader(bytes.NewReader(data))
+	r.Seeker = NewSeeker(bytes.NewReader(data), int64(len(data)))
+	for _, n := range []uint{8, 16, 24} {
+		at, err := r.Seeker.Enter(r, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := at.ReadBits(n); err != nil {
+			t.Fatal(err)
+		}
+		if err := r.Seeker.Leave(at); err != nil {
+			t.Errorf("Leave after %d bits error = %v", n, err)
+		}
+	}
+	at, err := r.Seeker.Enter(r, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := at.ReadBits(8); err != nil {
+		t.Fatal(err)
+	}
+	want := &OverlapError{Offset: 2, Size: 1, OtherOffset: 1, OtherSize: 2}
+	if err := r.Seeker.Leave(at); !sameAtError(err, want) {
+		t.Errorf("Leave error = %v, want %v", err, want)
+	}
+}
+
+func TestSeekerSized(t *testing.T) {
+	// Offsets in a sized block start at zero, but @at fields in it count
+	// from the data.
+	data := []byte{0xFF, 0, 7}
+	r := NewBitReader(bytes.NewReader(data))
+	r.Seeker = NewSeeker(bytes.NewReader(data), int64(len(data)))
+	if _, err := r.ReadBits(8); err != nil {
+		t.Fatal(err)
+	}
+	s := NewSizedReader(r, 1)
+	if s.Seeker != r.Seeker || s.Offset() != 0 || s.DataOffset() != 8 {
+		t.Fatalf("sized reader at %d, %d in the data", s.Offset(), s.DataOffset())
+	}
+	at, err := s.Seeker.Enter(s.BitReader, s.DataOffset()/8+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, err := at.ReadBits(8); err != nil || v != 7 {
+		t.Errorf("ReadBits = %d, %v, want 7", v, err)
+	}
+	if err := s.Seeker.Leave(at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnmarshalAt(t *testing.T) {
+	// A one-byte header holding the offset of a byte elsewhere.
+	decode := func(r *BitReader) error {
+		off, err := r.ReadBits(8)
+		if err != nil {
+			return err
+		}
+		at, err := r.Seeker.Enter(r, int64(off))
+		if err != nil {
+			return err
+		}
+		if _, err := at.ReadBits(8); err != nil {
+			return err
+		}
+		return r.Seeker.Leave(at)
+	}
+	for _, tt := range []struct {
+		name     string
+		data     []byte
+		trailing bool
+	}{
+		{"field at the end", []byte{2, 0, 9}, false},
+		{"field inside", []byte{1, 9}, false},
+		{"data after the field", []byte{1, 9, 0}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			err := UnmarshalFunc(tt.data, decode)
+			var trailing *TrailingDataError
+			if errors.As(err, &trailing) != tt.trailing || (err != nil && !tt.trailing) {
+				t.Errorf("UnmarshalFunc error = %v, want trailing data: %t", err, tt.trailing)
+			}
+		})
+	}
+}
@@ -0,0 +1,453 @@
+package wire
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+var errTooManyBits = errors.New("wire: cannot read or write more than 64 bits at once")
+
+// ErrUnaligned is returned when a tap, such as the range covered by a
+// checksum, does not start and end on a byte boundary.
+var ErrUnaligned = errors.New("wire: tapped bytes are not byte aligned")
+
+// tap copies whole bytes to the writers in taps.
+func tap(taps []io.Writer, p []byte) {
+	for _, w := range taps {
+		w.Write(p)
+	}
+}
+
+// untap removes w from taps.
+func untap(taps []io.Writer, w io.Writer) []io.Writer {
+	for i := range taps {
+		if taps[i] == w {
+			return append(taps[:i], taps[i+1:]...)
+		}
+	}
+	return taps
+}
+
+// AlignPadding returns the number of bits needed to advance offset to the
+// next multiple of bits.
+func AlignPadding(offset, bits int64) int64 {
+	if bits <= 0 {
+		return 0
+	}
+	return (bits - offset%bits) % bits
+}
+
+// BitReader reads most-significant-bit-first fields from an io.Reader and
+// tracks the absolute bit offset from where it started.
+type BitReader struct {
+	// Strict makes ReadPadding reject non-zero bits even when the schema
+	// says they are ignored.
+	Strict bool
+	// Seeker reads the fields of @at annotations. Unmarshal sets it; other
+	// readers need one to decode packets with such fields.
+	Seeker *Seeker
+
+	r      io.Reader
+	buf    [1]byte
+	avail  uint   // unread bits remaining in buf[0]
+	ahead  []byte // bytes after buf[0] read by PeekBits
+	offset int64
+	// base is the bit offset in the data at which the reader starts, for
+	// readers of sized blocks and @at fields.
+	base int64
+	taps []io.Writer
+}
+
+func NewBitReader(r io.Reader) *BitReader {
+	return &BitReader{r: r}
+}
+
+// Offset returns the number of bits read so far.
+func (b *BitReader) Offset() int64 {
+	return b.offset
+}
+
+// DataOffset returns the bit offset in the data. It differs from Offset for
+// readers of sized blocks and @at fields, whose offsets start at zero.
+func (b *BitReader) DataOffset() int64 {
+	return b.base + b.offset
+}
+
+// ReadBits reads n bits, n <= 64, as an unsigned big-endian value.
+func (b *BitReader) ReadBits(n uint) (uint64, error) {
+	if n > 64 {
+		return 0, errTooManyBits
+	}
+	var v uint64
+	for n > 0 {
+		if b.avail == 0 {
+			if err := b.next(); err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return 0, err
+			}
+		}
+		k := n
+		if k > b.avail {
+			k = b.avail
+		}
+		chunk := uint64(b.buf[0]>>(b.avail-k)) & (1<<k - 1)
+		v = v<<k | chunk
+		b.avail -= k
+		n -= k
+		b.offset += int64(k)
+		if b.avail == 0 && len(b.taps) > 0 {
+			tap(b.taps, b.buf[:])
+		}
+	}
+	return v, nil
+}
+
+// Tap starts copying the bytes read from the current offset to w, which
+// must not fail. The offset must be byte aligned.
+func (b *BitReader) Tap(w io.Writer) error {
+	if b.offset%8 != 0 {
+		return ErrUnaligned
+	}
+	b.taps = append(b.taps, w)
+	return nil
+}
+
+// Untap stops copying bytes to w. The offset must be byte aligned.
+func (b *BitReader) Untap(w io.Writer) error {
+	b.taps = untap(b.taps, w)
+	if b.offset%8 != 0 {
+		return ErrUnaligned
+	}
+	return nil
+}
+
+// next loads the next byte into buf[0].
+func (b *BitReader) next() error {
+	if len(b.ahead) > 0 {
+		b.buf[0] = b.ahead[0]
+		b.ahead = b.ahead[:copy(b.ahead, b.ahead[1:])]
+	} else if _, err := io.ReadFull(b.r, b.buf[:]); err != nil {
+		return err
+	}
+	b.avail = 8
+	return nil
+}
+
+// PeekBits returns the next n bits, n <= 64, as ReadBits would, without
+// consuming them. The offset does not move.
+func (b *BitReader) PeekBits(n uint) (uint64, error) {
+	if n > 64 {
+		return 0, errTooManyBits
+	}
+	v := uint64(b.buf[0]) & (1<<b.avail - 1)
+	if n <= b.avail {
+		return v >> (b.avail - n), nil
+	}
+	rest := n - b.avail
+	for need := int(rest+7) / 8; len(b.ahead) < need; {
+		var c [1]byte
+		if _, err := io.ReadFull(b.r, c[:]); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return 0, err
+		}
+		b.ahead = append(b.ahead, c[0])
+	}
+	for _, c := range b.ahead {
+		k := rest
+		if k > 8 {
+			k = 8
+		}
+		v = v<<k | uint64(c>>(8-k))
+		if rest -= k; rest == 0 {
+			break
+		}
+	}
+	return v, nil
+}
+
+// ReadBool reads an n-bit bool: 8 bits normally, or 1 with @bit. Any
+// non-zero value is true unless the reader is Strict, in which case values
+// other than 0 and 1 are an *InvalidBoolError.
+func (b *BitReader) ReadBool(n uint) (bool, error) {
+	offset := b.offset
+	v, err := b.ReadBits(n)
+	if err != nil {
+		return false, err
+	}
+	if v > 1 && b.Strict {
+		return false, &InvalidBoolError{Offset: offset, Value: v}
+	}
+	return v != 0, nil
+}
+
+// AtEnd reports whether the underlying reader is exhausted at the current
+// offset. It may read ahead one byte, which later reads consume as usual.
+func (b *BitReader) AtEnd() (bool, error) {
+	if b.avail > 0 {
+		return false, nil
+	}
+	if err := b.next(); err != nil {
+		if err == io.EOF {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// Read reads len(p) whole bytes, which need not be byte aligned.
+func (b *BitReader) Read(p []byte) (int, error) {
+	if b.avail == 0 && len(b.ahead) == 0 {
+		n, err := io.ReadFull(b.r, p)
+		b.offset += int64(n) * 8
+		tap(b.taps, p[:n])
+		return n, err
+	}
+	for i := range p {
+		v, err := b.ReadBits(8)
+		if err != nil {
+			return i, err
+		}
+		p[i] = byte(v)
+	}
+	return len(p), nil
+}
+
+// Skip discards n bits.
+func (b *BitReader) Skip(n int64) error {
+	for n > 0 {
+		k := n
+		if k > 64 {
+			k = 64
+		}
+		if _, err := b.ReadBits(uint(k)); err != nil {
+			return err
+		}
+		n -= k
+	}
+	return nil
+}
+
+// Align skips to the next multiple of bits from the start.
+func (b *BitReader) Align(bits int64) error {
+	return b.Skip(AlignPadding(b.offset, bits))
+}
+
+// ReadPadding discards n bits of padding. If zero is set, or the reader is
+// Strict, it returns a *NonZeroPaddingError when any of the bits is set.
+func (b *BitReader) ReadPadding(n int64, zero bool) error {
+	if !zero && !b.Strict {
+		return b.Skip(n)
+	}
+	start := b.offset
+	for remaining := n; remaining > 0; {
+		k := remaining
+		if k > 64 {
+			k = 64
+		}
+		v, err := b.ReadBits(uint(k))
+		if err != nil {
+			return err
+		}
+		if v != 0 {
+			return &NonZeroPaddingError{Offset: start, Bits: n}
+		}
+		remaining -= k
+	}
+	return nil
+}
+
+// BitWriter writes most-significant-bit-first fields to an io.Writer and
+// tracks the absolute bit offset from where it started. Call Flush to write
+// a trailing partial byte.
+//
+// Between Hold and Release the output is kept in memory, so that Patch can
+// fill in fields, such as a checksum, whose value depends on what follows.
+type BitWriter struct {
+	w      io.Writer
+	buf    [1]byte
+	filled uint // bits already set in buf[0]
+	offset int64
+	taps   []io.Writer
+
+	holds  int    // pending Hold calls
+	held   []byte // output kept since the first Hold
+	heldAt int64  // bit offset of held[0]
+}
+
+func NewBitWriter(w io.Writer) *BitWriter {
+	return &BitWriter{w: w}
+}
+
+// Offset returns the number of bits written so far.
+func (b *BitWriter) Offset() int64 {
+	return b.offset
+}
+
+// WriteBits writes the low n bits of v, n <= 64.
+func (b *BitWriter) WriteBits(v uint64, n uint) error {
+	if n > 64 {
+		return errTooManyBits
+	}
+	for n > 0 {
+		k := 8 - b.filled
+		if k > n {
+			k = n
+		}
+		chunk := byte(v>>(n-k)) & (1<<k - 1)
+		b.buf[0] |= chunk << (8 - b.filled - k)
+		b.filled += k
+		n -= k
+		b.offset += int64(k)
+		if b.filled == 8 {
+			if _, err := b.emit(b.buf[:]); err != nil {
+				return err
+			}
+			b.buf[0], b.filled = 0, 0
+		}
+	}
+	return nil
+}
+
+// emit passes whole bytes to the taps and to the underlying writer, or keeps
+// them while held.
+func (b *BitWriter) emit(p []byte) (int, error) {
+	tap(b.taps, p)
+	if b.holds > 0 {
+		b.held = append(b.held, p...)
+		return len(p), nil
+	}
+	return b.w.Write(p)
+}
+
+// Tap starts copying the bytes written from the current offset to w, which
+// must not fail. The offset must be byte aligned.
+func (b *BitWriter) Tap(w io.Writer) error {
+	if b.offset%8 != 0 {
+		return ErrUnaligned
+	}
+	b.taps = append(b.taps, w)
+	return nil
+}
+
+// Untap stops copying bytes to w. The offset must be byte aligned.
+func (b *BitWriter) Untap(w io.Writer) error {
+	b.taps = untap(b.taps, w)
+	if b.offset%8 != 0 {
+		return ErrUnaligned
+	}
+	return nil
+}
+
+// Hold keeps the output from the current offset in memory until the
+// matching Release.
+func (b *BitWriter) Hold() {
+	if b.holds == 0 {
+		b.heldAt = b.offset - int64(b.filled)
+	}
+	b.holds++
+}
+
+// Release ends a Hold. The last one writes the held output.
+func (b *BitWriter) Release() error {
+	if b.holds == 0 {
+		return errors.New("wire: Release without Hold")
+	}
+	if b.holds--; b.holds > 0 || len(b.held) == 0 {
+		return nil
+	}
+	_, err := b.w.Write(b.held)
+	b.held = nil
+	return err
+}
+
+// Patch overwrites the n bits, n <= 64, at offset with the low n bits of v.
+// The bits must have been written since the first pending Hold.
+func (b *BitWriter) Patch(offset int64, v uint64, n uint) error {
+	if n > 64 {
+		return errTooManyBits
+	}
+	if b.holds == 0 || offset < b.heldAt || offset+int64(n) > b.offset {
+		return fmt.Errorf("wire: cannot patch %d bits at bit offset %d", n, offset)
+	}
+	for i := uint(0); i < n; i++ {
+		bit := offset + int64(i) - b.heldAt
+		c := &b.buf[0]
+		if j := bit / 8; j < int64(len(b.held)) {
+			c = &b.held[j]
+		}
+		mask := byte(0x80) >> (bit % 8)
+		if v>>(n-1-i)&1 != 0 {
+			*c |= mask
+		} else {
+			*c &^= mask
+		}
+	}
+	return nil
+}
+
+// WriteUint writes v as an n-bit unsigned integer. Unlike WriteBits it
+// returns an *OverflowError if v does not fit.
+func (b *BitWriter) WriteUint(v uint64, n uint) error {
+	if n < 64 && v >= 1<<n {
+		return &OverflowError{Value: v, Bits: n}
+	}
+	return b.WriteBits(v, n)
+}
+
+// WriteBool writes v as an n-bit 0 or 1.
+func (b *BitWriter) WriteBool(v bool, n uint) error {
+	var bit uint64
+	if v {
+		bit = 1
+	}
+	return b.WriteBits(bit, n)
+}
+
+// Write writes p as whole bytes, which need not be byte aligned.
+func (b *BitWriter) Write(p []byte) (int, error) {
+	if b.filled == 0 {
+		n, err := b.emit(p)
+		b.offset += int64(n) * 8
+		return n, err
+	}
+	for i, c := range p {
+		if err := b.WriteBits(uint64(c), 8); err != nil {
+			return i, err
+		}
+	}
+	return len(p), nil
+}
+
+// Zero writes n zero bits.
+func (b *BitWriter) Zero(n int64) error {
+	for n > 0 {
+		k := n
+		if k > 64 {
+			k = 64
+		}
+		if err := b.WriteBits(0, uint(k)); err != nil {
+			return err
+		}
+		n -= k
+	}
+	return nil
+}
+
+// Align pads with zero bits to the next multiple of bits from the start.
+func (b *BitWriter) Align(bits int64) error {
+	return b.Zero(AlignPadding(b.offset, bits))
+}
+
+// Flush pads a trailing partial byte with zero bits and writes it.
+func (b *BitWriter) Flush() error {
+	if b.filled == 0 {
+		return nil
+	}
+	return b.Align(8)
+}
@@ -0,0 +1,245 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReadBits(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		data   []byte
+		widths []uint
+		want   []uint64
+		err    error
+	}{
+		{"msb first", []byte{0b1011_0010}, []uint{1, 1, 2, 4}, []uint64{1, 0, 3, 2}, nil},
+		{"whole bytes", []byte{0x12, 0x34}, []uint{8, 8}, []uint64{0x12, 0x34}, nil},
+		{"big endian", []byte{0x12, 0x34, 0x56}, []uint{24}, []uint64{0x123456}, nil},
+		{"cross byte", []byte{0xAB, 0xCD}, []uint{4, 8, 4}, []uint64{0xA, 0xBC, 0xD}, nil},
+		{"odd widths", []byte{0b1110_0101, 0b1100_0000}, []uint{3, 7}, []uint64{0b111, 0b0010111}, nil},
+		{"64 bits unaligned", []byte{0xF1, 0x23, 0x45, 0x67, 0x89, 0xAB, 0xCD, 0xEF, 0x0F}, []uint{4, 64, 4}, []uint64{0xF, 0x123456789ABCDEF0, 0xF}, nil},
+		{"zero width", []byte{0xFF}, []uint{0, 8}, []uint64{0, 0xFF}, nil},
+		{"short", []byte{0xAB}, []uint{4, 8}, []uint64{0xA}, io.ErrUnexpectedEOF},
+		{"too wide", []byte{}, []uint{65}, nil, errTooManyBits},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewBitReader(bytes.NewReader(tt.data))
+			var offset int64
+			for i, n := range tt.widths {
+				got, err := r.ReadBits(n)
+				if i == len(tt.want) {
+					if err != tt.err {
+						t.Fatalf("ReadBits(%d) error = %v, want %v", n, err, tt.err)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("ReadBits(%d) error = %v", n, err)
+				}
+				if got != tt.want[i] {
+					t.Errorf("ReadBits(%d) = %#x, want %#x", n, got, tt.want[i])
+				}
+				offset += int64(n)
+				if r.Offset() != offset {
+					t.Errorf("Offset() = %d, want %d", r.Offset(), offset)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteBits(t *testing.T) {
+	type write struct {
+		v uint64
+		n uint
+	}
+	for _, tt := range []struct {
+		name   string
+		writes []write
+		want   []byte
+	}{
+		{"msb first", []write{{1, 1}, {0, 1}, {3, 2}, {2, 4}}, []byte{0b1011_0010}},
+		{"big endian", []write{{0x123456, 24}}, []byte{0x12, 0x34, 0x56}},
+		{"cross byte", []write{{0xA, 4}, {0xBC, 8}, {0xD, 4}}, []byte{0xAB, 0xCD}},
+		{"64 bits unaligned", []write{{0xF, 4}, {0x123456789ABCDEF0, 64}, {0xF, 4}}, []byte{0xF1, 0x23, 0x45, 0x67, 0x89, 0xAB, 0xCD, 0xEF, 0x0F}},
+		{"flush pads", []write{{0b101, 3}}, []byte{0b1010_0000}},
+		{"flush pads after bytes", []write{{0xAB, 8}, {1, 1}}, []byte{0xAB, 0x80}},
+		{"excess bits dropped", []write{{0xFF, 4}, {0, 4}}, []byte{0xF0}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewBitWriter(&buf)
+			var offset int64
+			for _, wr := range tt.writes {
+				if err := w.WriteBits(wr.v, wr.n); err != nil {
+					t.Fatalf("WriteBits(%#x, %d) error = %v", wr.v, wr.n, err)
+				}
+				offset += int64(wr.n)
+			}
+			if w.Offset() != offset {
+				t.Errorf("Offset() = %d, want %d", w.Offset(), offset)
+			}
+			if err := w.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Errorf("wrote %08b, want %08b", buf.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func TestPeekBits(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		data []byte
+		skip uint // bits read before peeking
+		peek uint
+		want uint64
+		err  error
+	}{
+		{"within byte", []byte{0b1011_0010}, 2, 3, 0b110, nil},
+		{"whole byte", []byte{0xAB, 0xCD}, 0, 8, 0xAB, nil},
+		{"cross byte", []byte{0xAB, 0xCD}, 4, 8, 0xBC, nil},
+		{"several bytes", []byte{0xAB, 0xCD, 0xEF, 0x12}, 4, 24, 0xBCDEF1, nil},
+		{"at end", []byte{0xAB}, 8, 1, 0, io.ErrUnexpectedEOF},
+		{"past end", []byte{0xAB, 0xCD}, 4, 16, 0, io.ErrUnexpectedEOF},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewBitReader(bytes.NewReader(tt.data))
+			if _, err := r.ReadBits(tt.skip); err != nil {
+				t.Fatal(err)
+			}
+			got, err := r.PeekBits(tt.peek)
+			if err != tt.err {
+				t.Fatalf("PeekBits(%d) error = %v, want %v", tt.peek, err, tt.err)
+			}
+			if r.Offset() != int64(tt.skip) {
+				t.Errorf("Offset() = %d after PeekBits, want %d", r.Offset(), tt.skip)
+			}
+			if err != nil {
+				return
+			}
+			if got != tt.want {
+				t.Errorf("PeekBits(%d) = %#x, want %#x", tt.peek, got, tt.want)
+			}
+
+			// Peeking again and then reading must see the same bits.
+			if again, err := r.PeekBits(tt.peek); err != nil || again != got {
+				t.Errorf("second PeekBits(%d) = %#x, %v, want %#x", tt.peek, again, err, got)
+			}
+			read, err := r.ReadBits(tt.peek)
+			if err != nil || read != got {
+				t.Errorf("ReadBits(%d) after PeekBits = %#x, %v, want %#x", tt.peek, read, err, got)
+			}
+		})
+	}
+}
+
+func TestPeekBitsThenRead(t *testing.T) {
+	r := NewBitReader(bytes.NewReader([]byte{0x12, 0x34, 0x56}))
+	if _, err := r.PeekBits(20); err != nil {
+		t.Fatal(err)
+	}
+	// Whole-byte reads must drain the bytes PeekBits read ahead first.
+	p := make([]byte, 3)
+	if _, err := io.ReadFull(r, p); err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x12, 0x34, 0x56}; !bytes.Equal(p, want) {
+		t.Errorf("Read() = %#x, want %#x", p, want)
+	}
+	if end, err := r.AtEnd(); err != nil || !end {
+		t.Errorf("AtEnd() = %v, %v, want true", end, err)
+	}
+}
+
+func TestReadPadding(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		data   []byte
+		skip   uint
+		n      int64
+		zero   bool
+		strict bool
+		err    *NonZeroPaddingError
+	}{
+		{"ignored", []byte{0xFF, 0xAB}, 0, 8, false, false, nil},
+		{"zero", []byte{0x00, 0xAB}, 0, 8, true, false, nil},
+		{"nonzero", []byte{0x01, 0xAB}, 0, 8, true, false, &NonZeroPaddingError{Offset: 0, Bits: 8}},
+		{"strict", []byte{0x80, 0xAB}, 0, 8, false, true, &NonZeroPaddingError{Offset: 0, Bits: 8}},
+		{"unaligned", []byte{0xF0, 0xAB}, 4, 4, true, false, nil},
+		{"unaligned nonzero", []byte{0xF1, 0xAB}, 4, 4, true, false, &NonZeroPaddingError{Offset: 4, Bits: 4}},
+		{"wide", make([]byte, 11), 0, 80, true, false, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewBitReader(bytes.NewReader(tt.data))
+			r.Strict = tt.strict
+			if _, err := r.ReadBits(tt.skip); err != nil {
+				t.Fatal(err)
+			}
+			err := r.ReadPadding(tt.n, tt.zero)
+			if tt.err != nil {
+				var got *NonZeroPaddingError
+				if !errors.As(err, &got) || *got != *tt.err {
+					t.Fatalf("ReadPadding(%d) error = %v, want %v", tt.n, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ReadPadding(%d) error = %v", tt.n, err)
+			}
+			if want := int64(tt.skip) + tt.n; r.Offset() != want {
+				t.Errorf("Offset() = %d, want %d", r.Offset(), want)
+			}
+			// The field after the padding must start where it ends.
+			if v, err := r.ReadBits(8); err != nil || v != uint64(tt.data[len(tt.data)-1]) {
+				t.Errorf("ReadBits(8) after padding = %#x, %v", v, err)
+			}
+		})
+	}
+}
+
+func TestAlign(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+	w.WriteBits(0b101, 3)
+	if err := w.Align(8); err != nil {
+		t.Fatal(err)
+	}
+	w.WriteBits(0xAB, 8)
+	if err := w.Align(32); err != nil {
+		t.Fatal(err)
+	}
+	w.WriteBits(1, 1)
+	if err := w.Zero(15); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0b1010_0000, 0xAB, 0, 0, 0x80, 0}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("wrote %#x, want %#x", buf.Bytes(), want)
+	}
+
+	r := NewBitReader(bytes.NewReader(buf.Bytes()))
+	if v, _ := r.ReadBits(3); v != 0b101 {
+		t.Errorf("ReadBits(3) = %#b, want 0b101", v)
+	}
+	if err := r.Align(8); err != nil || r.Offset() != 8 {
+		t.Fatalf("Align(8) = %v, offset %d, want 8", err, r.Offset())
+	}
+	if v, _ := r.ReadBits(8); v != 0xAB {
+		t.Errorf("ReadBits(8) = %#x, want 0xab", v)
+	}
+	if err := r.Align(32); err != nil || r.Offset() != 32 {
+		t.Fatalf("Align(32) = %v, offset %d, want 32", err, r.Offset())
+	}
+	if v, _ := r.ReadBits(1); v != 1 {
+		t.Errorf("ReadBits(1) = %d, want 1", v)
+	}
+}
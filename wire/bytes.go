@@ -0,0 +1,161 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxBytesLength bounds the size of a single byte string or string read by a
+// decoder, so that a corrupt or hostile length cannot make it allocate without
+// limit. Zero means no limit.
+var MaxBytesLength int64 = 1 << 26
+
+// ErrTerminator is returned when encoding a terminated string or byte string
+// that contains its terminator.
+var ErrTerminator = errors.New("wire: value contains its terminator")
+
+// BytesTooLongError is returned when a byte string is longer than
+// MaxBytesLength.
+type BytesTooLongError struct {
+	Length int64
+	Limit  int64
+}
+
+func (e *BytesTooLongError) Error() string {
+	if e.Length < 0 {
+		return fmt.Sprintf("byte string exceeds %d bytes", e.Limit)
+	}
+	return fmt.Sprintf("byte string of %d bytes exceeds %d bytes", e.Length, e.Limit)
+}
+
+// LengthError is returned when encoding a value whose length differs from the
+// one the schema gives it.
+type LengthError struct {
+	Length uint64
+	Want   uint64
+}
+
+func (e *LengthError) Error() string {
+	return fmt.Sprintf("length %d does not match %d", e.Length, e.Want)
+}
+
+// ReadBytes reads an n byte string. The buffer grows with the data actually
+// read, so a large n on short input fails without allocating n bytes.
+func ReadBytes(r *BitReader, n uint64) ([]byte, error) {
+	if MaxBytesLength > 0 && n > uint64(MaxBytesLength) {
+		return nil, &BytesTooLongError{Length: int64(n), Limit: MaxBytesLength}
+	}
+	if n <= 4096 {
+		b := make([]byte, n)
+		if _, err := r.Read(b); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		return b, nil
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// WriteBytes writes b, which must be n bytes long.
+func WriteBytes(w *BitWriter, b []byte, n uint64) error {
+	if uint64(len(b)) != n {
+		return &LengthError{Length: uint64(len(b)), Want: n}
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// ReadTerminated reads a string of unit byte code units ended by an all-zero
+// unit, as in a CString, and returns it without the terminator.
+func ReadTerminated(r *BitReader, unit int) ([]byte, error) {
+	var out []byte
+	c := make([]byte, unit)
+	for {
+		if _, err := r.Read(c); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		if isZero(c) {
+			return out, nil
+		}
+		if MaxBytesLength > 0 && int64(len(out)+unit) > MaxBytesLength {
+			return nil, &BytesTooLongError{Length: -1, Limit: MaxBytesLength}
+		}
+		out = append(out, c...)
+	}
+}
+
+// WriteTerminated writes b followed by an all-zero unit byte code unit. b
+// must not contain the terminator.
+func WriteTerminated(w *BitWriter, b []byte, unit int) error {
+	for i := 0; i+unit <= len(b); i += unit {
+		if isZero(b[i : i+unit]) {
+			return ErrTerminator
+		}
+	}
+	if _, err := w.Write(b); err != nil {
+		return err
+	}
+	return w.Zero(int64(unit) * 8)
+}
+
+func isZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadPrefixed reads a byte string preceded by its length in a bits wide
+// field, most significant byte first unless le is set.
+func ReadPrefixed(r *BitReader, bits uint, le bool) ([]byte, error) {
+	n, err := r.ReadBits(bits)
+	if err != nil {
+		return nil, err
+	}
+	if le {
+		n = swapBytes(n, bits)
+	}
+	return ReadBytes(r, n)
+}
+
+// WritePrefixed writes b preceded by its length in a bits wide field.
+func WritePrefixed(w *BitWriter, b []byte, bits uint, le bool) error {
+	n := uint64(len(b))
+	if bits < 64 && n >= 1<<bits {
+		return &OverflowError{Value: n, Bits: bits}
+	}
+	if le {
+		n = swapBytes(n, bits)
+	}
+	if err := w.WriteBits(n, bits); err != nil {
+		return err
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// swapBytes reverses the byte order of the low bits of v.
+func swapBytes(v uint64, bits uint) uint64 {
+	var out uint64
+	for i := uint(0); i < bits; i += 8 {
+		out = out<<8 | v&0xFF
+		v >>= 8
+	}
+	return out
+}
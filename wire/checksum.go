@@ -0,0 +1,305 @@
+package wire
+
+import (
+	"fmt"
+	"hash/adler32"
+	"sort"
+	"sync"
+)
+
+// Checksum accumulates the bytes covered by a checksum field.
+type Checksum interface {
+	// Write never returns an error.
+	Write(p []byte) (int, error)
+	Reset()
+	// Sum returns the checksum of the bytes written so far.
+	Sum() uint64
+	// Bits is the width of the value returned by Sum.
+	Bits() int
+}
+
+var (
+	checksumsMu sync.RWMutex
+	checksums   = map[string]func() Checksum{}
+)
+
+// RegisterChecksum makes a checksum algorithm available by name to schemas
+// using `checksum(name, ...)`. It panics if name is already registered.
+func RegisterChecksum(name string, new func() Checksum) {
+	checksumsMu.Lock()
+	defer checksumsMu.Unlock()
+	if _, ok := checksums[name]; ok {
+		panic("wire: checksum " + name + " registered twice")
+	}
+	checksums[name] = new
+}
+
+// NewChecksum returns a fresh instance of the named algorithm.
+func NewChecksum(name string) (Checksum, error) {
+	checksumsMu.RLock()
+	new, ok := checksums[name]
+	checksumsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("wire: unknown checksum algorithm %q", name)
+	}
+	return new(), nil
+}
+
+// Checksums returns the names of all registered algorithms, sorted.
+func Checksums() []string {
+	checksumsMu.RLock()
+	defer checksumsMu.RUnlock()
+	names := make([]string, 0, len(checksums))
+	for name := range checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ChecksumMismatchError is returned when a decoded checksum field does not
+// match the checksum computed over the bytes it covers.
+type ChecksumMismatchError struct {
+	Algorithm string
+	Expected  uint64
+	Got       uint64
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("%s checksum mismatch: computed 0x%X, got 0x%X", e.Algorithm, e.Expected, e.Got)
+}
+
+// VerifyChecksum compares a decoded checksum with the one computed by c.
+func VerifyChecksum(algorithm string, c Checksum, got uint64) error {
+	if sum := c.Sum(); sum != got {
+		return &ChecksumMismatchError{
+			Algorithm: algorithm,
+			Expected:  sum,
+			Got:       got,
+		}
+	}
+	return nil
+}
+
+func init() {
+	for name, params := range map[string]crcParams{
+		"crc8":         {width: 8, poly: 0x07},
+		"crc16_ccitt":  {width: 16, poly: 0x1021, init: 0xFFFF},
+		"crc16_xmodem": {width: 16, poly: 0x1021},
+		"crc16_ibm":    {width: 16, poly: 0x8005, reflect: true},
+		"crc16_modbus": {width: 16, poly: 0x8005, init: 0xFFFF, reflect: true},
+		"crc32":        {width: 32, poly: 0x04C11DB7, init: 0xFFFFFFFF, reflect: true, xorout: 0xFFFFFFFF},
+		"crc32c":       {width: 32, poly: 0x1EDC6F41, init: 0xFFFFFFFF, reflect: true, xorout: 0xFFFFFFFF},
+		"crc64":        {width: 64, poly: 0x42F0E1EBA9EA3693, init: 1<<64 - 1, reflect: true, xorout: 1<<64 - 1},
+		"crc64_iso":    {width: 64, poly: 0x1B, init: 1<<64 - 1, reflect: true, xorout: 1<<64 - 1},
+	} {
+		table := newCRCTable(params)
+		RegisterChecksum(name, func() Checksum {
+			c := &crc{table: table}
+			c.Reset()
+			return c
+		})
+	}
+
+	RegisterChecksum("adler32", func() Checksum { return &adler{h: adler32.New()} })
+	RegisterChecksum("fletcher16", func() Checksum { return new(fletcher16) })
+	RegisterChecksum("fletcher32", func() Checksum { return new(fletcher32) })
+	RegisterChecksum("xor8", func() Checksum { return new(xor8) })
+	RegisterChecksum("internet", func() Checksum { return new(internet) })
+}
+
+// crcParams describes a CRC in the Rocksoft model. Reflected CRCs reflect both
+// input and output; init is assumed to be symmetric (all zeros or all ones).
+type crcParams struct {
+	width   int
+	poly    uint64
+	init    uint64
+	reflect bool
+	xorout  uint64
+}
+
+type crcTable struct {
+	crcParams
+	mask  uint64
+	table [256]uint64
+}
+
+func newCRCTable(p crcParams) *crcTable {
+	t := &crcTable{crcParams: p, mask: 1<<p.width - 1}
+	if p.reflect {
+		var poly uint64
+		for i := 0; i < p.width; i++ {
+			if p.poly&(1<<i) != 0 {
+				poly |= 1 << (p.width - 1 - i)
+			}
+		}
+		for i := range t.table {
+			crc := uint64(i)
+			for j := 0; j < 8; j++ {
+				if crc&1 != 0 {
+					crc = crc>>1 ^ poly
+				} else {
+					crc >>= 1
+				}
+			}
+			t.table[i] = crc
+		}
+		return t
+	}
+	top := uint64(1) << (p.width - 1)
+	for i := range t.table {
+		crc := uint64(i) << (p.width - 8)
+		for j := 0; j < 8; j++ {
+			if crc&top != 0 {
+				crc = crc<<1 ^ p.poly
+			} else {
+				crc <<= 1
+			}
+		}
+		t.table[i] = crc & t.mask
+	}
+	return t
+}
+
+type crc struct {
+	table *crcTable
+	value uint64
+}
+
+func (c *crc) Write(p []byte) (int, error) {
+	t := c.table
+	v := c.value
+	if t.reflect {
+		for _, b := range p {
+			v = t.table[byte(v)^b] ^ v>>8
+		}
+	} else {
+		shift := t.width - 8
+		for _, b := range p {
+			v = (t.table[byte(v>>shift)^b] ^ v<<8) & t.mask
+		}
+	}
+	c.value = v
+	return len(p), nil
+}
+
+func (c *crc) Reset()      { c.value = c.table.init }
+func (c *crc) Sum() uint64 { return (c.value ^ c.table.xorout) & c.table.mask }
+func (c *crc) Bits() int   { return c.table.width }
+
+type adler struct {
+	h interface {
+		Write(p []byte) (int, error)
+		Reset()
+		Sum32() uint32
+	}
+}
+
+func (a *adler) Write(p []byte) (int, error) { return a.h.Write(p) }
+func (a *adler) Reset()                      { a.h.Reset() }
+func (a *adler) Sum() uint64                 { return uint64(a.h.Sum32()) }
+func (a *adler) Bits() int                   { return 32 }
+
+type fletcher16 struct {
+	sum1, sum2 uint16
+}
+
+func (f *fletcher16) Write(p []byte) (int, error) {
+	for _, b := range p {
+		f.sum1 = (f.sum1 + uint16(b)) % 255
+		f.sum2 = (f.sum2 + f.sum1) % 255
+	}
+	return len(p), nil
+}
+
+func (f *fletcher16) Reset()      { *f = fletcher16{} }
+func (f *fletcher16) Sum() uint64 { return uint64(f.sum2)<<8 | uint64(f.sum1) }
+func (f *fletcher16) Bits() int   { return 16 }
+
+// fletcher32 sums little-endian 16-bit words; an odd trailing byte is
+// padded with zero.
+type fletcher32 struct {
+	sum1, sum2 uint32
+	odd        bool
+	low        byte
+}
+
+func (f *fletcher32) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if !f.odd {
+			f.low, f.odd = b, true
+			continue
+		}
+		f.add(uint32(f.low) | uint32(b)<<8)
+		f.odd = false
+	}
+	return len(p), nil
+}
+
+func (f *fletcher32) add(word uint32) {
+	f.sum1 = (f.sum1 + word) % 65535
+	f.sum2 = (f.sum2 + f.sum1) % 65535
+}
+
+func (f *fletcher32) Reset() { *f = fletcher32{} }
+
+func (f *fletcher32) Sum() uint64 {
+	sum1, sum2 := f.sum1, f.sum2
+	if f.odd {
+		sum1 = (sum1 + uint32(f.low)) % 65535
+		sum2 = (sum2 + sum1) % 65535
+	}
+	return uint64(sum2)<<16 | uint64(sum1)
+}
+
+func (f *fletcher32) Bits() int { return 32 }
+
+type xor8 byte
+
+func (x *xor8) Write(p []byte) (int, error) {
+	for _, b := range p {
+		*x ^= xor8(b)
+	}
+	return len(p), nil
+}
+
+func (x *xor8) Reset()      { *x = 0 }
+func (x *xor8) Sum() uint64 { return uint64(*x) }
+func (x *xor8) Bits() int   { return 8 }
+
+// internet is the RFC 1071 ones' complement sum of big-endian 16-bit words.
+type internet struct {
+	sum  uint32
+	odd  bool
+	high byte
+}
+
+func (c *internet) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if !c.odd {
+			c.high, c.odd = b, true
+			continue
+		}
+		c.sum += uint32(c.high)<<8 | uint32(b)
+		if c.sum > 0xFFFF {
+			c.sum = c.sum&0xFFFF + c.sum>>16
+		}
+		c.odd = false
+	}
+	return len(p), nil
+}
+
+func (c *internet) Reset() { *c = internet{} }
+
+func (c *internet) Sum() uint64 {
+	sum := c.sum
+	if c.odd {
+		sum += uint32(c.high) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return uint64(^uint16(sum))
+}
+
+func (c *internet) Bits() int { return 16 }
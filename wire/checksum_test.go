@@ -0,0 +1,101 @@
+package wire
+
+import "testing"
+
+// checkValues are the checksums of "123456789" for every built-in algorithm,
+// as listed in the usual catalogues of CRC and checksum parameters.
+var checkValues = map[string]uint64{
+	"crc8":         0xF4,
+	"crc16_ccitt":  0x29B1,
+	"crc16_xmodem": 0x31C3,
+	"crc16_ibm":    0xBB3D,
+	"crc16_modbus": 0x4B37,
+	"crc32":        0xCBF43926,
+	"crc32c":       0xE3069283,
+	"crc64":        0x995DC9BBDF1939FA,
+	"crc64_iso":    0xB90956C775A41001,
+	"adler32":      0x091E01DE,
+	"fletcher16":   0x1EDE,
+	"fletcher32":   0xDF09D509,
+	"xor8":         0x31,
+	"internet":     0xF62A,
+}
+
+func TestChecksumCheckValues(t *testing.T) {
+	for _, name := range Checksums() {
+		want, ok := checkValues[name]
+		if !ok {
+			t.Errorf("%s: no check value", name)
+			continue
+		}
+		c, err := NewChecksum(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.Write([]byte("123456789"))
+		if got := c.Sum(); got != want {
+			t.Errorf("%s: Sum() = %#x, want %#x", name, got, want)
+		}
+
+		// Split writes and Reset must not change the result.
+		c.Reset()
+		c.Write([]byte("1234"))
+		c.Write([]byte("56789"))
+		if got := c.Sum(); got != want {
+			t.Errorf("%s: Sum() after split writes = %#x, want %#x", name, got, want)
+		}
+	}
+}
+
+func TestVerifyChecksum(t *testing.T) {
+	c, _ := NewChecksum("crc32")
+	c.Write([]byte("123456789"))
+	if err := VerifyChecksum("crc32", c, 0xCBF43926); err != nil {
+		t.Errorf("VerifyChecksum() = %v", err)
+	}
+	err := VerifyChecksum("crc32", c, 1)
+	if e, ok := err.(*ChecksumMismatchError); !ok || e.Expected != 0xCBF43926 || e.Got != 1 {
+		t.Errorf("VerifyChecksum() = %v, want a mismatch", err)
+	}
+}
+
+func TestChecksumTap(t *testing.T) {
+	var buf []byte
+	w := NewBitWriter(writerFunc(func(p []byte) (int, error) {
+		buf = append(buf, p...)
+		return len(p), nil
+	}))
+	c, _ := NewChecksum("crc16_xmodem")
+	w.WriteBits(0xAB, 8)
+	w.Hold()
+	w.WriteBits(0, 16)
+	if err := w.Tap(c); err != nil {
+		t.Fatal(err)
+	}
+	w.Write([]byte("123456789"))
+	if err := w.Untap(c); err != nil {
+		t.Fatal(err)
+	}
+	if len(buf) != 1 {
+		t.Fatalf("held output was written early: % x", buf)
+	}
+	if err := w.Patch(8, c.Sum(), 16); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Release(); err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte{0xAB, 0x31, 0xC3}, "123456789"...)
+	if string(buf) != string(want) {
+		t.Errorf("output = % x, want % x", buf, want)
+	}
+
+	w.WriteBits(1, 1)
+	if err := w.Tap(c); err != ErrUnaligned {
+		t.Errorf("Tap() at an unaligned offset = %v, want ErrUnaligned", err)
+	}
+}
+
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
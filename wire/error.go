@@ -0,0 +1,162 @@
+// Package wire is the runtime support library for code generated by protodecl.
+package wire
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DecodeError records the bit offset and field at which decoding failed.
+type DecodeError struct {
+	Offset int64
+	Field  string
+	Err    error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decode %s at bit offset %d: %v", e.Field, e.Offset, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// UnknownEnumError is returned when a closed enum holds an undeclared value.
+// High holds bits 64 to 127 of 128-bit enums.
+type UnknownEnumError struct {
+	Enum  string
+	Value uint64
+	High  uint64
+}
+
+func (e *UnknownEnumError) Error() string {
+	return fmt.Sprintf("unknown %s value %s", e.Enum, Uint128{Hi: e.High, Lo: e.Value})
+}
+
+// NonZeroPaddingError is returned when padding that must be zero is not.
+// Offset is the bit offset of the padding.
+type NonZeroPaddingError struct {
+	Offset int64
+	Bits   int64
+}
+
+func (e *NonZeroPaddingError) Error() string {
+	return fmt.Sprintf("non-zero bits in %d-bit padding at bit offset %d", e.Bits, e.Offset)
+}
+
+// PaddingWidthError is returned when preserved padding is wider than the 64
+// bits kept for it.
+type PaddingWidthError struct {
+	Bits int64
+}
+
+func (e *PaddingWidthError) Error() string {
+	return fmt.Sprintf("preserved padding of %d bits exceeds 64 bits", e.Bits)
+}
+
+// InvalidBoolError is returned by a Strict reader when a bool field holds a
+// value other than 0 or 1. Offset is the bit offset of the field.
+type InvalidBoolError struct {
+	Offset int64
+	Value  uint64
+}
+
+func (e *InvalidBoolError) Error() string {
+	return fmt.Sprintf("invalid bool value %d at bit offset %d", e.Value, e.Offset)
+}
+
+// ConstraintError is returned when a field violates its `where` constraint or
+// an assert statement fails. Path names the field, as in "Header.version",
+// or the packet for an assert; Value is the offending field value and is nil
+// for asserts. Condition is the schema text of the condition.
+type ConstraintError struct {
+	Path      string
+	Value     interface{}
+	Condition string
+	Message   string
+}
+
+func (e *ConstraintError) Error() string {
+	switch {
+	case e.Message != "":
+		return fmt.Sprintf("%s: %s", e.Path, e.Message)
+	case e.Value != nil:
+		return fmt.Sprintf("%s = %v does not satisfy %s", e.Path, e.Value, e.Condition)
+	default:
+		return fmt.Sprintf("%s: assertion %s failed", e.Path, e.Condition)
+	}
+}
+
+// WrapDecodeError attributes err to a field of a packet decoded at offset. An
+// error that is already a *DecodeError comes from a packet held in the field;
+// it keeps its offset, and its path, which starts with the name of that
+// packet, continues from the field: Outer.inner.field.
+func WrapDecodeError(err error, packet, field string, offset int64) error {
+	path := fieldPath(packet, field)
+	if inner, ok := err.(*DecodeError); ok {
+		return &DecodeError{Offset: inner.Offset, Field: joinPath(path, inner.Field), Err: inner.Err}
+	}
+	return &DecodeError{Offset: offset, Field: path, Err: err}
+}
+
+func fieldPath(packet, field string) string {
+	if field == "" {
+		return packet
+	}
+	return packet + "." + field
+}
+
+// joinPath replaces the packet name at the start of the inner path with the
+// path of the field holding the packet.
+func joinPath(path, inner string) string {
+	if _, rest, ok := strings.Cut(inner, "."); ok {
+		return path + "." + rest
+	}
+	return path
+}
+
+// EncodeError records the field at which encoding failed.
+type EncodeError struct {
+	Field string
+	Err   error
+}
+
+func (e *EncodeError) Error() string {
+	return fmt.Sprintf("encode %s: %v", e.Field, e.Err)
+}
+
+func (e *EncodeError) Unwrap() error {
+	return e.Err
+}
+
+// WrapEncodeError attributes err to a field of a packet. The path of an error
+// that is already an *EncodeError continues from the field, as in
+// WrapDecodeError.
+func WrapEncodeError(err error, packet, field string) error {
+	path := fieldPath(packet, field)
+	if inner, ok := err.(*EncodeError); ok {
+		return &EncodeError{Field: joinPath(path, inner.Field), Err: inner.Err}
+	}
+	return &EncodeError{Field: path, Err: err}
+}
+
+// OverflowError is returned when encoding a value that does not fit in the
+// bits of its field.
+type OverflowError struct {
+	Value uint64
+	Bits  uint
+}
+
+func (e *OverflowError) Error() string {
+	return fmt.Sprintf("value %d does not fit in %d bits", e.Value, e.Bits)
+}
+
+// TrailingDataError is returned by Unmarshal when data remains after the
+// packet. Offset is the bit offset at which the packet ended.
+type TrailingDataError struct {
+	Offset int64
+}
+
+func (e *TrailingDataError) Error() string {
+	return fmt.Sprintf("trailing data after bit offset %d", e.Offset)
+}
@@ -0,0 +1,52 @@
+package wire
+
+import (
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestWrapDecodeError(t *testing.T) {
+	// Inner is decoded as the field inner of Outer, which Top holds as
+	// outer.
+	inner := WrapDecodeError(io.ErrUnexpectedEOF, "Inner", "field", 40)
+	outer := WrapDecodeError(inner, "Outer", "inner", 8)
+	top := WrapDecodeError(outer, "Top", "outer", 0)
+	for _, tt := range []struct {
+		err    error
+		field  string
+		offset int64
+	}{
+		{inner, "Inner.field", 40},
+		{outer, "Outer.inner.field", 40},
+		{top, "Top.outer.inner.field", 40},
+		{WrapDecodeError(io.ErrUnexpectedEOF, "Inner", "", 16), "Inner", 16},
+		{WrapDecodeError(WrapDecodeError(io.ErrUnexpectedEOF, "Inner", "", 16), "Outer", "inner", 8), "Outer.inner", 16},
+	} {
+		var d *DecodeError
+		if !errors.As(tt.err, &d) {
+			t.Fatalf("%v is not a *DecodeError", tt.err)
+		}
+		if d.Field != tt.field || d.Offset != tt.offset {
+			t.Errorf("DecodeError at %s, bit %d, want %s, bit %d", d.Field, d.Offset, tt.field, tt.offset)
+		}
+		if !errors.Is(tt.err, io.ErrUnexpectedEOF) {
+			t.Errorf("%v does not wrap io.ErrUnexpectedEOF", tt.err)
+		}
+	}
+	if got, want := top.Error(), "decode Top.outer.inner.field at bit offset 40: unexpected EOF"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestWrapEncodeError(t *testing.T) {
+	err := WrapEncodeError(WrapEncodeError(&OverflowError{Value: 300, Bits: 8}, "Inner", "count"), "Outer", "inner")
+	var e *EncodeError
+	if !errors.As(err, &e) || e.Field != "Outer.inner.count" {
+		t.Fatalf("error = %v, want one for Outer.inner.count", err)
+	}
+	var overflow *OverflowError
+	if !errors.As(err, &overflow) {
+		t.Errorf("%v does not wrap the *OverflowError", err)
+	}
+}
@@ -0,0 +1,27 @@
+package wire
+
+// Div returns a/b for schema expressions, or zero if b is zero, so that a
+// hostile divisor cannot make a decoder panic.
+func Div[T int64 | uint64](a, b T) T {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+// Mod returns a%b for schema expressions, or zero if b is zero.
+func Mod[T int64 | uint64](a, b T) T {
+	if b == 0 {
+		return 0
+	}
+	return a % b
+}
+
+// Bool returns 1 for true and 0 for false, the value of a condition used as
+// a number.
+func Bool(b bool) uint64 {
+	if b {
+		return 1
+	}
+	return 0
+}
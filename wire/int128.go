@@ -0,0 +1,198 @@
+package wire
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/big"
+	"math/bits"
+)
+
+// Uint128 is an unsigned 128-bit integer.
+type Uint128 struct {
+	Hi, Lo uint64
+}
+
+// Int128 is a two's complement signed 128-bit integer.
+type Int128 struct {
+	Hi int64
+	Lo uint64
+}
+
+// Cmp returns -1, 0 or +1 depending on whether u is less than, equal to or
+// greater than v.
+func (u Uint128) Cmp(v Uint128) int {
+	switch {
+	case u.Hi < v.Hi, u.Hi == v.Hi && u.Lo < v.Lo:
+		return -1
+	case u == v:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// Add returns u+v, wrapping on overflow.
+func (u Uint128) Add(v Uint128) Uint128 {
+	lo, carry := bits.Add64(u.Lo, v.Lo, 0)
+	hi, _ := bits.Add64(u.Hi, v.Hi, carry)
+	return Uint128{Hi: hi, Lo: lo}
+}
+
+// Sub returns u-v, wrapping on underflow.
+func (u Uint128) Sub(v Uint128) Uint128 {
+	lo, borrow := bits.Sub64(u.Lo, v.Lo, 0)
+	hi, _ := bits.Sub64(u.Hi, v.Hi, borrow)
+	return Uint128{Hi: hi, Lo: lo}
+}
+
+func (u Uint128) Big() *big.Int {
+	b := new(big.Int).SetUint64(u.Hi)
+	b.Lsh(b, 64)
+	return b.Or(b, new(big.Int).SetUint64(u.Lo))
+}
+
+func (u Uint128) String() string {
+	if u.Hi == 0 {
+		return fmt.Sprint(u.Lo)
+	}
+	return u.Big().String()
+}
+
+// Uint128FromBig converts b, reporting whether it fits in 128 bits.
+func Uint128FromBig(b *big.Int) (Uint128, bool) {
+	if b.Sign() < 0 || b.BitLen() > 128 {
+		return Uint128{}, false
+	}
+	lo := new(big.Int).And(b, new(big.Int).SetUint64(1<<64-1))
+	hi := new(big.Int).Rsh(b, 64)
+	return Uint128{Hi: hi.Uint64(), Lo: lo.Uint64()}, true
+}
+
+// ParseUint128 parses s in the given base, as strconv.ParseUint does.
+func ParseUint128(s string, base int) (Uint128, error) {
+	b, ok := new(big.Int).SetString(s, base)
+	if !ok {
+		return Uint128{}, fmt.Errorf("wire: invalid 128-bit integer %q", s)
+	}
+	u, ok := Uint128FromBig(b)
+	if !ok {
+		return Uint128{}, fmt.Errorf("wire: %q overflows 128 bits", s)
+	}
+	return u, nil
+}
+
+// Cmp returns -1, 0 or +1 depending on whether i is less than, equal to or
+// greater than j.
+func (i Int128) Cmp(j Int128) int {
+	switch {
+	case i.Hi < j.Hi, i.Hi == j.Hi && i.Lo < j.Lo:
+		return -1
+	case i == j:
+		return 0
+	default:
+		return 1
+	}
+}
+
+// Uint128 returns the bits of i reinterpreted as unsigned.
+func (i Int128) Uint128() Uint128 {
+	return Uint128{Hi: uint64(i.Hi), Lo: i.Lo}
+}
+
+// Int128 returns the bits of u reinterpreted as signed.
+func (u Uint128) Int128() Int128 {
+	return Int128{Hi: int64(u.Hi), Lo: u.Lo}
+}
+
+func (i Int128) Big() *big.Int {
+	b := i.Uint128().Big()
+	if i.Hi < 0 {
+		b.Sub(b, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+	return b
+}
+
+func (i Int128) String() string {
+	if i.Hi == 0 && i.Lo < 1<<63 {
+		return fmt.Sprint(i.Lo)
+	}
+	return i.Big().String()
+}
+
+type bigEndian struct{}
+type littleEndian struct{}
+
+// BigEndian and LittleEndian encode 128-bit integers in 16 bytes, in the
+// manner of encoding/binary.
+var (
+	BigEndian    bigEndian
+	LittleEndian littleEndian
+)
+
+func (bigEndian) Uint128(b []byte) Uint128 {
+	_ = b[15]
+	return Uint128{Hi: binary.BigEndian.Uint64(b[:8]), Lo: binary.BigEndian.Uint64(b[8:])}
+}
+
+func (bigEndian) PutUint128(b []byte, v Uint128) {
+	_ = b[15]
+	binary.BigEndian.PutUint64(b[:8], v.Hi)
+	binary.BigEndian.PutUint64(b[8:], v.Lo)
+}
+
+func (o bigEndian) Int128(b []byte) Int128 {
+	return o.Uint128(b).Int128()
+}
+
+func (o bigEndian) PutInt128(b []byte, v Int128) {
+	o.PutUint128(b, v.Uint128())
+}
+
+func (littleEndian) Uint128(b []byte) Uint128 {
+	_ = b[15]
+	return Uint128{Hi: binary.LittleEndian.Uint64(b[8:]), Lo: binary.LittleEndian.Uint64(b[:8])}
+}
+
+func (littleEndian) PutUint128(b []byte, v Uint128) {
+	_ = b[15]
+	binary.LittleEndian.PutUint64(b[:8], v.Lo)
+	binary.LittleEndian.PutUint64(b[8:], v.Hi)
+}
+
+func (o littleEndian) Int128(b []byte) Int128 {
+	return o.Uint128(b).Int128()
+}
+
+func (o littleEndian) PutInt128(b []byte, v Int128) {
+	o.PutUint128(b, v.Uint128())
+}
+
+// ReadUint128 reads a 128-bit integer, most significant byte first unless le
+// is set.
+func (b *BitReader) ReadUint128(le bool) (Uint128, error) {
+	var buf [16]byte
+	if _, err := b.Read(buf[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return Uint128{}, err
+	}
+	if le {
+		return LittleEndian.Uint128(buf[:]), nil
+	}
+	return BigEndian.Uint128(buf[:]), nil
+}
+
+// WriteUint128 writes a 128-bit integer, most significant byte first unless
+// le is set.
+func (b *BitWriter) WriteUint128(v Uint128, le bool) error {
+	var buf [16]byte
+	if le {
+		LittleEndian.PutUint128(buf[:], v)
+	} else {
+		BigEndian.PutUint128(buf[:], v)
+	}
+	_, err := b.Write(buf[:])
+	return err
+}
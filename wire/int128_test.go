@@ -0,0 +1,249 @@
+package wire
+
+import (
+	"bytes"
+	"io"
+	"math/big"
+	"testing"
+)
+
+var (
+	maxUint128 = Uint128{Hi: 1<<64 - 1, Lo: 1<<64 - 1}
+	maxInt128  = Int128{Hi: 1<<63 - 1, Lo: 1<<64 - 1}
+	minInt128  = Int128{Hi: -1 << 63}
+)
+
+func TestUint128Cmp(t *testing.T) {
+	for _, tt := range []struct {
+		u, v Uint128
+		want int
+	}{
+		{Uint128{}, Uint128{}, 0},
+		{Uint128{Lo: 1}, Uint128{Lo: 2}, -1},
+		{Uint128{Hi: 1}, Uint128{Lo: 1<<64 - 1}, 1},
+		{Uint128{Hi: 1, Lo: 2}, Uint128{Hi: 1, Lo: 1}, 1},
+		{maxUint128, maxUint128, 0},
+		{Uint128{}, maxUint128, -1},
+	} {
+		if got := tt.u.Cmp(tt.v); got != tt.want {
+			t.Errorf("%v.Cmp(%v) = %d, want %d", tt.u, tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestInt128Cmp(t *testing.T) {
+	minusOne := Int128{Hi: -1, Lo: 1<<64 - 1}
+	for _, tt := range []struct {
+		i, j Int128
+		want int
+	}{
+		{Int128{}, Int128{}, 0},
+		{minusOne, Int128{}, -1},
+		{Int128{Lo: 1 << 63}, minusOne, 1},
+		{minInt128, maxInt128, -1},
+		{maxInt128, minInt128, 1},
+		{minInt128, minusOne, -1},
+	} {
+		if got := tt.i.Cmp(tt.j); got != tt.want {
+			t.Errorf("%v.Cmp(%v) = %d, want %d", tt.i, tt.j, got, tt.want)
+		}
+	}
+}
+
+func TestUint128AddSub(t *testing.T) {
+	one := Uint128{Lo: 1}
+	for _, tt := range []struct {
+		name       string
+		u, v, want Uint128
+		sub        bool
+	}{
+		{"carry", Uint128{Lo: 1<<64 - 1}, one, Uint128{Hi: 1}, false},
+		{"wrap", maxUint128, one, Uint128{}, false},
+		{"borrow", Uint128{Hi: 1}, one, Uint128{Lo: 1<<64 - 1}, true},
+		{"underflow", Uint128{}, one, maxUint128, true},
+	} {
+		got := tt.u.Add(tt.v)
+		if tt.sub {
+			got = tt.u.Sub(tt.v)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %#v, want %#v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestInt128String(t *testing.T) {
+	for _, tt := range []struct {
+		i    Int128
+		want string
+	}{
+		{Int128{}, "0"},
+		{Int128{Lo: 42}, "42"},
+		{Int128{Lo: 1 << 63}, "9223372036854775808"},
+		{Int128{Hi: -1, Lo: 1<<64 - 1}, "-1"},
+		{Int128{Hi: -1, Lo: 1 << 63}, "-9223372036854775808"},
+		{maxInt128, "170141183460469231731687303715884105727"},
+		{minInt128, "-170141183460469231731687303715884105728"},
+	} {
+		if got := tt.i.String(); got != tt.want {
+			t.Errorf("%#v.String() = %s, want %s", tt.i, got, tt.want)
+		}
+		if got := tt.i.Big().String(); got != tt.want {
+			t.Errorf("%#v.Big() = %s, want %s", tt.i, got, tt.want)
+		}
+		if back := tt.i.Uint128().Int128(); back != tt.i {
+			t.Errorf("%#v round trips through Uint128 as %#v", tt.i, back)
+		}
+	}
+}
+
+func TestUint128FromBig(t *testing.T) {
+	two128 := new(big.Int).Lsh(big.NewInt(1), 128)
+	for _, tt := range []struct {
+		b    *big.Int
+		want Uint128
+		ok   bool
+	}{
+		{big.NewInt(0), Uint128{}, true},
+		{new(big.Int).Lsh(big.NewInt(1), 64), Uint128{Hi: 1}, true},
+		{new(big.Int).Sub(two128, big.NewInt(1)), maxUint128, true},
+		{two128, Uint128{}, false},
+		{big.NewInt(-1), Uint128{}, false},
+	} {
+		got, ok := Uint128FromBig(tt.b)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("Uint128FromBig(%s) = %v, %v, want %v, %v", tt.b, got, ok, tt.want, tt.ok)
+		}
+		if ok && got.Big().Cmp(tt.b) != 0 {
+			t.Errorf("Uint128FromBig(%s).Big() = %s", tt.b, got.Big())
+		}
+	}
+}
+
+func TestParseUint128(t *testing.T) {
+	for _, tt := range []struct {
+		s    string
+		base int
+		want Uint128
+		ok   bool
+	}{
+		{"340282366920938463463374607431768211455", 10, maxUint128, true},
+		{"ffffffffffffffffffffffffffffffff", 16, maxUint128, true},
+		{"0x10000000000000000", 0, Uint128{Hi: 1}, true},
+		{"340282366920938463463374607431768211456", 10, Uint128{}, false},
+		{"-1", 10, Uint128{}, false},
+		{"12x", 10, Uint128{}, false},
+	} {
+		got, err := ParseUint128(tt.s, tt.base)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseUint128(%q, %d) = %v, %v", tt.s, tt.base, got, err)
+		}
+	}
+	if got := maxUint128.String(); got != "340282366920938463463374607431768211455" {
+		t.Errorf("max Uint128 String() = %s", got)
+	}
+}
+
+func TestReadWriteUint128(t *testing.T) {
+	v := Uint128{Hi: 0x0102030405060708, Lo: 0x090A0B0C0D0E0F10}
+	be := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0A, 0x0B, 0x0C, 0x0D, 0x0E, 0x0F, 0x10}
+	le := make([]byte, 16)
+	for i := range be {
+		le[i] = be[15-i]
+	}
+	for _, tt := range []struct {
+		name string
+		le   bool
+		data []byte
+	}{
+		{"big endian", false, be},
+		{"little endian", true, le},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := NewBitWriter(&buf)
+			if err := w.WriteUint128(v, tt.le); err != nil {
+				t.Fatalf("WriteUint128 error = %v", err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.data) {
+				t.Errorf("WriteUint128 wrote % x, want % x", buf.Bytes(), tt.data)
+			}
+			r := NewBitReader(bytes.NewReader(tt.data))
+			got, err := r.ReadUint128(tt.le)
+			if err != nil {
+				t.Fatalf("ReadUint128 error = %v", err)
+			}
+			if got != v {
+				t.Errorf("ReadUint128 = %#v, want %#v", got, v)
+			}
+			if r.Offset() != 128 {
+				t.Errorf("Offset() = %d, want 128", r.Offset())
+			}
+
+			r = NewBitReader(bytes.NewReader(tt.data[:15]))
+			if _, err := r.ReadUint128(tt.le); err != io.ErrUnexpectedEOF {
+				t.Errorf("ReadUint128 of 15 bytes error = %v, want io.ErrUnexpectedEOF", err)
+			}
+		})
+	}
+}
+
+// TestInt128SignExtension reads negative i128 values, whose sign is in the
+// top bit of the high half.
+func TestInt128SignExtension(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		le   bool
+		data []byte
+		want string
+	}{
+		{"minus one", false, bytes.Repeat([]byte{0xFF}, 16), "-1"},
+		{"minus two le", true, append([]byte{0xFE}, bytes.Repeat([]byte{0xFF}, 15)...), "-2"},
+		{"min", false, append([]byte{0x80}, make([]byte, 15)...), minInt128.String()},
+		{"max le", true, append(bytes.Repeat([]byte{0xFF}, 15), 0x7F), maxInt128.String()},
+		{"low half sign bit", false, append(make([]byte, 8), 0x80, 0, 0, 0, 0, 0, 0, 0), "9223372036854775808"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := NewBitReader(bytes.NewReader(tt.data))
+			u, err := r.ReadUint128(tt.le)
+			if err != nil {
+				t.Fatalf("ReadUint128 error = %v", err)
+			}
+			if got := u.Int128().String(); got != tt.want {
+				t.Errorf("Int128 = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestInt128Literals builds values the way generated u128 and i128 enums do,
+// from the high and low halves of a number literal.
+func TestInt128Literals(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		hi, lo uint64
+		signed bool
+		want   string
+	}{
+		{"u128 above 64 bits", 0x1, 0x0, false, "18446744073709551616"},
+		{"u128 max", 1<<64 - 1, 1<<64 - 1, false, "340282366920938463463374607431768211455"},
+		{"i128 max", 1<<63 - 1, 1<<64 - 1, true, "170141183460469231731687303715884105727"},
+		{"i128 negative", 1<<64 - 1, 1<<64 - 5, true, "-5"},
+		{"i128 min", 1 << 63, 0, true, "-170141183460469231731687303715884105728"},
+	} {
+		var got string
+		if tt.signed {
+			got = Int128{Hi: int64(tt.hi), Lo: tt.lo}.String()
+		} else {
+			got = Uint128{Hi: tt.hi, Lo: tt.lo}.String()
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	err := &UnknownEnumError{Enum: "Wide", Value: 2, High: 1}
+	if got, want := err.Error(), "unknown Wide value 18446744073709551618"; got != want {
+		t.Errorf("UnknownEnumError = %q, want %q", got, want)
+	}
+}
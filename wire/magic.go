@@ -0,0 +1,31 @@
+package wire
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// MagicMismatchError is returned when a fixed-value field does not hold its
+// declared value. Offset is in bytes from the start of the packet.
+type MagicMismatchError struct {
+	Offset   int64
+	Expected []byte
+	Got      []byte
+}
+
+func (e *MagicMismatchError) Error() string {
+	return fmt.Sprintf("magic mismatch at offset %d: expected 0x%X, got 0x%X", e.Offset, e.Expected, e.Got)
+}
+
+// CheckMagic compares the bytes read for a fixed-value field at offset with
+// the expected encoding.
+func CheckMagic(offset int64, expected, got []byte) error {
+	if !bytes.Equal(expected, got) {
+		return &MagicMismatchError{
+			Offset:   offset,
+			Expected: append([]byte(nil), expected...),
+			Got:      append([]byte(nil), got...),
+		}
+	}
+	return nil
+}
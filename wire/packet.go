@@ -0,0 +1,65 @@
+package wire
+
+import "bytes"
+
+// Decoder is implemented by generated packets.
+type Decoder interface {
+	Decode(r *BitReader) error
+}
+
+// Encoder is implemented by generated packets.
+type Encoder interface {
+	Encode(w *BitWriter) error
+}
+
+// Marshal encodes p. A trailing partial byte is padded with zero bits.
+func Marshal(p Encoder) ([]byte, error) {
+	return MarshalFunc(p.Encode)
+}
+
+// MarshalFunc returns the bytes written by encode, as Marshal does for a
+// packet. Messages use it to encode the value of each entry.
+func MarshalFunc(encode func(w *BitWriter) error) ([]byte, error) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+	if err := encode(w); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Unmarshal decodes p from data, which must hold exactly one packet. Bits
+// after the packet in its last byte are ignored.
+func Unmarshal(data []byte, p Decoder) error {
+	return UnmarshalFunc(data, p.Decode)
+}
+
+// UnmarshalFunc decodes data with decode, which must consume all of it, as
+// Unmarshal does for a packet. Data after the packet may be read by its @at
+// fields instead. Messages use it to decode the value of each
+// entry.
+func UnmarshalFunc(data []byte, decode func(r *BitReader) error) error {
+	br := bytes.NewReader(data)
+	r := NewBitReader(br)
+	r.Seeker = NewSeeker(br, int64(len(data)))
+	if err := decode(r); err != nil {
+		return err
+	}
+	end := r.Offset()
+	if err := r.Align(8); err != nil {
+		return err
+	}
+	atEnd, err := r.AtEnd()
+	if err != nil {
+		return err
+	}
+	// Data read by @at fields, such as tables after a header, is not
+	// trailing.
+	if !atEnd && r.Seeker.end() < int64(len(data)) {
+		return &TrailingDataError{Offset: end}
+	}
+	return nil
+}
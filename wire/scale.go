@@ -0,0 +1,68 @@
+package wire
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Scale converts between the raw integer of a field annotated with @scale,
+// @offset and @unit and its physical value, raw*Factor + Offset.
+type Scale struct {
+	Factor float64
+	Offset float64
+	Unit   string
+}
+
+// OutOfRangeError is returned when a physical value has no raw encoding in
+// the field's integer type.
+type OutOfRangeError struct {
+	Value    float64
+	Min, Max float64
+	Unit     string
+}
+
+func (e *OutOfRangeError) Error() string {
+	unit := ""
+	if e.Unit != "" {
+		unit = " " + e.Unit
+	}
+	return fmt.Sprintf("%g%s is outside the range %g%s to %g%s", e.Value, unit, e.Min, unit, e.Max, unit)
+}
+
+// Physical returns the physical value of a raw field value.
+func (s Scale) Physical(raw float64) float64 {
+	return raw*s.Factor + s.Offset
+}
+
+// Format returns the physical value of raw with its unit, as in "25.5 degC".
+func (s Scale) Format(raw float64) string {
+	v := strconv.FormatFloat(s.Physical(raw), 'f', -1, 64)
+	if s.Unit == "" {
+		return v
+	}
+	return v + " " + s.Unit
+}
+
+// Raw converts a physical value to the nearest raw value of a bits wide
+// integer, returned as its two's complement bits for signed types.
+func (s Scale) Raw(physical float64, bits int, signed bool) (uint64, error) {
+	// limit is exclusive so that 64-bit bounds stay exact in a float64.
+	min, limit := 0.0, math.Ldexp(1, bits)
+	if signed {
+		min, limit = -math.Ldexp(1, bits-1), math.Ldexp(1, bits-1)
+	}
+	max := limit - 1
+	raw := math.Round((physical - s.Offset) / s.Factor)
+	if math.IsNaN(raw) || raw < min || raw >= limit {
+		lo, hi := s.Physical(min), s.Physical(max)
+		if lo > hi {
+			lo, hi = hi, lo
+		}
+		return 0, &OutOfRangeError{Value: physical, Min: lo, Max: hi, Unit: s.Unit}
+	}
+	if signed {
+		return uint64(int64(raw)), nil
+	}
+	return uint64(raw), nil
+}
@@ -0,0 +1,110 @@
+package wire
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+// temperature is the scale of `@scale(0.1) @offset(-40) @unit("degC")`.
+var temperature = Scale{Factor: 0.1, Offset: -40, Unit: "degC"}
+
+func TestScalePhysical(t *testing.T) {
+	for _, tt := range []struct {
+		s    Scale
+		raw  float64
+		want float64
+		str  string
+	}{
+		{temperature, 0, -40, "-40 degC"},
+		{temperature, 400, 0, "0 degC"},
+		{temperature, 655, 25.5, "25.5 degC"},
+		{temperature, -100, -50, "-50 degC"},
+		{Scale{Factor: 0.5}, 3, 1.5, "1.5"},
+		{Scale{Factor: -2, Offset: 10, Unit: "m"}, 3, 4, "4 m"},
+	} {
+		if got := tt.s.Physical(tt.raw); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("%+v.Physical(%g) = %g, want %g", tt.s, tt.raw, got, tt.want)
+		}
+		if got := tt.s.Format(tt.raw); got != tt.str {
+			t.Errorf("%+v.Format(%g) = %q, want %q", tt.s, tt.raw, got, tt.str)
+		}
+	}
+}
+
+func TestScaleRaw(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		s        Scale
+		physical float64
+		bits     int
+		signed   bool
+		want     uint64
+	}{
+		{"offset", temperature, -40, 16, true, 0},
+		{"inexact factor", temperature, 25.5, 16, true, 655},
+		{"negative raw", temperature, -50, 16, true, uint64(1<<64 - 100)},
+		{"rounds down", temperature, 25.54, 16, true, 655},
+		{"rounds up", temperature, 25.56, 16, true, 656},
+		{"half away from zero", Scale{Factor: 0.5}, 0.25, 8, false, 1},
+		{"negative half away from zero", Scale{Factor: 0.5}, -0.25, 8, true, uint64(1<<64 - 1)},
+		{"negative factor", Scale{Factor: -2, Offset: 10}, 4, 8, false, 3},
+		{"unsigned max", Scale{Factor: 1, Offset: -40}, 215, 8, false, 255},
+		{"signed min", Scale{Factor: 1}, -128, 8, true, uint64(1<<64 - 128)},
+		{"64-bit max", Scale{Factor: 1}, math.Ldexp(1, 63) - 1024, 64, true, 1<<63 - 1024},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.s.Raw(tt.physical, tt.bits, tt.signed)
+			if err != nil {
+				t.Fatalf("Raw error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Raw = %#x, want %#x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestScaleRawOutOfRange(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		s        Scale
+		physical float64
+		bits     int
+		signed   bool
+		min, max float64
+	}{
+		{"below offset", Scale{Factor: 1, Offset: -40, Unit: "degC"}, -41, 8, false, -40, 215},
+		{"above max", Scale{Factor: 1, Offset: -40, Unit: "degC"}, 216, 8, false, -40, 215},
+		{"rounds past max", Scale{Factor: 1}, 127.5, 8, true, -128, 127},
+		{"signed below min", Scale{Factor: 0.5}, -64.5, 8, true, -64, 63.5},
+		{"negative factor", Scale{Factor: -2, Offset: 10}, 12, 8, false, -500, 10},
+		{"NaN", Scale{Factor: 1}, math.NaN(), 8, false, 0, 255},
+		{"64-bit limit", Scale{Factor: 1}, math.Ldexp(1, 63), 64, true, math.Ldexp(-1, 63), math.Ldexp(1, 63)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.s.Raw(tt.physical, tt.bits, tt.signed)
+			var out *OutOfRangeError
+			if !errors.As(err, &out) {
+				t.Fatalf("Raw error = %v, want *OutOfRangeError", err)
+			}
+			if out.Min != tt.min || out.Max != tt.max || out.Unit != tt.s.Unit {
+				t.Errorf("Raw error = %v, want range %g to %g", err, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+// TestScaleRoundTrip converts every raw value of an i16 temperature to its
+// physical value and back.
+func TestScaleRoundTrip(t *testing.T) {
+	for raw := math.MinInt16; raw <= math.MaxInt16; raw++ {
+		got, err := temperature.Raw(temperature.Physical(float64(raw)), 16, true)
+		if err != nil {
+			t.Fatalf("Raw(Physical(%d)) error = %v", raw, err)
+		}
+		if int16(got) != int16(raw) {
+			t.Fatalf("Raw(Physical(%d)) = %d", raw, int16(got))
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// SizeMismatchError is returned when the fields of a sized block do not take
+// exactly the number of bytes the block declares.
+type SizeMismatchError struct {
+	Size int64 // declared size in bytes
+	Used int64 // bits consumed by the fields, or -1 if they ran past the end
+}
+
+func (e *SizeMismatchError) Error() string {
+	if e.Used < 0 {
+		return fmt.Sprintf("fields overrun a sized block of %d bytes", e.Size)
+	}
+	return fmt.Sprintf("fields of a sized block of %d bytes used %d bits", e.Size, e.Used)
+}
+
+// SizedReader decodes a `sized(len) { ... }` block. It is a BitReader over
+// the next len bytes of its parent, so its offset starts at zero and an eos
+// array inside the block ends with the block.
+type SizedReader struct {
+	*BitReader
+	limit *io.LimitedReader
+	size  int64
+}
+
+func NewSizedReader(parent *BitReader, size int64) *SizedReader {
+	limit := &io.LimitedReader{R: parent, N: size}
+	r := NewBitReader(limit)
+	r.Strict, r.Seeker, r.base = parent.Strict, parent.Seeker, parent.DataOffset()
+	return &SizedReader{BitReader: r, limit: limit, size: size}
+}
+
+// Err converts an unexpected EOF caused by reading past the end of the block
+// into a *SizeMismatchError. Other errors are returned unchanged.
+func (s *SizedReader) Err(err error) error {
+	if err == io.ErrUnexpectedEOF && s.limit.N == 0 {
+		return &SizeMismatchError{Size: s.size, Used: -1}
+	}
+	return err
+}
+
+// Close ends the block. Unread bytes are discarded if skip is set and are a
+// *SizeMismatchError otherwise.
+func (s *SizedReader) Close(skip bool) error {
+	used := s.Offset()
+	if used == s.size*8 {
+		return nil
+	}
+	if !skip {
+		return &SizeMismatchError{Size: s.size, Used: used}
+	}
+	_, err := io.Copy(io.Discard, s.limit)
+	return err
+}
+
+// SizedWriter encodes a `sized(len) { ... }` block into a buffer, so that
+// its length is known and can be written before the block itself.
+type SizedWriter struct {
+	*BitWriter
+	buf bytes.Buffer
+}
+
+func NewSizedWriter() *SizedWriter {
+	s := new(SizedWriter)
+	s.BitWriter = NewBitWriter(&s.buf)
+	return s
+}
+
+// Len flushes the block and returns its size in bytes.
+func (s *SizedWriter) Len() (int64, error) {
+	if err := s.Flush(); err != nil {
+		return 0, err
+	}
+	return int64(s.buf.Len()), nil
+}
+
+// WriteTo flushes the block and writes it to the parent writer.
+func (s *SizedWriter) WriteTo(parent *BitWriter) (int64, error) {
+	if err := s.Flush(); err != nil {
+		return 0, err
+	}
+	n, err := parent.Write(s.buf.Bytes())
+	return int64(n), err
+}
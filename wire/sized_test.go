@@ -0,0 +1,180 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// TestSizedReader decodes a block of size bytes holding fields of the given
+// widths, followed by one byte that belongs to the parent.
+func TestSizedReader(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		data   []byte
+		size   int64
+		fields []uint
+		skip   bool
+		want   []uint64
+		err    error // from the fields, after Err
+		close  error // from Close
+	}{
+		{"exact", []byte{1, 2, 3, 0xEE}, 3, []uint{8, 16}, false, []uint64{1, 0x0203}, nil, nil},
+		{"bit fields", []byte{0xA5, 0xEE}, 1, []uint{4, 4}, false, []uint64{0xA, 0x5}, nil, nil},
+		{"empty", []byte{0xEE}, 0, nil, false, nil, nil, nil},
+		{"short fields", []byte{1, 2, 3, 0xEE}, 3, []uint{8}, false, []uint64{1}, nil, &SizeMismatchError{Size: 3, Used: 8}},
+		{"short bits", []byte{0xA5, 0xEE}, 1, []uint{4}, false, []uint64{0xA}, nil, &SizeMismatchError{Size: 1, Used: 4}},
+		{"trailing skipped", []byte{1, 2, 3, 0xEE}, 3, []uint{8}, true, []uint64{1}, nil, nil},
+		{"trailing bits skipped", []byte{0xA5, 2, 0xEE}, 2, []uint{4}, true, []uint64{0xA}, nil, nil},
+		{"overrun", []byte{1, 2, 3, 0xEE}, 2, []uint{8, 16}, false, []uint64{1}, &SizeMismatchError{Size: 2, Used: -1}, nil},
+		{"overrun with skip", []byte{1, 2, 3, 0xEE}, 2, []uint{8, 16}, true, []uint64{1}, &SizeMismatchError{Size: 2, Used: -1}, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := NewBitReader(bytes.NewReader(tt.data))
+			s := NewSizedReader(parent, tt.size)
+			var got []uint64
+			var err error
+			for _, n := range tt.fields {
+				var v uint64
+				if v, err = s.ReadBits(n); err != nil {
+					err = s.Err(err)
+					break
+				}
+				got = append(got, v)
+			}
+			if !sameError(err, tt.err) {
+				t.Fatalf("fields error = %v, want %v", err, tt.err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("fields = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("field %d = %#x, want %#x", i, got[i], tt.want[i])
+				}
+			}
+			if err != nil {
+				return
+			}
+			if err := s.Close(tt.skip); !sameError(err, tt.close) {
+				t.Fatalf("Close error = %v, want %v", err, tt.close)
+			}
+			if tt.close != nil {
+				return
+			}
+			// The parent continues right after the block.
+			if v, err := parent.ReadBits(8); err != nil || v != 0xEE {
+				t.Errorf("parent read %#x, %v after the block, want 0xee", v, err)
+			}
+			if parent.Offset() != tt.size*8+8 {
+				t.Errorf("parent Offset() = %d, want %d", parent.Offset(), tt.size*8+8)
+			}
+		})
+	}
+}
+
+func sameError(err, want error) bool {
+	if want, ok := want.(*SizeMismatchError); ok {
+		var got *SizeMismatchError
+		return errors.As(err, &got) && *got == *want
+	}
+	return err == want
+}
+
+func TestSizedReaderShortParent(t *testing.T) {
+	// Data that ends before the block does is an unexpected EOF, not a size
+	// mismatch: the fields are not at fault.
+	s := NewSizedReader(NewBitReader(bytes.NewReader([]byte{1})), 4)
+	_, err := s.ReadBits(16)
+	if err = s.Err(err); err != io.ErrUnexpectedEOF {
+		t.Errorf("Err = %v, want io.ErrUnexpectedEOF", err)
+	}
+
+	s = NewSizedReader(NewBitReader(bytes.NewReader([]byte{1})), 4)
+	if _, err := s.ReadBits(8); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(true); err != nil {
+		t.Errorf("Close(true) = %v, want nil", err)
+	}
+}
+
+func TestSizedReaderToEnd(t *testing.T) {
+	// An eos array in a block ends with the block.
+	parent := NewBitReader(bytes.NewReader([]byte{1, 2, 3, 4}))
+	s := NewSizedReader(parent, 3)
+	got, err := ReadToEnd(s.BitReader, readU8(s.BitReader))
+	if err != nil || !bytes.Equal(got, []byte{1, 2, 3}) {
+		t.Fatalf("ReadToEnd = %v, %v, want [1 2 3]", got, err)
+	}
+	if err := s.Close(false); err != nil {
+		t.Errorf("Close error = %v", err)
+	}
+}
+
+func TestSizedReaderStrict(t *testing.T) {
+	parent := NewBitReader(bytes.NewReader([]byte{2}))
+	parent.Strict = true
+	s := NewSizedReader(parent, 1)
+	var invalid *InvalidBoolError
+	if _, err := s.ReadBool(8); !errors.As(err, &invalid) {
+		t.Errorf("ReadBool error = %v, want *InvalidBoolError", err)
+	}
+}
+
+func TestSizedWriter(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		prefix uint // bits written to the parent before the block
+		fields []uint64
+		widths []uint
+		size   int64
+		want   []byte
+	}{
+		{"bytes", 0, []uint64{1, 0x0203}, []uint{8, 16}, 3, []byte{1, 2, 3}},
+		{"empty", 0, nil, nil, 0, nil},
+		{"partial byte", 0, []uint64{0xA}, []uint{4}, 1, []byte{0xA0}},
+		{"offsets start at zero", 4, []uint64{0xAB}, []uint{8}, 1, []byte{0xFA, 0xB0}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSizedWriter()
+			for i, v := range tt.fields {
+				if err := s.WriteBits(v, tt.widths[i]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if s.Offset() != int64(sum(tt.widths)) {
+				t.Errorf("block Offset() = %d, want %d", s.Offset(), sum(tt.widths))
+			}
+			size, err := s.Len()
+			if err != nil || size != tt.size {
+				t.Fatalf("Len = %d, %v, want %d", size, err, tt.size)
+			}
+
+			var buf bytes.Buffer
+			parent := NewBitWriter(&buf)
+			if err := parent.WriteBits(1<<tt.prefix-1, tt.prefix); err != nil {
+				t.Fatal(err)
+			}
+			n, err := s.WriteTo(parent)
+			if err != nil || n != tt.size {
+				t.Fatalf("WriteTo = %d, %v, want %d", n, err, tt.size)
+			}
+			if err := parent.Flush(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), tt.want) {
+				t.Errorf("wrote % x, want % x", buf.Bytes(), tt.want)
+			}
+		})
+	}
+}
+
+func sum(widths []uint) uint {
+	var n uint
+	for _, w := range widths {
+		n += w
+	}
+	return n
+}
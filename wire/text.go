@@ -0,0 +1,211 @@
+package wire
+
+import (
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding is the wire encoding of a string field.
+type Encoding uint8
+
+const (
+	UTF8 Encoding = iota
+	UTF16LE
+	UTF16BE
+	Latin1
+	ASCII
+)
+
+var encodingNames = [...]string{
+	UTF8:    "utf8",
+	UTF16LE: "utf16le",
+	UTF16BE: "utf16be",
+	Latin1:  "latin1",
+	ASCII:   "ascii",
+}
+
+func (e Encoding) String() string {
+	if int(e) < len(encodingNames) {
+		return encodingNames[e]
+	}
+	return fmt.Sprintf("Encoding(%d)", e)
+}
+
+// ParseEncoding returns the encoding with the given schema name.
+func ParseEncoding(name string) (Encoding, bool) {
+	for i, n := range encodingNames {
+		if n == name {
+			return Encoding(i), true
+		}
+	}
+	return 0, false
+}
+
+// Encodings returns the schema names of all encodings.
+func Encodings() []string {
+	return append([]string(nil), encodingNames[:]...)
+}
+
+// UnitSize returns the size in bytes of one code unit.
+func (e Encoding) UnitSize() int {
+	if e == UTF16LE || e == UTF16BE {
+		return 2
+	}
+	return 1
+}
+
+// InvalidTextError is returned for text that cannot be represented in an
+// encoding. Index is the byte index of the first bad sequence in the encoded
+// data when decoding, or in the Go string when encoding.
+type InvalidTextError struct {
+	Encoding Encoding
+	Index    int
+}
+
+func (e *InvalidTextError) Error() string {
+	return fmt.Sprintf("invalid %s text at byte %d", e.Encoding, e.Index)
+}
+
+// DecodeText converts encoded bytes to a Go string. Invalid sequences are an
+// error unless replace is set, in which case they become U+FFFD.
+func DecodeText(b []byte, e Encoding, replace bool) (string, error) {
+	switch e {
+	case UTF8:
+		if utf8.Valid(b) {
+			return string(b), nil
+		}
+		out := make([]rune, 0, len(b))
+		for i := 0; i < len(b); {
+			r, size := utf8.DecodeRune(b[i:])
+			if r == utf8.RuneError && size <= 1 && !replace {
+				return "", &InvalidTextError{Encoding: e, Index: i}
+			}
+			out = append(out, r)
+			i += size
+		}
+		return string(out), nil
+	case UTF16LE, UTF16BE:
+		out := make([]rune, 0, len(b)/2)
+		for i := 0; i < len(b); i += 2 {
+			if i+1 >= len(b) {
+				if !replace {
+					return "", &InvalidTextError{Encoding: e, Index: i}
+				}
+				out = append(out, utf8.RuneError)
+				break
+			}
+			u := e.unit(b[i:])
+			switch {
+			case !utf16.IsSurrogate(rune(u)):
+				out = append(out, rune(u))
+				continue
+			case u < 0xDC00 && i+3 < len(b):
+				if r := utf16.DecodeRune(rune(u), rune(e.unit(b[i+2:]))); r != utf8.RuneError {
+					out = append(out, r)
+					i += 2
+					continue
+				}
+			}
+			if !replace {
+				return "", &InvalidTextError{Encoding: e, Index: i}
+			}
+			out = append(out, utf8.RuneError)
+		}
+		return string(out), nil
+	case Latin1:
+		out := make([]rune, len(b))
+		for i, c := range b {
+			out[i] = rune(c)
+		}
+		return string(out), nil
+	case ASCII:
+		out := make([]rune, len(b))
+		for i, c := range b {
+			if c >= utf8.RuneSelf {
+				if !replace {
+					return "", &InvalidTextError{Encoding: e, Index: i}
+				}
+				out[i] = utf8.RuneError
+				continue
+			}
+			out[i] = rune(c)
+		}
+		return string(out), nil
+	}
+	return "", fmt.Errorf("wire: unknown encoding %s", e)
+}
+
+// EncodeText converts a Go string to encoded bytes. Characters the encoding
+// cannot represent are an error unless replace is set, in which case they
+// become '?' in Latin-1 and ASCII and U+FFFD otherwise.
+func EncodeText(s string, e Encoding, replace bool) ([]byte, error) {
+	switch e {
+	case UTF8:
+		if utf8.ValidString(s) {
+			return []byte(s), nil
+		}
+	case UTF16LE, UTF16BE:
+		out := make([]byte, 0, len(s)*2)
+		for i, r := range s {
+			if r == utf8.RuneError && !isRuneErrorLiteral(s[i:]) && !replace {
+				return nil, &InvalidTextError{Encoding: e, Index: i}
+			}
+			if r1, r2 := utf16.EncodeRune(r); r1 != utf8.RuneError {
+				out = e.appendUnit(e.appendUnit(out, uint16(r1)), uint16(r2))
+			} else {
+				out = e.appendUnit(out, uint16(r))
+			}
+		}
+		return out, nil
+	case Latin1, ASCII:
+		max := rune(0xFF)
+		if e == ASCII {
+			max = utf8.RuneSelf - 1
+		}
+		out := make([]byte, 0, len(s))
+		for i, r := range s {
+			if r > max || (r == utf8.RuneError && !isRuneErrorLiteral(s[i:])) {
+				if !replace {
+					return nil, &InvalidTextError{Encoding: e, Index: i}
+				}
+				r = '?'
+			}
+			out = append(out, byte(r))
+		}
+		return out, nil
+	default:
+		return nil, fmt.Errorf("wire: unknown encoding %s", e)
+	}
+
+	// Invalid UTF-8 in the Go string.
+	out := make([]byte, 0, len(s))
+	for i, r := range s {
+		if r == utf8.RuneError && !isRuneErrorLiteral(s[i:]) && !replace {
+			return nil, &InvalidTextError{Encoding: e, Index: i}
+		}
+		out = utf8.AppendRune(out, r)
+	}
+	return out, nil
+}
+
+// isRuneErrorLiteral reports whether s starts with an encoded U+FFFD rather
+// than an invalid byte.
+func isRuneErrorLiteral(s string) bool {
+	_, size := utf8.DecodeRuneInString(s)
+	return size > 1
+}
+
+func (e Encoding) unit(b []byte) uint16 {
+	if e == UTF16BE {
+		return uint16(b[0])<<8 | uint16(b[1])
+	}
+	return uint16(b[1])<<8 | uint16(b[0])
+}
+
+func (e Encoding) appendUnit(b []byte, u uint16) []byte {
+	if e == UTF16BE {
+		return append(b, byte(u>>8), byte(u))
+	}
+	return append(b, byte(u), byte(u>>8))
+}
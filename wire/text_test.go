@@ -0,0 +1,193 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestTextRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		enc  Encoding
+		s    string
+		b    []byte
+	}{
+		{"utf8", UTF8, "héllo", []byte{0x68, 0xC3, 0xA9, 0x6C, 0x6C, 0x6F}},
+		{"utf16le", UTF16LE, "hé😀", []byte{0x68, 0x00, 0xE9, 0x00, 0x3D, 0xD8, 0x00, 0xDE}},
+		{"utf16be", UTF16BE, "hé😀", []byte{0x00, 0x68, 0x00, 0xE9, 0xD8, 0x3D, 0xDE, 0x00}},
+		{"utf16 replacement character", UTF16LE, "�", []byte{0xFD, 0xFF}},
+		{"latin1", Latin1, "café ÿ", []byte{0x63, 0x61, 0x66, 0xE9, 0x20, 0xFF}},
+		{"ascii", ASCII, "abc~", []byte{0x61, 0x62, 0x63, 0x7E}},
+		{"empty", UTF16BE, "", []byte{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := EncodeText(tt.s, tt.enc, false)
+			if err != nil {
+				t.Fatalf("EncodeText error = %v", err)
+			}
+			if !bytes.Equal(b, tt.b) {
+				t.Errorf("EncodeText = % x, want % x", b, tt.b)
+			}
+			s, err := DecodeText(tt.b, tt.enc, false)
+			if err != nil {
+				t.Fatalf("DecodeText error = %v", err)
+			}
+			if s != tt.s {
+				t.Errorf("DecodeText = %q, want %q", s, tt.s)
+			}
+		})
+	}
+}
+
+func TestDecodeTextInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		enc      Encoding
+		b        []byte
+		index    int
+		replaced string
+	}{
+		{"utf8 bad byte", UTF8, []byte{0x61, 0xFF, 0x62}, 1, "a�b"},
+		{"utf8 truncated sequence", UTF8, []byte{0x61, 0xC3}, 1, "a�"},
+		{"utf16le lone high surrogate", UTF16LE, []byte{0x61, 0x00, 0x3D, 0xD8}, 2, "a�"},
+		{"utf16be lone low surrogate", UTF16BE, []byte{0xDC, 0x00, 0x00, 0x61}, 0, "�a"},
+		{"utf16be unpaired high surrogate", UTF16BE, []byte{0xD8, 0x3D, 0x00, 0x61}, 0, "�a"},
+		{"utf16le odd length", UTF16LE, []byte{0x61, 0x00, 0x62}, 2, "a�"},
+		{"utf16be single byte", UTF16BE, []byte{0x61}, 0, "�"},
+		{"ascii high bit", ASCII, []byte{0x61, 0x80}, 1, "a�"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := DecodeText(tt.b, tt.enc, false)
+			var invalid *InvalidTextError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("DecodeText error = %v, want *InvalidTextError", err)
+			}
+			if invalid.Encoding != tt.enc || invalid.Index != tt.index {
+				t.Errorf("DecodeText error = %v, want %s text at byte %d", err, tt.enc, tt.index)
+			}
+
+			s, err := DecodeText(tt.b, tt.enc, true)
+			if err != nil {
+				t.Fatalf("DecodeText with replace error = %v", err)
+			}
+			if s != tt.replaced {
+				t.Errorf("DecodeText with replace = %q, want %q", s, tt.replaced)
+			}
+		})
+	}
+}
+
+func TestEncodeTextInvalid(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		enc      Encoding
+		s        string
+		index    int
+		replaced []byte
+	}{
+		{"utf8 bad byte", UTF8, "a\xffb", 1, []byte{0x61, 0xEF, 0xBF, 0xBD, 0x62}},
+		{"utf16le bad byte", UTF16LE, "a\xff", 1, []byte{0x61, 0x00, 0xFD, 0xFF}},
+		{"latin1 outside range", Latin1, "a€", 1, []byte{0x61, 0x3F}},
+		{"latin1 bad byte", Latin1, "\xe9", 0, []byte{0x3F}},
+		{"ascii outside range", ASCII, "né", 1, []byte{0x6E, 0x3F}},
+		{"ascii replacement character", ASCII, "�", 0, []byte{0x3F}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := EncodeText(tt.s, tt.enc, false)
+			var invalid *InvalidTextError
+			if !errors.As(err, &invalid) {
+				t.Fatalf("EncodeText error = %v, want *InvalidTextError", err)
+			}
+			if invalid.Encoding != tt.enc || invalid.Index != tt.index {
+				t.Errorf("EncodeText error = %v, want %s text at byte %d", err, tt.enc, tt.index)
+			}
+
+			b, err := EncodeText(tt.s, tt.enc, true)
+			if err != nil {
+				t.Fatalf("EncodeText with replace error = %v", err)
+			}
+			if !bytes.Equal(b, tt.replaced) {
+				t.Errorf("EncodeText with replace = % x, want % x", b, tt.replaced)
+			}
+		})
+	}
+}
+
+// TestTextUnits reads and writes strings whose length counts code units, as
+// String(len) does under @text(length = units), and terminated strings, whose
+// terminator is one code unit.
+func TestTextUnits(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		enc   Encoding
+		s     string
+		units uint64
+		data  []byte
+	}{
+		{"utf16le", UTF16LE, "AB", 2, []byte{0x41, 0x00, 0x42, 0x00}},
+		{"utf16be surrogate pair", UTF16BE, "😀", 2, []byte{0xD8, 0x3D, 0xDE, 0x00}},
+		{"latin1", Latin1, "é", 1, []byte{0xE9}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := uint64(len(tt.data) / tt.enc.UnitSize()); got != tt.units {
+				t.Fatalf("%d bytes are %d units, want %d", len(tt.data), got, tt.units)
+			}
+			r := NewBitReader(bytes.NewReader(tt.data))
+			b, err := ReadBytes(r, tt.units*uint64(tt.enc.UnitSize()))
+			if err != nil {
+				t.Fatalf("ReadBytes error = %v", err)
+			}
+			if s, err := DecodeText(b, tt.enc, false); err != nil || s != tt.s {
+				t.Errorf("DecodeText = %q, %v, want %q", s, err, tt.s)
+			}
+
+			var buf bytes.Buffer
+			w := NewBitWriter(&buf)
+			b, err = EncodeText(tt.s, tt.enc, false)
+			if err != nil {
+				t.Fatalf("EncodeText error = %v", err)
+			}
+			if err := WriteTerminated(w, b, tt.enc.UnitSize()); err != nil {
+				t.Fatalf("WriteTerminated error = %v", err)
+			}
+			want := append(append([]byte(nil), tt.data...), make([]byte, tt.enc.UnitSize())...)
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("WriteTerminated wrote % x, want % x", buf.Bytes(), want)
+			}
+			r = NewBitReader(bytes.NewReader(buf.Bytes()))
+			got, err := ReadTerminated(r, tt.enc.UnitSize())
+			if err != nil {
+				t.Fatalf("ReadTerminated error = %v", err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("ReadTerminated = % x, want % x", got, tt.data)
+			}
+		})
+	}
+}
+
+func TestWriteTerminatedUnit(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+	// A zero unit inside the string would end it early; zero bytes that are
+	// half of a UTF-16 unit do not.
+	if err := WriteTerminated(w, []byte{0x41, 0x00, 0x00, 0x00}, 2); err != ErrTerminator {
+		t.Errorf("WriteTerminated error = %v, want ErrTerminator", err)
+	}
+	if err := WriteTerminated(w, []byte{0x00, 0x41}, 2); err != nil {
+		t.Errorf("WriteTerminated error = %v", err)
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	for _, name := range Encodings() {
+		e, ok := ParseEncoding(name)
+		if !ok || e.String() != name {
+			t.Errorf("ParseEncoding(%q) = %v, %v", name, e, ok)
+		}
+	}
+	if _, ok := ParseEncoding("utf32"); ok {
+		t.Errorf("ParseEncoding(%q) succeeded", "utf32")
+	}
+}
@@ -0,0 +1,74 @@
+package wire
+
+import "fmt"
+
+// TLV is one tag-length-value entry of a message. Decoders keep entries with
+// unknown tags as TLVs so that they can be written back unchanged.
+type TLV struct {
+	Tag   uint64
+	Value []byte
+}
+
+// ValueTooLongError is returned when a TLV value does not fit in the length
+// field of its message.
+type ValueTooLongError struct {
+	Tag    uint64
+	Length int
+	Bits   uint
+}
+
+func (e *ValueTooLongError) Error() string {
+	return fmt.Sprintf("value of tag %d is %d bytes, too long for a %d-bit length", e.Tag, e.Length, e.Bits)
+}
+
+// ReadTLV reads one entry whose tag and length fields are tagBits and
+// lenBits wide. The length counts the bytes of the value and is bounded by
+// MaxBytesLength, so that any width up to 64 bits is safe to decode.
+func ReadTLV(r *BitReader, tagBits, lenBits uint) (TLV, error) {
+	tag, err := r.ReadBits(tagBits)
+	if err != nil {
+		return TLV{}, err
+	}
+	n, err := r.ReadBits(lenBits)
+	if err != nil {
+		return TLV{}, err
+	}
+	value, err := ReadBytes(r, n)
+	if err != nil {
+		return TLV{}, err
+	}
+	return TLV{Tag: tag, Value: value}, nil
+}
+
+// ReadTLVs reads entries until r is exhausted, bounded by MaxArrayLength.
+func ReadTLVs(r *BitReader, tagBits, lenBits uint) ([]TLV, error) {
+	return ReadToEnd(r, func() (TLV, error) {
+		return ReadTLV(r, tagBits, lenBits)
+	})
+}
+
+// WriteTLV writes one entry with tagBits and lenBits wide tag and length
+// fields.
+func WriteTLV(w *BitWriter, tagBits, lenBits uint, t TLV) error {
+	if lenBits < 64 && uint64(len(t.Value)) >= 1<<lenBits {
+		return &ValueTooLongError{Tag: t.Tag, Length: len(t.Value), Bits: lenBits}
+	}
+	if err := w.WriteBits(t.Tag, tagBits); err != nil {
+		return err
+	}
+	if err := w.WriteBits(uint64(len(t.Value)), lenBits); err != nil {
+		return err
+	}
+	_, err := w.Write(t.Value)
+	return err
+}
+
+// WriteTLVs writes entries in order.
+func WriteTLVs(w *BitWriter, tagBits, lenBits uint, entries []TLV) error {
+	for _, t := range entries {
+		if err := WriteTLV(w, tagBits, lenBits, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestReadTLV(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		data    []byte
+		lenBits uint
+		want    TLV
+		err     error
+	}{
+		{"value", []byte{7, 2, 'h', 'i'}, 8, TLV{Tag: 7, Value: []byte("hi")}, nil},
+		{"empty", []byte{7, 0}, 8, TLV{Tag: 7, Value: []byte{}}, nil},
+		{"short value", []byte{7, 3, 'h', 'i'}, 8, TLV{}, io.ErrUnexpectedEOF},
+		{"short length", []byte{7}, 8, TLV{}, io.ErrUnexpectedEOF},
+		{"64-bit length", []byte{7, 0, 0, 0, 0, 0, 0, 0, 1, 'x'}, 64, TLV{Tag: 7, Value: []byte("x")}, nil},
+		{"huge length", []byte{7, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, 64, TLV{}, &BytesTooLongError{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadTLV(NewBitReader(bytes.NewReader(tt.data)), 8, tt.lenBits)
+			switch want := tt.err.(type) {
+			case nil:
+				if err != nil {
+					t.Fatalf("ReadTLV() error = %v", err)
+				}
+			case *BytesTooLongError:
+				if !errors.As(err, &want) {
+					t.Fatalf("ReadTLV() error = %v, want %T", err, want)
+				}
+				return
+			default:
+				if err != want {
+					t.Fatalf("ReadTLV() error = %v, want %v", err, want)
+				}
+				return
+			}
+			if got.Tag != tt.want.Tag || !bytes.Equal(got.Value, tt.want.Value) {
+				t.Errorf("ReadTLV() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTLVRoundTrip(t *testing.T) {
+	entries := []TLV{{Tag: 1, Value: []byte("a")}, {Tag: 2, Value: []byte{}}, {Tag: 3, Value: []byte("xyz")}}
+	var buf bytes.Buffer
+	w := NewBitWriter(&buf)
+	if err := WriteTLVs(w, 8, 16, entries); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ReadTLVs(NewBitReader(&buf), 8, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(entries) {
+		t.Fatalf("ReadTLVs() = %+v", got)
+	}
+	for i := range got {
+		if got[i].Tag != entries[i].Tag || !bytes.Equal(got[i].Value, entries[i].Value) {
+			t.Errorf("entry %d = %+v, want %+v", i, got[i], entries[i])
+		}
+	}
+
+	err = WriteTLV(w, 8, 8, TLV{Tag: 1, Value: make([]byte, 256)})
+	var tooLong *ValueTooLongError
+	if !errors.As(err, &tooLong) {
+		t.Errorf("WriteTLV() error = %v, want a *ValueTooLongError", err)
+	}
+}
@@ -0,0 +1,58 @@
+package wire
+
+import (
+	"fmt"
+	"math"
+)
+
+// Versions is an inclusive range of protocol versions. Fields annotated with
+// @since and @until are present only in the versions of their range.
+type Versions struct {
+	Since, Until uint64
+}
+
+// AllVersions is the range of a field without @since or @until.
+var AllVersions = Versions{Since: 0, Until: math.MaxUint64}
+
+// Contains reports whether version is in v.
+func (v Versions) Contains(version uint64) bool {
+	return v.Since <= version && version <= v.Until
+}
+
+// Covers reports whether every version in w is also in v.
+func (v Versions) Covers(w Versions) bool {
+	return w.Empty() || v.Since <= w.Since && w.Until <= v.Until
+}
+
+// Intersect returns the versions in both v and w.
+func (v Versions) Intersect(w Versions) Versions {
+	if w.Since > v.Since {
+		v.Since = w.Since
+	}
+	if w.Until < v.Until {
+		v.Until = w.Until
+	}
+	return v
+}
+
+// Empty reports whether v contains no versions.
+func (v Versions) Empty() bool {
+	return v.Since > v.Until
+}
+
+func (v Versions) String() string {
+	switch {
+	case v.Empty():
+		return "no versions"
+	case v == AllVersions:
+		return "all versions"
+	case v.Until == math.MaxUint64:
+		return fmt.Sprintf("versions %d and later", v.Since)
+	case v.Since == 0:
+		return fmt.Sprintf("versions up to %d", v.Until)
+	case v.Since == v.Until:
+		return fmt.Sprintf("version %d", v.Since)
+	default:
+		return fmt.Sprintf("versions %d to %d", v.Since, v.Until)
+	}
+}